@@ -23,13 +23,16 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"strings"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/client-go/rest"
 
 	"github.com/ibm/ibm-metering-receiver-operator/pkg/apis"
+	operatorv1beta1 "github.com/ibm/ibm-metering-receiver-operator/pkg/apis/operator/v1beta1"
 	"github.com/ibm/ibm-metering-receiver-operator/pkg/controller"
+	"github.com/ibm/ibm-metering-receiver-operator/pkg/webhook"
 	"github.com/ibm/ibm-metering-receiver-operator/version"
 	certmgr "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha1"
 
@@ -41,7 +44,11 @@ import (
 	sdkVersion "github.com/operator-framework/operator-sdk/version"
 	"github.com/spf13/pflag"
 	v1 "k8s.io/api/core/v1"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -86,11 +93,17 @@ func main() {
 
 	printVersion()
 
-	namespace, err := k8sutil.GetWatchNamespace()
+	watchNamespace, err := k8sutil.GetWatchNamespace()
 	if err != nil {
 		log.Error(err, "Failed to get watch namespace")
 		os.Exit(1)
 	}
+	namespaces := watchNamespaces(watchNamespace)
+	if len(namespaces) == 0 {
+		log.Info("Watching all namespaces")
+	} else {
+		log.Info("Watching namespaces", "Namespaces", namespaces)
+	}
 
 	// Get a config to talk to the apiserver
 	cfg, err := config.GetConfig()
@@ -107,11 +120,20 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Create a new Cmd to provide shared dependencies and start components
-	mgr, err := manager.New(cfg, manager.Options{
-		Namespace:          namespace,
+	options := manager.Options{
 		MetricsBindAddress: fmt.Sprintf("%s:%d", metricsHost, metricsPort),
-	})
+		Port:               webhook.Port,
+		CertDir:            webhook.CertDir,
+	}
+	// an empty namespace watches all namespaces, several namespaces need a cache for each of them
+	if len(namespaces) == 1 {
+		options.Namespace = namespaces[0]
+	} else if len(namespaces) > 1 {
+		options.NewCache = cache.MultiNamespacedCacheBuilder(namespaces)
+	}
+
+	// Create a new Cmd to provide shared dependencies and start components
+	mgr, err := manager.New(cfg, options)
 	if err != nil {
 		log.Error(err, "")
 		os.Exit(1)
@@ -131,6 +153,18 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Setup Scheme for the CRDs, the webhook setup configures the conversion webhook of the MeteringReceiver CRD
+	if err := apiextensionsv1beta1.AddToScheme(mgr.GetScheme()); err != nil {
+		log.Error(err, "")
+		os.Exit(1)
+	}
+
+	// Setup the admission and conversion webhooks
+	if err := webhook.Setup(mgr); err != nil {
+		log.Error(err, "Failed to setup webhooks")
+		os.Exit(1)
+	}
+
 	// Setup all Controllers
 	if err := controller.AddToManager(mgr); err != nil {
 		log.Error(err, "")
@@ -138,7 +172,7 @@ func main() {
 	}
 
 	// Add the Metrics Service
-	addMetrics(ctx, cfg, namespace)
+	addMetrics(ctx, cfg, namespaces)
 
 	log.Info("Starting the Cmd.")
 
@@ -151,8 +185,8 @@ func main() {
 
 // addMetrics will create the Services and Service Monitors to allow the operator export the metrics by using
 // the Prometheus operator
-func addMetrics(ctx context.Context, cfg *rest.Config, namespace string) {
-	if err := serveCRMetrics(cfg); err != nil {
+func addMetrics(ctx context.Context, cfg *rest.Config, namespaces []string) {
+	if err := serveCRMetrics(cfg, namespaces); err != nil {
 		if errors.Is(err, k8sutil.ErrRunLocal) {
 			log.Info("Skipping CR metrics server creation; not running in a cluster.")
 			return
@@ -174,10 +208,17 @@ func addMetrics(ctx context.Context, cfg *rest.Config, namespace string) {
 		log.Info("Could not create metrics Service", "error", err.Error())
 	}
 
+	// the metrics Service is in the namespace of the operator, which is not always watched
+	operatorNs, err := k8sutil.GetOperatorNamespace()
+	if err != nil {
+		log.Info("Could not get the operator namespace", "error", err.Error())
+		return
+	}
+
 	// CreateServiceMonitors will automatically create the prometheus-operator ServiceMonitor resources
 	// necessary to configure Prometheus to scrape metrics from this operator.
 	services := []*v1.Service{service}
-	_, err = metrics.CreateServiceMonitors(cfg, namespace, services)
+	_, err = metrics.CreateServiceMonitors(cfg, operatorNs, services)
 	if err != nil {
 		log.Info("Could not create ServiceMonitor object", "error", err.Error())
 		// If this operator is deployed to a cluster without the prometheus-operator running, it will return
@@ -188,22 +229,33 @@ func addMetrics(ctx context.Context, cfg *rest.Config, namespace string) {
 	}
 }
 
-// serveCRMetrics gets the Operator/CustomResource GVKs and generates metrics based on those types.
+// serveCRMetrics gets the Operator/CustomResource GVKs and generates metrics based on those types
+// for every watched namespace, or for all namespaces when namespaces is empty.
 // It serves those metrics on "http://metricsHost:operatorMetricsPort".
-func serveCRMetrics(cfg *rest.Config) error {
+func serveCRMetrics(cfg *rest.Config, namespaces []string) error {
 	// Below function returns filtered operator/CustomResource specific GVKs.
 	// For more control override the below GVK list with your own custom logic.
-	filteredGVK, err := k8sutil.GetGVKsFromAddToScheme(apis.AddToScheme)
+	gvks, err := k8sutil.GetGVKsFromAddToScheme(apis.AddToScheme)
 	if err != nil {
 		return err
 	}
-	// Get the namespace the operator is currently deployed in.
-	operatorNs, err := k8sutil.GetOperatorNamespace()
+	// every MeteringReceiver is served in all API versions, so only generate metrics for the storage version
+	filteredGVK := []schema.GroupVersionKind{}
+	for _, gvk := range gvks {
+		if gvk.GroupVersion() == operatorv1beta1.SchemeGroupVersion {
+			filteredGVK = append(filteredGVK, gvk)
+		}
+	}
+	// The metrics are only generated when the operator runs in the cluster
+	_, err = k8sutil.GetOperatorNamespace()
 	if err != nil {
 		return err
 	}
-	// To generate metrics in other namespaces, add the values below.
-	ns := []string{operatorNs}
+	ns := namespaces
+	if len(ns) == 0 {
+		// the empty namespace generates the metrics of the CRs in all namespaces
+		ns = []string{metav1.NamespaceAll}
+	}
 	// Generate and serve custom resource specific metrics.
 	err = kubemetrics.GenerateAndServeCRMetrics(cfg, ns, filteredGVK, metricsHost, operatorMetricsPort)
 	if err != nil {
@@ -211,3 +263,18 @@ func serveCRMetrics(cfg *rest.Config) error {
 	}
 	return nil
 }
+
+// watchNamespaces returns the namespaces in WATCH_NAMESPACE, a comma-separated list of namespaces.
+// An empty list means all namespaces.
+func watchNamespaces(watchNamespace string) []string {
+	var namespaces []string
+	seen := map[string]bool{}
+	for _, ns := range strings.Split(watchNamespace, ",") {
+		ns = strings.TrimSpace(ns)
+		if ns != "" && !seen[ns] {
+			seen[ns] = true
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces
+}
@@ -0,0 +1,45 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The phases, condition types and the helpers that set them are defined in v1beta1,
+// the version the operator reconciles. The status of a v1alpha1 CR is converted from it field by field.
+
+// MeteringPhase is a one-word summary of the state of a MeteringReceiver
+type MeteringPhase string
+
+// ConditionType is the type of a MeteringCondition
+type ConditionType string
+
+// MeteringCondition describes one aspect of the state of a MeteringReceiver
+type MeteringCondition struct {
+	// Type of the condition
+	Type ConditionType `json:"type"`
+	// Status of the condition, one of True, False or Unknown
+	Status corev1.ConditionStatus `json:"status"`
+	// Reason is a CamelCase reason for the last transition
+	Reason string `json:"reason,omitempty"`
+	// Message is a human readable description of the last transition
+	Message string `json:"message,omitempty"`
+	// LastTransitionTime is the last time the condition changed from one status to another
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+}
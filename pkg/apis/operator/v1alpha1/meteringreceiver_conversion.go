@@ -0,0 +1,171 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/ibm/ibm-metering-receiver-operator/pkg/apis/operator/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// specAnnotation stores the v1beta1 spec of a CR that is read as v1alpha1,
+// so that the settings v1alpha1 can't represent are kept when the CR is written back.
+const specAnnotation = "operator.ibm.com/v1beta1-spec"
+
+var _ conversion.Convertible = &MeteringReceiver{}
+
+// ConvertTo converts this MeteringReceiver to the hub version, v1beta1
+func (src *MeteringReceiver) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.MeteringReceiver)
+
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Annotations = copyAnnotations(src.Annotations)
+	if data, ok := dst.Annotations[specAnnotation]; ok {
+		// start from the v1beta1 spec, then apply the v1alpha1 fields that may have been changed
+		if err := json.Unmarshal([]byte(data), &dst.Spec); err != nil {
+			return err
+		}
+		delete(dst.Annotations, specAnnotation)
+		if len(dst.Annotations) == 0 {
+			dst.Annotations = nil
+		}
+	}
+	src.Spec.convertTo(&dst.Spec)
+	src.Status.convertTo(&dst.Status)
+	return nil
+}
+
+// ConvertFrom converts the hub version, v1beta1, to this MeteringReceiver
+func (dst *MeteringReceiver) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.MeteringReceiver)
+
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Annotations = copyAnnotations(src.Annotations)
+	delete(dst.Annotations, specAnnotation)
+	dst.Spec.convertFrom(&src.Spec)
+	dst.Status.convertFrom(&src.Status)
+
+	// keep the v1beta1 spec when it has settings that were lost in the conversion.
+	// The defaults are not lost, the defaulting webhook sets them again when the CR is written back.
+	roundTrip := v1beta1.MeteringReceiverSpec{}
+	dst.Spec.convertTo(&roundTrip)
+	roundTrip.SetDefaults()
+	defaulted := src.Spec.DeepCopy()
+	defaulted.SetDefaults()
+	if !reflect.DeepEqual(roundTrip, *defaulted) {
+		data, err := json.Marshal(src.Spec)
+		if err != nil {
+			return err
+		}
+		if dst.Annotations == nil {
+			dst.Annotations = map[string]string{}
+		}
+		dst.Annotations[specAnnotation] = string(data)
+	}
+	if len(dst.Annotations) == 0 {
+		dst.Annotations = nil
+	}
+	return nil
+}
+
+// convertTo sets the fields of dst that exist in v1alpha1 and keeps the other fields
+func (s *MeteringReceiverSpec) convertTo(dst *v1beta1.MeteringReceiverSpec) {
+	dst.Version = s.Version
+	dst.ImageRegistry = s.ImageRegistry
+	dst.ImageTagPostfix = s.ImageTagPostfix
+	dst.ClusterIssuer = s.ClusterIssuer
+
+	dst.MongoDB.Host = s.MongoDB.Host
+	dst.MongoDB.Port = int32(s.MongoDB.Port)
+	dst.MongoDB.Credentials.SecretRef.Name = s.MongoDB.UsernameSecret
+	dst.MongoDB.Credentials.UsernameKey = s.MongoDB.UsernameKey
+	dst.MongoDB.Credentials.PasswordKey = s.MongoDB.PasswordKey
+	// v1alpha1 defaults an empty password secret to icp-mongodb-admin, not to the username secret.
+	// When both are empty, the v1beta1 defaults give the same secret to both.
+	passwordSecret := s.MongoDB.PasswordSecret
+	if passwordSecret == "" && s.MongoDB.UsernameSecret != "" {
+		passwordSecret = v1beta1.DefaultMongoDBCredentialsSecret
+	}
+	// v1beta1 only has a separate password secret when it differs from the username secret
+	if passwordSecret != s.MongoDB.UsernameSecret {
+		dst.MongoDB.Credentials.PasswordSecretRef = &corev1.LocalObjectReference{Name: passwordSecret}
+	} else if dst.MongoDB.Credentials.PasswordSecretName() != passwordSecret {
+		dst.MongoDB.Credentials.PasswordSecretRef = nil
+	}
+	dst.MongoDB.TLS.CASecretRef.Name = s.MongoDB.ClusterCertsSecret
+	dst.MongoDB.TLS.ClientCertSecretRef.Name = s.MongoDB.ClientCertsSecret
+}
+
+func (s *MeteringReceiverSpec) convertFrom(src *v1beta1.MeteringReceiverSpec) {
+	s.Version = src.Version
+	s.ImageRegistry = src.ImageRegistry
+	s.ImageTagPostfix = src.ImageTagPostfix
+	s.ClusterIssuer = src.ClusterIssuer
+
+	s.MongoDB.Host = src.MongoDB.Host
+	s.MongoDB.Port = int(src.MongoDB.Port)
+	s.MongoDB.UsernameSecret = src.MongoDB.Credentials.UsernameSecretName()
+	s.MongoDB.UsernameKey = src.MongoDB.Credentials.UsernameKey
+	s.MongoDB.PasswordSecret = src.MongoDB.Credentials.PasswordSecretName()
+	s.MongoDB.PasswordKey = src.MongoDB.Credentials.PasswordKey
+	s.MongoDB.ClusterCertsSecret = src.MongoDB.TLS.CASecretRef.Name
+	s.MongoDB.ClientCertsSecret = src.MongoDB.TLS.ClientCertSecretRef.Name
+}
+
+func (s *MeteringStatus) convertTo(dst *v1beta1.MeteringStatus) {
+	dst.Phase = v1beta1.MeteringPhase(s.Phase)
+	dst.ObservedGeneration = s.ObservedGeneration
+	dst.Conditions = nil
+	for _, c := range s.Conditions {
+		dst.Conditions = append(dst.Conditions, v1beta1.MeteringCondition{
+			Type:               v1beta1.ConditionType(c.Type),
+			Status:             c.Status,
+			Reason:             c.Reason,
+			Message:            c.Message,
+			LastTransitionTime: *c.LastTransitionTime.DeepCopy(),
+		})
+	}
+}
+
+func (s *MeteringStatus) convertFrom(src *v1beta1.MeteringStatus) {
+	s.Phase = MeteringPhase(src.Phase)
+	s.ObservedGeneration = src.ObservedGeneration
+	s.Conditions = nil
+	for _, c := range src.Conditions {
+		s.Conditions = append(s.Conditions, MeteringCondition{
+			Type:               ConditionType(c.Type),
+			Status:             c.Status,
+			Reason:             c.Reason,
+			Message:            c.Message,
+			LastTransitionTime: *c.LastTransitionTime.DeepCopy(),
+		})
+	}
+}
+
+func copyAnnotations(annotations map[string]string) map[string]string {
+	if annotations == nil {
+		return nil
+	}
+	result := make(map[string]string, len(annotations))
+	for k, v := range annotations {
+		result[k] = v
+	}
+	return result
+}
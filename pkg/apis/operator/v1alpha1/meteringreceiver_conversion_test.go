@@ -0,0 +1,205 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package v1alpha1
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ibm/ibm-metering-receiver-operator/pkg/apis/operator/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestConvertV1alpha1RoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		mongoDB MeteringReceiverSpecMongoDB
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "same username and password secret",
+			mongoDB: MeteringReceiverSpecMongoDB{
+				Host:               "mongodb.example.com",
+				Port:               27018,
+				UsernameSecret:     "mongodb-admin",
+				UsernameKey:        "user",
+				PasswordSecret:     "mongodb-admin",
+				PasswordKey:        "password",
+				ClusterCertsSecret: "mongodb-ca",
+				ClientCertsSecret:  "mongodb-client",
+			},
+		},
+		{
+			name: "separate password secret",
+			mongoDB: MeteringReceiverSpecMongoDB{
+				Host:           "mongodb",
+				Port:           27017,
+				UsernameSecret: "mongodb-user",
+				UsernameKey:    "user",
+				PasswordSecret: "mongodb-password",
+				PasswordKey:    "password",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := &MeteringReceiver{
+				ObjectMeta: metav1.ObjectMeta{Name: "receiver", Namespace: "metering", Labels: map[string]string{"app": "receiver"}},
+				Spec: MeteringReceiverSpec{
+					Version:         "3.7.0",
+					ImageRegistry:   "registry.example.com/metering",
+					ImageTagPostfix: "-dev",
+					ClusterIssuer:   "my-issuer",
+					MongoDB:         tt.mongoDB,
+				},
+				Status: MeteringStatus{
+					Phase:              "Ready",
+					ObservedGeneration: 3,
+					Conditions: []MeteringCondition{
+						{Type: "Ready", Status: corev1.ConditionTrue, Reason: "AsExpected", Message: "ready"},
+					},
+				},
+			}
+
+			hub := &v1beta1.MeteringReceiver{}
+			if err := src.ConvertTo(hub); err != nil {
+				t.Fatalf("ConvertTo() error = %v", err)
+			}
+			dst := &MeteringReceiver{}
+			if err := dst.ConvertFrom(hub); err != nil {
+				t.Fatalf("ConvertFrom() error = %v", err)
+			}
+			if !reflect.DeepEqual(dst, src) {
+				t.Errorf("round trip = %+v, want %+v", dst, src)
+			}
+		})
+	}
+}
+
+func TestConvertV1alpha1EmptyPasswordSecret(t *testing.T) {
+	// a v1alpha1 CR that only sets the username secret gets the password from icp-mongodb-admin, as v1alpha1 defaults it
+	src := &MeteringReceiver{
+		ObjectMeta: metav1.ObjectMeta{Name: "receiver", Namespace: "metering"},
+		Spec: MeteringReceiverSpec{
+			MongoDB: MeteringReceiverSpecMongoDB{UsernameSecret: "custom"},
+		},
+	}
+
+	hub := &v1beta1.MeteringReceiver{}
+	if err := src.ConvertTo(hub); err != nil {
+		t.Fatalf("ConvertTo() error = %v", err)
+	}
+	hub.Default()
+	if err := hub.ValidateCreate(); err != nil {
+		t.Errorf("ValidateCreate() of the converted CR error = %v", err)
+	}
+	credentials := hub.Spec.MongoDB.Credentials
+	if credentials.UsernameSecretName() != "custom" || credentials.PasswordSecretName() != v1beta1.DefaultMongoDBCredentialsSecret {
+		t.Errorf("credentials = %+v, want username secret custom and password secret %s",
+			credentials, v1beta1.DefaultMongoDBCredentialsSecret)
+	}
+
+	dst := &MeteringReceiver{}
+	if err := dst.ConvertFrom(hub); err != nil {
+		t.Fatalf("ConvertFrom() error = %v", err)
+	}
+	if dst.Spec.MongoDB.UsernameSecret != "custom" || dst.Spec.MongoDB.PasswordSecret != v1beta1.DefaultMongoDBCredentialsSecret {
+		t.Errorf("round trip MongoDB = %+v, want usernameSecret custom and passwordSecret %s",
+			dst.Spec.MongoDB, v1beta1.DefaultMongoDBCredentialsSecret)
+	}
+	if _, ok := dst.Annotations[specAnnotation]; ok {
+		t.Errorf("annotation %s set on a CR with v1alpha1 settings only", specAnnotation)
+	}
+}
+
+func TestConvertV1beta1RoundTrip(t *testing.T) {
+	replicas := int32(3)
+	minReplicas := int32(2)
+	tests := []struct {
+		name           string
+		spec           v1beta1.MeteringReceiverSpec
+		wantAnnotation bool
+	}{
+		{
+			name: "defaults only",
+			spec: v1beta1.MeteringReceiverSpec{},
+		},
+		{
+			name: "v1alpha1 settings",
+			spec: v1beta1.MeteringReceiverSpec{
+				ImageRegistry: "registry.example.com/metering",
+				MongoDB: v1beta1.MongoDBSpec{
+					Host: "mongodb.example.com",
+					Credentials: v1beta1.MongoDBCredentials{
+						SecretRef:         corev1.LocalObjectReference{Name: "mongodb-user"},
+						PasswordSecretRef: &corev1.LocalObjectReference{Name: "mongodb-password"},
+					},
+				},
+			},
+		},
+		{
+			name: "v1beta1 replicas",
+			spec: v1beta1.MeteringReceiverSpec{
+				Replicas: &replicas,
+			},
+			wantAnnotation: true,
+		},
+		{
+			name: "v1beta1 service and autoscaling",
+			spec: v1beta1.MeteringReceiverSpec{
+				Service: v1beta1.ServiceSpec{
+					Type:        corev1.ServiceTypeNodePort,
+					Annotations: map[string]string{"example.com/owner": "metering"},
+				},
+				Autoscaling: &v1beta1.AutoscalingSpec{MinReplicas: &minReplicas, MaxReplicas: 5},
+			},
+			wantAnnotation: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the defaulting webhook sets the defaults before the CR is stored
+			spec := tt.spec.DeepCopy()
+			spec.SetDefaults()
+			src := &v1beta1.MeteringReceiver{
+				ObjectMeta: metav1.ObjectMeta{Name: "receiver", Namespace: "metering"},
+				Spec:       *spec,
+			}
+
+			spoke := &MeteringReceiver{}
+			if err := spoke.ConvertFrom(src); err != nil {
+				t.Fatalf("ConvertFrom() error = %v", err)
+			}
+			if _, ok := spoke.Annotations[specAnnotation]; ok != tt.wantAnnotation {
+				t.Errorf("annotation %s set = %v, want %v", specAnnotation, ok, tt.wantAnnotation)
+			}
+
+			dst := &v1beta1.MeteringReceiver{}
+			if err := spoke.ConvertTo(dst); err != nil {
+				t.Fatalf("ConvertTo() error = %v", err)
+			}
+			// without the annotation, the webhook sets the defaults again when the CR is written back
+			dst.Spec.SetDefaults()
+			if !reflect.DeepEqual(dst, src) {
+				t.Errorf("round trip = %+v, want %+v", dst, src)
+			}
+		})
+	}
+}
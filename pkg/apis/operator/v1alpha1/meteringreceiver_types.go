@@ -28,11 +28,11 @@ type MeteringReceiverSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "operator-sdk generate k8s" to regenerate code after modifying this file
 	// Add custom validation using kubebuilder tags: https://book-v1.book.kubebuilder.io/beyond_basics/generating_crd.html
-	Version         string                      `json:"version"`
+	Version         string                      `json:"version,omitempty"`
 	ImageRegistry   string                      `json:"imageRegistry,omitempty"`
 	ImageTagPostfix string                      `json:"imageTagPostfix,omitempty"`
 	ClusterIssuer   string                      `json:"clusterIssuer,omitempty"`
-	MongoDB         MeteringReceiverSpecMongoDB `json:"mongodb"`
+	MongoDB         MeteringReceiverSpecMongoDB `json:"mongodb,omitempty"`
 }
 
 // MeteringStatus defines the observed state of each Metering service
@@ -40,27 +40,36 @@ type MeteringStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "operator-sdk generate k8s" to regenerate code after modifying this file
 	// Add custom validation using kubebuilder tags: https://book-v1.book.kubebuilder.io/beyond_basics/generating_crd.html
-	// PodNames are the names of the metering pods
-	PodNames []string `json:"podNames"`
+
+	// Phase is a one-word summary of the Conditions
+	Phase MeteringPhase `json:"phase,omitempty"`
+	// ObservedGeneration is the most recent generation of the CR processed by the operator
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions describe the state of the Deployment, Service and Certificate managed for the CR
+	Conditions []MeteringCondition `json:"conditions,omitempty"`
 }
 
-// MeteringSpecMongoDB defines the MongoDB configuration in all the Metering specs
+// MeteringSpecMongoDB defines the MongoDB configuration in all the Metering specs.
+// Fields that are not set get the values of the MongoDB installed by Common Services.
 type MeteringReceiverSpecMongoDB struct {
-	Host               string `json:"host"`
-	Port               int    `json:"port"`
-	UsernameSecret     string `json:"usernameSecret"`
-	UsernameKey        string `json:"usernameKey"`
-	PasswordSecret     string `json:"passwordSecret"`
-	PasswordKey        string `json:"passwordKey"`
-	ClusterCertsSecret string `json:"clustercertssecret"`
-	ClientCertsSecret  string `json:"clientcertssecret"`
+	Host               string `json:"host,omitempty"`
+	Port               int    `json:"port,omitempty"`
+	UsernameSecret     string `json:"usernameSecret,omitempty"`
+	UsernameKey        string `json:"usernameKey,omitempty"`
+	PasswordSecret     string `json:"passwordSecret,omitempty"`
+	PasswordKey        string `json:"passwordKey,omitempty"`
+	ClusterCertsSecret string `json:"clustercertssecret,omitempty"`
+	ClientCertsSecret  string `json:"clientcertssecret,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
-// MeteringReceiver is the Schema for the meteringreceivers API
+// MeteringReceiver is the Schema for the meteringreceivers API.
+// It is converted to and from v1beta1, the storage version.
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:path=meteringreceivers,scope=Namespaced
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 type MeteringReceiver struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
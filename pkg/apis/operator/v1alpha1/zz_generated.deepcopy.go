@@ -24,6 +24,23 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MeteringCondition) DeepCopyInto(out *MeteringCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MeteringCondition.
+func (in *MeteringCondition) DeepCopy() *MeteringCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(MeteringCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MeteringReceiver) DeepCopyInto(out *MeteringReceiver) {
 	*out = *in
@@ -121,10 +138,12 @@ func (in *MeteringReceiverSpecMongoDB) DeepCopy() *MeteringReceiverSpecMongoDB {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MeteringStatus) DeepCopyInto(out *MeteringStatus) {
 	*out = *in
-	if in.PodNames != nil {
-		in, out := &in.PodNames, &out.PodNames
-		*out = make([]string, len(*in))
-		copy(*out, *in)
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]MeteringCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	return
 }
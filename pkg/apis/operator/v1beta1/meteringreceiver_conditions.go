@@ -0,0 +1,110 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MeteringPhase is a one-word summary of the state of a MeteringReceiver
+type MeteringPhase string
+
+const (
+	// PhasePending means the operator has not yet created the resources for the CR
+	PhasePending MeteringPhase = "Pending"
+	// PhaseProgressing means the resources exist but are not all available yet
+	PhaseProgressing MeteringPhase = "Progressing"
+	// PhaseReady means all the resources are available and up to date
+	PhaseReady MeteringPhase = "Ready"
+	// PhaseDegraded means one or more resources failed
+	PhaseDegraded MeteringPhase = "Degraded"
+	// PhaseTerminating means the CR is being deleted and the operator is cleaning up after it
+	PhaseTerminating MeteringPhase = "Terminating"
+)
+
+// ConditionType is the type of a MeteringCondition
+type ConditionType string
+
+const (
+	// ConditionReady is true when the receiver is available and all its resources are up to date
+	ConditionReady ConditionType = "Ready"
+	// ConditionAvailable is true when at least one receiver pod is available
+	ConditionAvailable ConditionType = "Available"
+	// ConditionProgressing is true while the resources are being created or rolled out
+	ConditionProgressing ConditionType = "Progressing"
+	// ConditionDegraded is true when a resource failed or could not be reconciled
+	ConditionDegraded ConditionType = "Degraded"
+	// ConditionSecretsMissing is true when secrets referenced by the CR, or keys in them, do not exist.
+	// The receiver Deployment is not rolled out until they are created.
+	ConditionSecretsMissing ConditionType = "SecretsMissing"
+	// ConditionCleanupComplete is set when the CR is deleted. It is true when the resources
+	// that are not garbage collected have been deleted or retained, as set in spec.deletionPolicy.
+	ConditionCleanupComplete ConditionType = "CleanupComplete"
+)
+
+// MeteringCondition describes one aspect of the state of a MeteringReceiver
+type MeteringCondition struct {
+	// Type of the condition
+	Type ConditionType `json:"type"`
+	// Status of the condition, one of True, False or Unknown
+	Status corev1.ConditionStatus `json:"status"`
+	// Reason is a CamelCase reason for the last transition
+	Reason string `json:"reason,omitempty"`
+	// Message is a human readable description of the last transition
+	Message string `json:"message,omitempty"`
+	// LastTransitionTime is the last time the condition changed from one status to another
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// GetCondition returns the condition with the given type, or nil if it is not set
+func (s *MeteringStatus) GetCondition(conditionType ConditionType) *MeteringCondition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == conditionType {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// IsConditionTrue returns true if the condition with the given type has status True
+func (s *MeteringStatus) IsConditionTrue(conditionType ConditionType) bool {
+	condition := s.GetCondition(conditionType)
+	return condition != nil && condition.Status == corev1.ConditionTrue
+}
+
+// SetCondition adds or updates the condition with the given type.
+// LastTransitionTime is only changed when the status of the condition changes.
+func (s *MeteringStatus) SetCondition(conditionType ConditionType, status corev1.ConditionStatus, reason, message string) {
+	condition := s.GetCondition(conditionType)
+	if condition == nil {
+		s.Conditions = append(s.Conditions, MeteringCondition{
+			Type:               conditionType,
+			Status:             status,
+			Reason:             reason,
+			Message:            message,
+			LastTransitionTime: metav1.Now(),
+		})
+		return
+	}
+	if condition.Status != status {
+		condition.Status = status
+		condition.LastTransitionTime = metav1.Now()
+	}
+	condition.Reason = reason
+	condition.Message = message
+}
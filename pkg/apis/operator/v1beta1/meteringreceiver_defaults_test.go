@@ -0,0 +1,210 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package v1beta1
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestSetDefaults(t *testing.T) {
+	int32Ptr := func(i int32) *int32 { return &i }
+	boolPtr := func(b bool) *bool { return &b }
+	intOrStringPtr := func(v intstr.IntOrString) *intstr.IntOrString { return &v }
+
+	tests := []struct {
+		name string
+		spec MeteringReceiverSpec
+		want func(s *MeteringReceiverSpec)
+	}{
+		{
+			name: "empty spec",
+			want: func(s *MeteringReceiverSpec) {},
+		},
+		{
+			name: "values that are set are kept",
+			spec: MeteringReceiverSpec{
+				Version:        "3.6.0",
+				ImageRegistry:  "registry.example.com/metering",
+				ClusterIssuer:  "my-issuer",
+				TLS:            TLSSpec{Mode: TLSModeOperator},
+				Logging:        LoggingSpec{Level: LogLevelDebug, VerboseInit: boolPtr(false)},
+				Replicas:       int32Ptr(3),
+				Service:        ServiceSpec{Type: corev1.ServiceTypeNodePort, Port: 443},
+				DeletionPolicy: DeletionPolicyRetain,
+				MongoDB: MongoDBSpec{
+					Host: "mongodb.example.com",
+					Port: 27018,
+					Credentials: MongoDBCredentials{
+						SecretRef:   corev1.LocalObjectReference{Name: "mongodb-user"},
+						UsernameKey: "username",
+					},
+					TLS: MongoDBTLS{Enabled: boolPtr(false)},
+				},
+			},
+			want: func(s *MeteringReceiverSpec) {
+				s.Version = "3.6.0"
+				s.ImageRegistry = "registry.example.com/metering"
+				s.ClusterIssuer = "my-issuer"
+				s.TLS.Mode = TLSModeOperator
+				s.Logging = LoggingSpec{Level: LogLevelDebug, VerboseInit: boolPtr(false)}
+				s.Replicas = int32Ptr(3)
+				s.Service = ServiceSpec{Type: corev1.ServiceTypeNodePort, Port: 443}
+				s.DeletionPolicy = DeletionPolicyRetain
+				s.MongoDB.Host = "mongodb.example.com"
+				s.MongoDB.Port = 27018
+				s.MongoDB.Credentials.SecretRef.Name = "mongodb-user"
+				s.MongoDB.Credentials.UsernameKey = "username"
+				s.MongoDB.TLS.Enabled = boolPtr(false)
+			},
+		},
+		{
+			name: "MongoDB hosts",
+			spec: MeteringReceiverSpec{
+				MongoDB: MongoDBSpec{Hosts: []string{"mongodb-0", "mongodb-1"}},
+			},
+			want: func(s *MeteringReceiverSpec) {
+				s.MongoDB.Host = ""
+				s.MongoDB.Hosts = []string{"mongodb-0", "mongodb-1"}
+			},
+		},
+		{
+			name: "MongoDB URI",
+			spec: MeteringReceiverSpec{
+				MongoDB: MongoDBSpec{URISecretRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "mongodb-uri"},
+				}},
+			},
+			want: func(s *MeteringReceiverSpec) {
+				// the URI has the host and can have the credentials
+				s.MongoDB.Host = ""
+				s.MongoDB.URISecretRef = &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "mongodb-uri"},
+					Key:                  DefaultMongoDBURIKey,
+				}
+				s.MongoDB.Credentials = MongoDBCredentials{}
+			},
+		},
+		{
+			name: "ECDSA certificate",
+			spec: MeteringReceiverSpec{
+				TLS: TLSSpec{Certificate: TLSCertificateSpec{
+					PrivateKey: PrivateKeySpec{Algorithm: PrivateKeyAlgorithmECDSA},
+					IssuerRef:  &IssuerReference{Name: "my-issuer"},
+				}},
+			},
+			want: func(s *MeteringReceiverSpec) {
+				s.TLS.Certificate.PrivateKey = PrivateKeySpec{Algorithm: PrivateKeyAlgorithmECDSA, Size: DefaultECDSAKeySize}
+				s.TLS.Certificate.IssuerRef = &IssuerReference{Name: "my-issuer", Kind: DefaultIssuerKind}
+			},
+		},
+		{
+			name: "autoscaling on memory",
+			spec: MeteringReceiverSpec{
+				Autoscaling: &AutoscalingSpec{MaxReplicas: 5, TargetMemoryUtilizationPercentage: int32Ptr(70)},
+			},
+			want: func(s *MeteringReceiverSpec) {
+				s.Autoscaling = &AutoscalingSpec{
+					MinReplicas:                       int32Ptr(DefaultMinReplicas),
+					MaxReplicas:                       5,
+					TargetMemoryUtilizationPercentage: int32Ptr(70),
+				}
+			},
+		},
+		{
+			name: "PodDisruptionBudget with minAvailable",
+			spec: MeteringReceiverSpec{
+				PodDisruptionBudget: &PodDisruptionBudgetSpec{MinAvailable: intOrStringPtr(intstr.FromString("50%"))},
+			},
+			want: func(s *MeteringReceiverSpec) {
+				s.PodDisruptionBudget = &PodDisruptionBudgetSpec{MinAvailable: intOrStringPtr(intstr.FromString("50%"))}
+			},
+		},
+		{
+			name: "Ingress and Route",
+			spec: MeteringReceiverSpec{
+				Ingress:  &IngressSpec{Host: "metering.example.com"},
+				Exposure: &ExposureSpec{Type: ExposureTypeRoute},
+			},
+			want: func(s *MeteringReceiverSpec) {
+				s.Ingress = &IngressSpec{Host: "metering.example.com", Path: DefaultIngressPath, Class: DefaultIngressClass}
+				s.Exposure = &ExposureSpec{Type: ExposureTypeRoute, Route: RouteSpec{Termination: DefaultRouteTermination}}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := defaultSpec()
+			tt.want(want)
+
+			got := tt.spec.DeepCopy()
+			got.SetDefaults()
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("SetDefaults() = %+v, want %+v", got, want)
+			}
+
+			// the defaults are set on every admission request, they must not change a defaulted spec
+			again := got.DeepCopy()
+			again.SetDefaults()
+			if !reflect.DeepEqual(again, got) {
+				t.Errorf("SetDefaults() twice = %+v, want %+v", again, got)
+			}
+		})
+	}
+}
+
+// defaultSpec returns the spec that SetDefaults sets on an empty spec
+func defaultSpec() *MeteringReceiverSpec {
+	replicas := int32(DefaultReplicas)
+	verboseInit := DefaultVerboseInit
+	tlsEnabled := DefaultMongoDBTLSEnabled
+	maxUnavailable := intstr.FromInt(DefaultMaxUnavailable)
+	return &MeteringReceiverSpec{
+		Version:       DefaultVersion,
+		ImageRegistry: DefaultImageRegistry,
+		ClusterIssuer: DefaultClusterIssuer,
+		TLS: TLSSpec{
+			Mode: DefaultTLSMode,
+			Certificate: TLSCertificateSpec{
+				PrivateKey:    PrivateKeySpec{Algorithm: DefaultPrivateKeyAlgorithm, Size: DefaultRSAKeySize},
+				ClusterDomain: DefaultClusterDomain,
+			},
+		},
+		Logging: LoggingSpec{Level: DefaultLogLevel, VerboseInit: &verboseInit},
+		MongoDB: MongoDBSpec{
+			Host: DefaultMongoDBHost,
+			Port: DefaultMongoDBPort,
+			Credentials: MongoDBCredentials{
+				SecretRef:   corev1.LocalObjectReference{Name: DefaultMongoDBCredentialsSecret},
+				UsernameKey: DefaultMongoDBUsernameKey,
+				PasswordKey: DefaultMongoDBPasswordKey,
+			},
+			TLS: MongoDBTLS{
+				Enabled:             &tlsEnabled,
+				CASecretRef:         corev1.LocalObjectReference{Name: DefaultMongoDBCASecret},
+				ClientCertSecretRef: corev1.LocalObjectReference{Name: DefaultMongoDBClientCertSecret},
+			},
+		},
+		Replicas:            &replicas,
+		PodDisruptionBudget: &PodDisruptionBudgetSpec{MaxUnavailable: &maxUnavailable},
+		Service:             ServiceSpec{Type: DefaultServiceType, Port: DefaultServicePort},
+		DeletionPolicy:      DefaultDeletionPolicy,
+	}
+}
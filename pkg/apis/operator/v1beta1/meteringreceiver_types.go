@@ -0,0 +1,545 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package v1beta1
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
+
+// ResourceNamingAnnotation records how the objects created for the CR are named.
+// The operator sets it on the first reconcile: legacy when the CR already owns the objects with the fixed names
+// of the single instance operator, instance otherwise. It can be set to legacy on a new CR to keep the fixed names.
+const ResourceNamingAnnotation = "operator.ibm.com/resource-naming"
+
+// Values of ResourceNamingAnnotation
+const (
+	// ResourceNamingLegacy uses the fixed names, like the metering-receiver Deployment
+	ResourceNamingLegacy = "legacy"
+	// ResourceNamingInstance derives the names from the name of the CR, so several CRs can run in one namespace
+	ResourceNamingInstance = "instance"
+)
+
+// MeteringReceiverSpec defines the desired state of MeteringReceiver
+type MeteringReceiverSpec struct {
+	// Version is the version of the receiver, like 3.7.0
+	Version string `json:"version,omitempty"`
+	// ImageRegistry is the registry the receiver image is pulled from
+	ImageRegistry string `json:"imageRegistry,omitempty"`
+	// ImageTagPostfix is appended to the tag of the receiver image
+	ImageTagPostfix string `json:"imageTagPostfix,omitempty"`
+	// ClusterIssuer is the cert-manager ClusterIssuer of the receiver certificate,
+	// unless tls.certificate.issuerRef is set
+	ClusterIssuer string `json:"clusterIssuer,omitempty"`
+	// TLS selects who provides the receiver serving certificate
+	TLS TLSSpec `json:"tls,omitempty"`
+	// Components are the data manager components run in the receiver pods
+	Components ComponentsSpec `json:"components,omitempty"`
+	// Logging are the log levels of the receiver
+	Logging LoggingSpec `json:"logging,omitempty"`
+	// MongoDB is the connection to the MongoDB the receiver stores its data in
+	MongoDB MongoDBSpec `json:"mongodb,omitempty"`
+	// Replicas is the number of receiver pods when autoscaling is not enabled
+	Replicas *int32 `json:"replicas,omitempty"`
+	// Autoscaling scales the receiver pods with a HorizontalPodAutoscaler.
+	// The operator does not change the replicas of the receiver Deployment while it is set.
+	Autoscaling *AutoscalingSpec `json:"autoscaling,omitempty"`
+	// PodDisruptionBudget limits the receiver pods that can be evicted at the same time.
+	// The PodDisruptionBudget is only created when there is more than one receiver pod.
+	PodDisruptionBudget *PodDisruptionBudgetSpec `json:"podDisruptionBudget,omitempty"`
+	// Resources overrides the default resources of the receiver containers
+	Resources *ResourcesSpec `json:"resources,omitempty"`
+	// NodeSelector must match the labels of a node for the receiver pods to be scheduled on it
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Affinity are the scheduling constraints of the receiver pods.
+	// The node affinity replaces the default affinity to the supported architectures,
+	// the pod affinity and pod anti-affinity are added to it.
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+	// Tolerations are added to the default tolerations of the receiver pods
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// TopologySpreadConstraints describe how the receiver pods are spread across topology domains
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+	// PriorityClassName is the priority class of the receiver pods
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+	// Ingress exposes the receiver outside the cluster
+	Ingress *IngressSpec `json:"ingress,omitempty"`
+	// Service is the receiver Service
+	Service ServiceSpec `json:"service,omitempty"`
+	// Exposure selects the object that exposes the receiver outside the cluster, in addition to the Ingress
+	Exposure *ExposureSpec `json:"exposure,omitempty"`
+	// NetworkPolicy restricts the network traffic of the receiver pods
+	NetworkPolicy *NetworkPolicySpec `json:"networkPolicy,omitempty"`
+	// DeletionPolicy is Delete or Retain. With Delete, the resources that are not garbage collected,
+	// like the receiver certificate secret, are deleted with the CR.
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// DeletionPolicy selects what happens to the resources that are not garbage collected when the CR is deleted
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete deletes the resources with the CR
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// DeletionPolicyRetain keeps the resources, so they are used again by the next CR
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+)
+
+// NetworkPolicySpec defines the NetworkPolicies of the receiver pods.
+// The NetworkPolicies are deleted when they are not enabled.
+type NetworkPolicySpec struct {
+	// Enabled creates the NetworkPolicies
+	Enabled bool `json:"enabled,omitempty"`
+	// From are the clients allowed to send metering data to the receiver.
+	// When it is empty, the pods of the CR and operator namespaces and the OpenShift router of a Route are allowed,
+	// or all clients when the receiver is exposed with an Ingress or a NodePort or LoadBalancer Service.
+	From []networkingv1.NetworkPolicyPeer `json:"from,omitempty"`
+	// MongoDBTo are the destinations allowed for the MongoDB connections.
+	// When it is empty, the MongoDB ports are allowed to the MongoDB hosts if they are IP addresses
+	// or Services of the CR namespace, and to any destination otherwise.
+	MongoDBTo []networkingv1.NetworkPolicyPeer `json:"mongoDBTo,omitempty"`
+}
+
+// ServiceSpec defines the receiver Service
+type ServiceSpec struct {
+	// Type is ClusterIP, NodePort or LoadBalancer
+	Type corev1.ServiceType `json:"type,omitempty"`
+	// Port is the port of the Service. The receiver listens on port 5000.
+	Port int32 `json:"port,omitempty"`
+	// NodePort is the node port of a NodePort or LoadBalancer Service.
+	// Kubernetes allocates a node port when it is not set.
+	NodePort int32 `json:"nodePort,omitempty"`
+	// Annotations are added to the annotations of the Service, for example to configure a cloud load balancer
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// LoadBalancerSourceRanges are the client CIDRs allowed by a LoadBalancer Service
+	LoadBalancerSourceRanges []string `json:"loadBalancerSourceRanges,omitempty"`
+	// ExternalTrafficPolicy is Cluster or Local for a NodePort or LoadBalancer Service
+	ExternalTrafficPolicy corev1.ServiceExternalTrafficPolicyType `json:"externalTrafficPolicy,omitempty"`
+}
+
+// ExposureType is the kind of object that exposes the receiver outside the cluster
+type ExposureType string
+
+const (
+	// ExposureTypeNone does not expose the receiver
+	ExposureTypeNone ExposureType = "None"
+	// ExposureTypeRoute exposes the receiver with an OpenShift Route
+	ExposureTypeRoute ExposureType = "Route"
+)
+
+// RouteTermination is the TLS termination of the receiver Route
+type RouteTermination string
+
+const (
+	// RouteTerminationPassthrough sends the TLS connection to the receiver as is
+	RouteTerminationPassthrough RouteTermination = "passthrough"
+	// RouteTerminationReencrypt terminates TLS at the router and opens a new TLS connection to the receiver
+	RouteTerminationReencrypt RouteTermination = "reencrypt"
+)
+
+// ExposureSpec defines how the receiver is exposed outside the cluster.
+// The Route is deleted when the type is not Route.
+type ExposureSpec struct {
+	// Type is None or Route
+	Type ExposureType `json:"type,omitempty"`
+	// Route are the settings of the Route when the type is Route
+	Route RouteSpec `json:"route,omitempty"`
+}
+
+// RouteSpec defines the OpenShift Route of the receiver Service
+type RouteSpec struct {
+	// Host is the host name of the Route. OpenShift generates a host name when it is empty.
+	Host string `json:"host,omitempty"`
+	// Termination is passthrough or reencrypt.
+	// With reencrypt, the router checks the receiver certificate with the CA in icp-metering-receiver-secret.
+	Termination RouteTermination `json:"termination,omitempty"`
+}
+
+// IngressSpec defines the Ingress of the receiver Service.
+// The Ingress is deleted when it is not enabled.
+type IngressSpec struct {
+	// Enabled creates the Ingress
+	Enabled bool `json:"enabled,omitempty"`
+	// Host is the host name the Ingress accepts requests for. All hosts are accepted when it is empty.
+	Host string `json:"host,omitempty"`
+	// Path is the path that is routed to the receiver
+	Path string `json:"path,omitempty"`
+	// Class is the ingress class of the Ingress controller that serves the Ingress
+	Class string `json:"class,omitempty"`
+	// Annotations are added to the annotations of the Ingress
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// TLSSecretName is the secret with the certificate the Ingress controller uses for the host
+	TLSSecretName string `json:"tlsSecretName,omitempty"`
+}
+
+// LogLevel is the level of the messages that are logged
+type LogLevel string
+
+// Log levels of the receiver, from the most to the least verbose
+const (
+	LogLevelTrace LogLevel = "trace"
+	LogLevelDebug LogLevel = "debug"
+	LogLevelInfo  LogLevel = "info"
+	LogLevelWarn  LogLevel = "warn"
+	LogLevelError LogLevel = "error"
+	LogLevelFatal LogLevel = "fatal"
+)
+
+// LoggingSpec defines the log levels of the receiver.
+// The operator renders them in the metering-logging-configuration ConfigMap.
+type LoggingSpec struct {
+	// Level is the log level of the receiver
+	Level LogLevel `json:"level,omitempty"`
+	// Modules are the log levels of single modules of the receiver, by module name
+	Modules map[string]LogLevel `json:"modules,omitempty"`
+	// VerboseInit logs the details of the checks run by the init container
+	VerboseInit *bool `json:"verboseInit,omitempty"`
+}
+
+// ComponentsSpec defines the data manager components run in the receiver pods.
+// The receiver is enabled unless it is disabled, the other components are disabled unless they are enabled.
+// Some components are only available in some versions, see SupportedComponentReleases.
+type ComponentsSpec struct {
+	// Receiver accepts the metering data sent by the managed clusters
+	Receiver ComponentSpec `json:"receiver,omitempty"`
+	// Sender sends the metering data to another hub
+	Sender ComponentSpec `json:"sender,omitempty"`
+	// StorageReader reads the metering data from the storage
+	StorageReader ComponentSpec `json:"storageReader,omitempty"`
+	// Reporter generates the metering reports
+	Reporter ComponentSpec `json:"reporter,omitempty"`
+	// Purger deletes the metering data that is older than the retention window
+	Purger PurgerSpec `json:"purger,omitempty"`
+	// Preaggregator aggregates the metering data before it is stored
+	Preaggregator ComponentSpec `json:"preaggregator,omitempty"`
+	// Metrics exposes the metrics of the data manager
+	Metrics ComponentSpec `json:"metrics,omitempty"`
+	// SelfmeterPurger deletes the self-metering data
+	SelfmeterPurger ComponentSpec `json:"selfmeterPurger,omitempty"`
+	// API serves the metering API
+	API ComponentSpec `json:"api,omitempty"`
+}
+
+// ComponentSpec defines a data manager component
+type ComponentSpec struct {
+	// Enabled runs the component
+	Enabled *bool `json:"enabled,omitempty"`
+}
+
+// PurgerSpec defines the purger component
+type PurgerSpec struct {
+	ComponentSpec `json:",inline"`
+	// RetentionDays is the number of days the metering data is kept.
+	// The data manager default is used when it is not set.
+	RetentionDays *int32 `json:"retentionDays,omitempty"`
+}
+
+// IsEnabled returns whether the component runs, or defaultValue when Enabled is not set
+func (c *ComponentSpec) IsEnabled(defaultValue bool) bool {
+	if c.Enabled == nil {
+		return defaultValue
+	}
+	return *c.Enabled
+}
+
+// PodDisruptionBudgetSpec defines the PodDisruptionBudget of the receiver pods.
+// Only one of MinAvailable and MaxUnavailable can be set.
+type PodDisruptionBudgetSpec struct {
+	// MinAvailable is the number or percentage of receiver pods that must stay available
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+	// MaxUnavailable is the number or percentage of receiver pods that can be unavailable
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// ResourcesSpec defines the resources of the receiver containers.
+// A limit or request that is set replaces the default value for that resource,
+// the other default values are kept.
+type ResourcesSpec struct {
+	// Receiver are the resources of the receiver container
+	Receiver corev1.ResourceRequirements `json:"receiver,omitempty"`
+	// Init are the resources of the init and secret-check containers
+	Init corev1.ResourceRequirements `json:"init,omitempty"`
+}
+
+// AutoscalingSpec defines the HorizontalPodAutoscaler of the receiver Deployment
+type AutoscalingSpec struct {
+	// MinReplicas is the lower limit for the number of pods
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+	// MaxReplicas is the upper limit for the number of pods
+	MaxReplicas int32 `json:"maxReplicas"`
+	// TargetCPUUtilizationPercentage is the target average CPU usage of the pods,
+	// as a percentage of the requested CPU
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+	// TargetMemoryUtilizationPercentage is the target average memory usage of the pods,
+	// as a percentage of the requested memory
+	TargetMemoryUtilizationPercentage *int32 `json:"targetMemoryUtilizationPercentage,omitempty"`
+}
+
+// TLSMode selects who provides the receiver serving certificate
+type TLSMode string
+
+const (
+	// TLSModeCertManager requests the certificate from cert-manager with the ClusterIssuer
+	TLSModeCertManager TLSMode = "certManager"
+	// TLSModeOperator generates a self-signed CA and certificate, and rotates them before they expire
+	TLSModeOperator TLSMode = "operator"
+	// TLSModeExternal uses the certificate stored in the secret by the user
+	TLSModeExternal TLSMode = "external"
+)
+
+// TLSSpec defines the receiver serving certificate.
+// In all the modes the certificate is stored in the icp-metering-receiver-secret secret,
+// with the ca.crt, tls.crt and tls.key keys.
+type TLSSpec struct {
+	// Mode is certManager, operator or external
+	Mode TLSMode `json:"mode,omitempty"`
+	// Certificate are the settings of the certificate issued by cert-manager or generated by the operator
+	Certificate TLSCertificateSpec `json:"certificate,omitempty"`
+}
+
+// IssuerKind is the kind of a cert-manager issuer
+type IssuerKind string
+
+const (
+	IssuerKindIssuer        IssuerKind = "Issuer"
+	IssuerKindClusterIssuer IssuerKind = "ClusterIssuer"
+)
+
+// IssuerReference is a cert-manager Issuer in the namespace of the CR, or a ClusterIssuer
+type IssuerReference struct {
+	// Name is the name of the issuer
+	Name string `json:"name"`
+	// Kind is Issuer or ClusterIssuer
+	Kind IssuerKind `json:"kind,omitempty"`
+}
+
+// PrivateKeyAlgorithm is the algorithm of the certificate private key
+type PrivateKeyAlgorithm string
+
+const (
+	PrivateKeyAlgorithmRSA   PrivateKeyAlgorithm = "RSA"
+	PrivateKeyAlgorithmECDSA PrivateKeyAlgorithm = "ECDSA"
+)
+
+// PrivateKeySpec defines the private key of the certificate
+type PrivateKeySpec struct {
+	// Algorithm is RSA or ECDSA
+	Algorithm PrivateKeyAlgorithm `json:"algorithm,omitempty"`
+	// Size is the key size in bits, 2048 to 8192 for RSA, and 256, 384 or 521 for ECDSA
+	Size int `json:"size,omitempty"`
+}
+
+// TLSCertificateSpec defines the receiver certificate.
+// The certificate is valid for the receiver Service names, and for the additional DNS names and IP addresses.
+type TLSCertificateSpec struct {
+	// IssuerRef is the cert-manager issuer of the certificate. The ClusterIssuer in clusterIssuer is used when it is not set.
+	IssuerRef *IssuerReference `json:"issuerRef,omitempty"`
+	// Duration is how long the certificate is valid.
+	// When it is not set, cert-manager uses the default of the issuer, and the operator generates certificates valid for a year.
+	Duration *metav1.Duration `json:"duration,omitempty"`
+	// RenewBefore is how long before it expires the certificate is renewed.
+	// When it is not set, cert-manager uses its default, and the operator renews certificates 30 days before they expire.
+	RenewBefore *metav1.Duration `json:"renewBefore,omitempty"`
+	// PrivateKey is the algorithm and size of the private key
+	PrivateKey PrivateKeySpec `json:"privateKey,omitempty"`
+	// DNSNames are added to the DNS names of the receiver Service, like the external host name managed clusters connect to
+	DNSNames []string `json:"dnsNames,omitempty"`
+	// IPAddresses are the IP addresses the certificate is valid for
+	IPAddresses []string `json:"ipAddresses,omitempty"`
+	// ClusterDomain is the DNS domain of the cluster, used in the fully qualified name of the receiver Service
+	ClusterDomain string `json:"clusterDomain,omitempty"`
+}
+
+// MongoDBReadPreference is the MongoDB member the receiver reads from
+type MongoDBReadPreference string
+
+const (
+	ReadPreferencePrimary            MongoDBReadPreference = "primary"
+	ReadPreferencePrimaryPreferred   MongoDBReadPreference = "primaryPreferred"
+	ReadPreferenceSecondary          MongoDBReadPreference = "secondary"
+	ReadPreferenceSecondaryPreferred MongoDBReadPreference = "secondaryPreferred"
+	ReadPreferenceNearest            MongoDBReadPreference = "nearest"
+)
+
+// MongoDBSpec defines the connection to MongoDB.
+// The connection is set with Host and Port, with the Hosts of a replica set, or with a connection URI.
+// Fields that are not set get the values of the MongoDB installed by Common Services.
+type MongoDBSpec struct {
+	// Host is the host name or IP address of MongoDB
+	Host string `json:"host,omitempty"`
+	// Port is the port of MongoDB, and of the Hosts that do not set a port
+	Port int32 `json:"port,omitempty"`
+	// Hosts are the members of a MongoDB replica set, as host or host:port.
+	// It cannot be set with Host.
+	Hosts []string `json:"hosts,omitempty"`
+	// ReplicaSet is the name of the MongoDB replica set
+	ReplicaSet string `json:"replicaSet,omitempty"`
+	// AuthSource is the database the credentials are checked against
+	AuthSource string `json:"authSource,omitempty"`
+	// ReadPreference is the member the receiver reads from:
+	// primary, primaryPreferred, secondary, secondaryPreferred or nearest
+	ReadPreference MongoDBReadPreference `json:"readPreference,omitempty"`
+	// URISecretRef is the secret key with a mongodb:// connection URI.
+	// It cannot be set with Host, Hosts, ReplicaSet, AuthSource or ReadPreference,
+	// which are set in the URI instead.
+	URISecretRef *corev1.SecretKeySelector `json:"uriSecretRef,omitempty"`
+	// Credentials are the username and password used to connect to MongoDB.
+	// They are optional when URISecretRef is set.
+	Credentials MongoDBCredentials `json:"credentials,omitempty"`
+	// TLS are the certificates used to connect to MongoDB
+	TLS MongoDBTLS `json:"tls,omitempty"`
+}
+
+// MongoDBEndpoint is a MongoDB host and port
+// +k8s:deepcopy-gen=false
+type MongoDBEndpoint struct {
+	Host string
+	Port int32
+}
+
+// Endpoints returns the hosts and ports of Host or Hosts.
+// It returns nil when the connection is set with URISecretRef.
+func (m *MongoDBSpec) Endpoints() []MongoDBEndpoint {
+	if m.URISecretRef != nil {
+		return nil
+	}
+	if len(m.Hosts) == 0 {
+		return []MongoDBEndpoint{{Host: m.Host, Port: m.Port}}
+	}
+	endpoints := make([]MongoDBEndpoint, 0, len(m.Hosts))
+	for _, hostPort := range m.Hosts {
+		host, port, err := splitMongoDBHost(hostPort)
+		if err != nil {
+			// the webhook rejects invalid hosts, keep the value as it is
+			host, port = hostPort, 0
+		}
+		if port == 0 {
+			port = m.Port
+		}
+		endpoints = append(endpoints, MongoDBEndpoint{Host: host, Port: port})
+	}
+	return endpoints
+}
+
+// splitMongoDBHost splits host, host:port, ipv6 or [ipv6]:port.
+// The port is 0 when it is not set.
+func splitMongoDBHost(hostPort string) (string, int32, error) {
+	if net.ParseIP(hostPort) != nil || !strings.Contains(hostPort, ":") {
+		return hostPort, 0, nil
+	}
+	host, portString, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return "", 0, err
+	}
+	port, err := strconv.ParseInt(portString, 10, 32)
+	if err != nil {
+		return "", 0, err
+	}
+	return host, int32(port), nil
+}
+
+// MongoDBCredentials defines the secret keys of the MongoDB username and password
+type MongoDBCredentials struct {
+	// SecretRef is the secret with the username and password
+	SecretRef corev1.LocalObjectReference `json:"secretRef,omitempty"`
+	// UsernameKey is the key of the username in the secret
+	UsernameKey string `json:"usernameKey,omitempty"`
+	// PasswordKey is the key of the password in the secret
+	PasswordKey string `json:"passwordKey,omitempty"`
+	// PasswordSecretRef is the secret with the password, when it is not in SecretRef
+	PasswordSecretRef *corev1.LocalObjectReference `json:"passwordSecretRef,omitempty"`
+}
+
+// MongoDBTLS defines the secrets with the certificates used to connect to MongoDB
+type MongoDBTLS struct {
+	// Enabled connects to MongoDB with TLS. It is true by default.
+	// The certificate secrets are not mounted when it is false.
+	Enabled *bool `json:"enabled,omitempty"`
+	// CASecretRef is the secret with the CA certificate of MongoDB
+	CASecretRef corev1.LocalObjectReference `json:"caSecretRef,omitempty"`
+	// ClientCertSecretRef is the secret with the client certificate and key
+	ClientCertSecretRef corev1.LocalObjectReference `json:"clientCertSecretRef,omitempty"`
+}
+
+// IsEnabled returns true when the connection to MongoDB uses TLS
+func (t *MongoDBTLS) IsEnabled() bool {
+	return t.Enabled == nil || *t.Enabled
+}
+
+// IsSet returns true when the credentials secret is set
+func (c *MongoDBCredentials) IsSet() bool {
+	return c.SecretRef.Name != ""
+}
+
+// UsernameSecretName returns the name of the secret with the MongoDB username
+func (c *MongoDBCredentials) UsernameSecretName() string {
+	return c.SecretRef.Name
+}
+
+// PasswordSecretName returns the name of the secret with the MongoDB password
+func (c *MongoDBCredentials) PasswordSecretName() string {
+	if c.PasswordSecretRef != nil {
+		return c.PasswordSecretRef.Name
+	}
+	return c.SecretRef.Name
+}
+
+// MeteringStatus defines the observed state of each Metering service
+type MeteringStatus struct {
+	// Phase is a one-word summary of the Conditions
+	Phase MeteringPhase `json:"phase,omitempty"`
+	// ObservedGeneration is the most recent generation of the CR processed by the operator
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions describe the state of the Deployment, Service and Certificate managed for the CR
+	Conditions []MeteringCondition `json:"conditions,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// MeteringReceiver is the Schema for the meteringreceivers API
+// +kubebuilder:subresource:status
+// +kubebuilder:storageversion
+// +kubebuilder:resource:path=meteringreceivers,scope=Namespaced
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type MeteringReceiver struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MeteringReceiverSpec `json:"spec,omitempty"`
+	Status MeteringStatus       `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// MeteringReceiverList contains a list of MeteringReceiver
+type MeteringReceiverList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MeteringReceiver `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MeteringReceiver{}, &MeteringReceiverList{})
+}
@@ -0,0 +1,771 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package v1beta1
+
+import (
+	"net"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// SupportedVersions are the major.minor releases of the receiver that can be set in spec.version
+var SupportedVersions = []string{"3.5", "3.6", "3.7"}
+
+// SupportedComponentReleases are the major.minor releases of the receiver that have the component,
+// by the json name of the component in spec.components. The receiver is in all releases.
+var SupportedComponentReleases = map[string][]string{
+	"sender":          {"3.5", "3.6", "3.7"},
+	"storageReader":   {"3.5", "3.6", "3.7"},
+	"reporter":        {"3.5", "3.6", "3.7"},
+	"purger":          {"3.5", "3.6", "3.7"},
+	"preaggregator":   {"3.5", "3.6", "3.7"},
+	"metrics":         {"3.5", "3.6", "3.7"},
+	"selfmeterPurger": {"3.6", "3.7"},
+	"api":             {"3.5", "3.6", "3.7"},
+}
+
+// imageRegistryRegexp matches a registry host with an optional port and repository path,
+// for example "quay.io/opencloudio" or "registry.local:5000/ibmcom".
+var imageRegistryRegexp = regexp.MustCompile(`^[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?)*(?::[0-9]+)?` +
+	`(?:/[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*)*$`)
+
+// imageTagPostfixRegexp matches the characters allowed in an image tag
+var imageTagPostfixRegexp = regexp.MustCompile(`^[\w.-]+$`)
+
+// versionRegexp matches a major.minor.patch version and captures major.minor
+var versionRegexp = regexp.MustCompile(`^(\d+\.\d+)\.\d+$`)
+
+// an image tag can have 128 characters, keep some room for the tag the postfix is appended to
+const maxImageTagPostfixLength = 100
+
+var webhookLog = logf.Log.WithName("meteringreceiver_webhook")
+
+// SetupWebhookWithManager registers the MeteringReceiver webhooks with the webhook server of the manager
+func (r *MeteringReceiver) SetupWebhookWithManager(mgr manager.Manager) error {
+	return builder.WebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+var _ webhook.Defaulter = &MeteringReceiver{}
+
+// Default implements webhook.Defaulter, so the stored CR shows the configuration in effect
+func (r *MeteringReceiver) Default() {
+	webhookLog.Info("default", "Namespace", r.Namespace, "Name", r.Name)
+	r.Spec.SetDefaults()
+}
+
+var _ webhook.Validator = &MeteringReceiver{}
+
+// ValidateCreate implements webhook.Validator
+func (r *MeteringReceiver) ValidateCreate() error {
+	webhookLog.Info("validate create", "Namespace", r.Namespace, "Name", r.Name)
+	return r.validate()
+}
+
+// ValidateUpdate implements webhook.Validator.
+// An update that does not change the spec is always allowed, so that CRs created before
+// the webhook existed can still get their metadata updated.
+func (r *MeteringReceiver) ValidateUpdate(old runtime.Object) error {
+	webhookLog.Info("validate update", "Namespace", r.Namespace, "Name", r.Name)
+	if oldReceiver, ok := old.(*MeteringReceiver); ok && reflect.DeepEqual(oldReceiver.Spec, r.Spec) {
+		return nil
+	}
+	return r.validate()
+}
+
+// ValidateDelete implements webhook.Validator
+func (r *MeteringReceiver) ValidateDelete() error {
+	return nil
+}
+
+// validate returns an Invalid error listing every problem found in the spec
+func (r *MeteringReceiver) validate() error {
+	allErrs := r.Spec.validate(field.NewPath("spec"))
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(schema.GroupKind{Group: SchemeGroupVersion.Group, Kind: "MeteringReceiver"}, r.Name, allErrs)
+}
+
+func (s *MeteringReceiverSpec) validate(fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	versionErrs := validateVersion(s.Version, fldPath.Child("version"))
+	allErrs = append(allErrs, versionErrs...)
+	if len(versionErrs) == 0 {
+		allErrs = append(allErrs, s.Components.validate(s.Version, fldPath.Child("components"))...)
+	}
+
+	if s.ImageRegistry != "" && !imageRegistryRegexp.MatchString(s.ImageRegistry) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("imageRegistry"), s.ImageRegistry,
+			"must be a registry host with an optional port and path, for example quay.io/opencloudio"))
+	}
+
+	if s.ImageTagPostfix != "" {
+		if !imageTagPostfixRegexp.MatchString(s.ImageTagPostfix) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("imageTagPostfix"), s.ImageTagPostfix,
+				"must only contain letters, digits, '_', '.' and '-'"))
+		} else if len(s.ImageTagPostfix) > maxImageTagPostfixLength {
+			allErrs = append(allErrs, field.TooLong(fldPath.Child("imageTagPostfix"), s.ImageTagPostfix, maxImageTagPostfixLength))
+		}
+	}
+
+	if s.ClusterIssuer != "" {
+		allErrs = append(allErrs, validateObjectName(s.ClusterIssuer, fldPath.Child("clusterIssuer"))...)
+	}
+
+	allErrs = append(allErrs, s.TLS.validate(fldPath.Child("tls"))...)
+	allErrs = append(allErrs, s.Logging.validate(fldPath.Child("logging"))...)
+	allErrs = append(allErrs, s.MongoDB.validate(fldPath.Child("mongodb"))...)
+
+	if s.Replicas != nil {
+		allErrs = append(allErrs, apivalidation.ValidateNonnegativeField(int64(*s.Replicas), fldPath.Child("replicas"))...)
+	}
+	if s.Autoscaling != nil {
+		allErrs = append(allErrs, s.Autoscaling.validate(fldPath.Child("autoscaling"))...)
+	}
+	if s.PodDisruptionBudget != nil {
+		allErrs = append(allErrs, s.PodDisruptionBudget.validate(fldPath.Child("podDisruptionBudget"))...)
+	}
+	if s.Resources != nil {
+		allErrs = append(allErrs, validateResourceRequirements(&s.Resources.Receiver, fldPath.Child("resources", "receiver"))...)
+		allErrs = append(allErrs, validateResourceRequirements(&s.Resources.Init, fldPath.Child("resources", "init"))...)
+	}
+
+	allErrs = append(allErrs, metav1validation.ValidateLabels(s.NodeSelector, fldPath.Child("nodeSelector"))...)
+	for i := range s.Tolerations {
+		allErrs = append(allErrs, validateToleration(&s.Tolerations[i], fldPath.Child("tolerations").Index(i))...)
+	}
+	for i := range s.TopologySpreadConstraints {
+		allErrs = append(allErrs, validateTopologySpreadConstraint(&s.TopologySpreadConstraints[i],
+			fldPath.Child("topologySpreadConstraints").Index(i))...)
+	}
+	if s.PriorityClassName != "" {
+		allErrs = append(allErrs, validateObjectName(s.PriorityClassName, fldPath.Child("priorityClassName"))...)
+	}
+	allErrs = append(allErrs, s.Service.validate(fldPath.Child("service"))...)
+	if s.Ingress != nil {
+		allErrs = append(allErrs, s.Ingress.validate(fldPath.Child("ingress"))...)
+	}
+	if s.Exposure != nil {
+		allErrs = append(allErrs, s.Exposure.validate(fldPath.Child("exposure"))...)
+	}
+	if s.NetworkPolicy != nil {
+		allErrs = append(allErrs, s.NetworkPolicy.validate(fldPath.Child("networkPolicy"))...)
+	}
+	if s.DeletionPolicy != DeletionPolicyDelete && s.DeletionPolicy != DeletionPolicyRetain {
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("deletionPolicy"), s.DeletionPolicy,
+			[]string{string(DeletionPolicyDelete), string(DeletionPolicyRetain)}))
+	}
+	return allErrs
+}
+
+func (n *NetworkPolicySpec) validate(fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for i := range n.From {
+		allErrs = append(allErrs, validateNetworkPolicyPeer(&n.From[i], fldPath.Child("from").Index(i))...)
+	}
+	for i := range n.MongoDBTo {
+		allErrs = append(allErrs, validateNetworkPolicyPeer(&n.MongoDBTo[i], fldPath.Child("mongoDBTo").Index(i))...)
+	}
+	return allErrs
+}
+
+// validateNetworkPolicyPeer checks that a peer has either selectors or an IP block, and that they are valid
+func validateNetworkPolicyPeer(peer *networkingv1.NetworkPolicyPeer, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if peer.IPBlock != nil {
+		if peer.PodSelector != nil || peer.NamespaceSelector != nil {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("ipBlock"),
+				"may not be set together with podSelector or namespaceSelector"))
+		}
+		ipBlockPath := fldPath.Child("ipBlock")
+		_, cidr, err := net.ParseCIDR(peer.IPBlock.CIDR)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(ipBlockPath.Child("cidr"), peer.IPBlock.CIDR, "must be a CIDR, for example 10.0.0.0/8"))
+		}
+		for i, except := range peer.IPBlock.Except {
+			_, exceptCIDR, err := net.ParseCIDR(except)
+			if err != nil {
+				allErrs = append(allErrs, field.Invalid(ipBlockPath.Child("except").Index(i), except, "must be a CIDR, for example 10.0.0.0/8"))
+			} else if cidr != nil && !cidr.Contains(exceptCIDR.IP) {
+				allErrs = append(allErrs, field.Invalid(ipBlockPath.Child("except").Index(i), except, "must be inside the cidr"))
+			}
+		}
+		return allErrs
+	}
+
+	if peer.PodSelector == nil && peer.NamespaceSelector == nil {
+		return field.ErrorList{field.Required(fldPath, "podSelector, namespaceSelector or ipBlock is required")}
+	}
+	if peer.PodSelector != nil {
+		allErrs = append(allErrs, metav1validation.ValidateLabelSelector(peer.PodSelector, fldPath.Child("podSelector"))...)
+	}
+	if peer.NamespaceSelector != nil {
+		allErrs = append(allErrs, metav1validation.ValidateLabelSelector(peer.NamespaceSelector, fldPath.Child("namespaceSelector"))...)
+	}
+	return allErrs
+}
+
+func (e *ExposureSpec) validate(fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	switch e.Type {
+	case ExposureTypeNone:
+	case ExposureTypeRoute:
+		routePath := fldPath.Child("route")
+		if e.Route.Host != "" {
+			for _, msg := range validation.IsDNS1123Subdomain(e.Route.Host) {
+				allErrs = append(allErrs, field.Invalid(routePath.Child("host"), e.Route.Host, msg))
+			}
+		}
+		switch e.Route.Termination {
+		case RouteTerminationPassthrough, RouteTerminationReencrypt:
+		default:
+			allErrs = append(allErrs, field.NotSupported(routePath.Child("termination"), e.Route.Termination,
+				[]string{string(RouteTerminationPassthrough), string(RouteTerminationReencrypt)}))
+		}
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("type"), e.Type,
+			[]string{string(ExposureTypeNone), string(ExposureTypeRoute)}))
+	}
+	return allErrs
+}
+
+func (svc *ServiceSpec) validate(fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	hasNodePorts := false
+	switch svc.Type {
+	case corev1.ServiceTypeClusterIP:
+	case corev1.ServiceTypeNodePort, corev1.ServiceTypeLoadBalancer:
+		hasNodePorts = true
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("type"), svc.Type,
+			[]string{string(corev1.ServiceTypeClusterIP), string(corev1.ServiceTypeNodePort), string(corev1.ServiceTypeLoadBalancer)}))
+	}
+
+	for _, msg := range validation.IsValidPortNum(int(svc.Port)) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("port"), svc.Port, msg))
+	}
+
+	if svc.NodePort != 0 {
+		if !hasNodePorts {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("nodePort"), "may not be set when the type is "+string(svc.Type)))
+		}
+		for _, msg := range validation.IsValidPortNum(int(svc.NodePort)) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("nodePort"), svc.NodePort, msg))
+		}
+	}
+
+	allErrs = append(allErrs, apivalidation.ValidateAnnotations(svc.Annotations, fldPath.Child("annotations"))...)
+
+	if len(svc.LoadBalancerSourceRanges) > 0 && svc.Type != corev1.ServiceTypeLoadBalancer {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("loadBalancerSourceRanges"),
+			"may only be set when the type is "+string(corev1.ServiceTypeLoadBalancer)))
+	}
+	for i, sourceRange := range svc.LoadBalancerSourceRanges {
+		if _, _, err := net.ParseCIDR(strings.TrimSpace(sourceRange)); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("loadBalancerSourceRanges").Index(i), sourceRange,
+				"must be a CIDR, for example 10.0.0.0/8"))
+		}
+	}
+
+	switch svc.ExternalTrafficPolicy {
+	case "":
+	case corev1.ServiceExternalTrafficPolicyTypeCluster, corev1.ServiceExternalTrafficPolicyTypeLocal:
+		if !hasNodePorts {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("externalTrafficPolicy"),
+				"may not be set when the type is "+string(svc.Type)))
+		}
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("externalTrafficPolicy"), svc.ExternalTrafficPolicy,
+			[]string{string(corev1.ServiceExternalTrafficPolicyTypeCluster), string(corev1.ServiceExternalTrafficPolicyTypeLocal)}))
+	}
+	return allErrs
+}
+
+func (i *IngressSpec) validate(fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if i.Host != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(strings.TrimPrefix(i.Host, "*.")) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("host"), i.Host, msg))
+		}
+	}
+	if !strings.HasPrefix(i.Path, "/") {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("path"), i.Path, "must be an absolute path"))
+	}
+	if i.Class == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("class"), ""))
+	} else {
+		for _, msg := range validation.IsQualifiedName(i.Class) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("class"), i.Class, msg))
+		}
+	}
+	allErrs = append(allErrs, apivalidation.ValidateAnnotations(i.Annotations, fldPath.Child("annotations"))...)
+	if i.TLSSecretName != "" {
+		allErrs = append(allErrs, validateObjectName(i.TLSSecretName, fldPath.Child("tlsSecretName"))...)
+	}
+	return allErrs
+}
+
+// validateToleration checks the key, operator and effect of a toleration
+func validateToleration(toleration *corev1.Toleration, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if toleration.Key != "" {
+		allErrs = append(allErrs, metav1validation.ValidateLabelName(toleration.Key, fldPath.Child("key"))...)
+	}
+
+	switch toleration.Operator {
+	case corev1.TolerationOpEqual, "":
+		if toleration.Key == "" {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("operator"), toleration.Operator,
+				"must be Exists when the key is empty"))
+		}
+	case corev1.TolerationOpExists:
+		if toleration.Value != "" {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("value"), toleration.Value,
+				"must be empty when the operator is Exists"))
+		}
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("operator"), toleration.Operator,
+			[]string{string(corev1.TolerationOpEqual), string(corev1.TolerationOpExists)}))
+	}
+
+	switch toleration.Effect {
+	case "", corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("effect"), toleration.Effect,
+			[]string{string(corev1.TaintEffectNoSchedule), string(corev1.TaintEffectPreferNoSchedule),
+				string(corev1.TaintEffectNoExecute)}))
+	}
+	return allErrs
+}
+
+// validateTopologySpreadConstraint checks the skew, topology key and unsatisfiable action of a constraint
+func validateTopologySpreadConstraint(constraint *corev1.TopologySpreadConstraint, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if constraint.MaxSkew < 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("maxSkew"), constraint.MaxSkew, "must be greater than 0"))
+	}
+	if constraint.TopologyKey == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("topologyKey"), ""))
+	} else {
+		allErrs = append(allErrs, metav1validation.ValidateLabelName(constraint.TopologyKey, fldPath.Child("topologyKey"))...)
+	}
+	switch constraint.WhenUnsatisfiable {
+	case corev1.DoNotSchedule, corev1.ScheduleAnyway:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("whenUnsatisfiable"), constraint.WhenUnsatisfiable,
+			[]string{string(corev1.DoNotSchedule), string(corev1.ScheduleAnyway)}))
+	}
+	return allErrs
+}
+
+// validateResourceRequirements checks that the quantities are not negative
+// and that a request is not greater than the limit of the same resource
+func validateResourceRequirements(requirements *corev1.ResourceRequirements, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for name, quantity := range requirements.Limits {
+		if quantity.Sign() < 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("limits").Key(string(name)), quantity.String(),
+				"must be greater than or equal to 0"))
+		}
+	}
+	for name, quantity := range requirements.Requests {
+		fld := fldPath.Child("requests").Key(string(name))
+		if quantity.Sign() < 0 {
+			allErrs = append(allErrs, field.Invalid(fld, quantity.String(), "must be greater than or equal to 0"))
+		}
+		if limit, ok := requirements.Limits[name]; ok && quantity.Cmp(limit) > 0 {
+			allErrs = append(allErrs, field.Invalid(fld, quantity.String(), "must be less than or equal to the "+string(name)+" limit"))
+		}
+	}
+	return allErrs
+}
+
+func (l *LoggingSpec) validate(fldPath *field.Path) field.ErrorList {
+	allErrs := validateLogLevel(l.Level, fldPath.Child("level"))
+	for module, level := range l.Modules {
+		if module == "" {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("modules"), module, "module names must not be empty"))
+		}
+		allErrs = append(allErrs, validateLogLevel(level, fldPath.Child("modules").Key(module))...)
+	}
+	return allErrs
+}
+
+// validateLogLevel checks that level is one of the log levels of the receiver
+func validateLogLevel(level LogLevel, fldPath *field.Path) field.ErrorList {
+	switch level {
+	case LogLevelTrace, LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError, LogLevelFatal:
+		return nil
+	}
+	return field.ErrorList{field.NotSupported(fldPath, level, []string{string(LogLevelTrace), string(LogLevelDebug),
+		string(LogLevelInfo), string(LogLevelWarn), string(LogLevelError), string(LogLevelFatal)})}
+}
+
+// validate checks that the enabled components are in the release of version
+func (c *ComponentsSpec) validate(version string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	release := versionRegexp.FindStringSubmatch(version)[1]
+
+	optionalComponents := []struct {
+		name    string
+		enabled bool
+	}{
+		{"sender", c.Sender.IsEnabled(false)},
+		{"storageReader", c.StorageReader.IsEnabled(false)},
+		{"reporter", c.Reporter.IsEnabled(false)},
+		{"purger", c.Purger.IsEnabled(false)},
+		{"preaggregator", c.Preaggregator.IsEnabled(false)},
+		{"metrics", c.Metrics.IsEnabled(false)},
+		{"selfmeterPurger", c.SelfmeterPurger.IsEnabled(false)},
+		{"api", c.API.IsEnabled(false)},
+	}
+	for _, component := range optionalComponents {
+		if !component.enabled {
+			continue
+		}
+		supported := false
+		for _, supportedRelease := range SupportedComponentReleases[component.name] {
+			if supportedRelease == release {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child(component.name, "enabled"),
+				"the component is not in release "+release+", it is in releases "+
+					strings.Join(SupportedComponentReleases[component.name], ", ")))
+		}
+	}
+
+	if c.Purger.RetentionDays != nil && *c.Purger.RetentionDays < 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("purger", "retentionDays"), *c.Purger.RetentionDays,
+			"must be greater than 0"))
+	}
+	return allErrs
+}
+
+func (p *PodDisruptionBudgetSpec) validate(fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if p.MinAvailable != nil && p.MaxUnavailable != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath, "", "minAvailable and maxUnavailable cannot both be set"))
+	}
+	if p.MinAvailable != nil {
+		allErrs = append(allErrs, validateIntOrPercent(p.MinAvailable, fldPath.Child("minAvailable"))...)
+	}
+	if p.MaxUnavailable != nil {
+		allErrs = append(allErrs, validateIntOrPercent(p.MaxUnavailable, fldPath.Child("maxUnavailable"))...)
+	}
+	return allErrs
+}
+
+// validateIntOrPercent checks that value is a non-negative integer or a percentage between 0% and 100%
+func validateIntOrPercent(value *intstr.IntOrString, fldPath *field.Path) field.ErrorList {
+	if value.Type == intstr.Int {
+		return apivalidation.ValidateNonnegativeField(int64(value.IntValue()), fldPath)
+	}
+	percent, err := strconv.Atoi(strings.TrimSuffix(value.StrVal, "%"))
+	if err != nil || !strings.HasSuffix(value.StrVal, "%") || percent < 0 || percent > 100 {
+		return field.ErrorList{field.Invalid(fldPath, value.StrVal, "must be an integer or a percentage between 0% and 100%")}
+	}
+	return nil
+}
+
+func (a *AutoscalingSpec) validate(fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	var minReplicas int32 = 1
+	if a.MinReplicas != nil {
+		minReplicas = *a.MinReplicas
+		if minReplicas < 1 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("minReplicas"), minReplicas, "must be greater than or equal to 1"))
+		}
+	}
+	if a.MaxReplicas < minReplicas {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("maxReplicas"), a.MaxReplicas,
+			"must be greater than or equal to minReplicas"))
+	}
+	if a.TargetCPUUtilizationPercentage != nil && *a.TargetCPUUtilizationPercentage < 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("targetCPUUtilizationPercentage"),
+			*a.TargetCPUUtilizationPercentage, "must be greater than 0"))
+	}
+	if a.TargetMemoryUtilizationPercentage != nil && *a.TargetMemoryUtilizationPercentage < 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("targetMemoryUtilizationPercentage"),
+			*a.TargetMemoryUtilizationPercentage, "must be greater than 0"))
+	}
+	return allErrs
+}
+
+func (t *TLSSpec) validate(fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	switch t.Mode {
+	case TLSModeCertManager, TLSModeOperator, TLSModeExternal:
+	case "":
+		allErrs = append(allErrs, field.Required(fldPath.Child("mode"), ""))
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("mode"), t.Mode,
+			[]string{string(TLSModeCertManager), string(TLSModeOperator), string(TLSModeExternal)}))
+	}
+	allErrs = append(allErrs, t.Certificate.validate(fldPath.Child("certificate"))...)
+	return allErrs
+}
+
+// the limits of cert-manager
+const (
+	minCertificateDuration    = time.Hour
+	minCertificateRenewBefore = 5 * time.Minute
+	minRSAKeySize             = 2048
+	maxRSAKeySize             = 8192
+)
+
+func (c *TLSCertificateSpec) validate(fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if c.IssuerRef != nil {
+		issuerPath := fldPath.Child("issuerRef")
+		if c.IssuerRef.Name == "" {
+			allErrs = append(allErrs, field.Required(issuerPath.Child("name"), ""))
+		}
+		if c.IssuerRef.Kind != IssuerKindIssuer && c.IssuerRef.Kind != IssuerKindClusterIssuer {
+			allErrs = append(allErrs, field.NotSupported(issuerPath.Child("kind"), c.IssuerRef.Kind,
+				[]string{string(IssuerKindIssuer), string(IssuerKindClusterIssuer)}))
+		}
+	}
+
+	if c.Duration != nil && c.Duration.Duration < minCertificateDuration {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("duration"), c.Duration.Duration.String(),
+			"must be at least "+minCertificateDuration.String()))
+	}
+	if c.RenewBefore != nil {
+		if c.RenewBefore.Duration < minCertificateRenewBefore {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("renewBefore"), c.RenewBefore.Duration.String(),
+				"must be at least "+minCertificateRenewBefore.String()))
+		} else if c.Duration != nil && c.RenewBefore.Duration >= c.Duration.Duration {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("renewBefore"), c.RenewBefore.Duration.String(),
+				"must be less than duration"))
+		}
+	}
+
+	keyPath := fldPath.Child("privateKey")
+	switch c.PrivateKey.Algorithm {
+	case PrivateKeyAlgorithmRSA:
+		if c.PrivateKey.Size < minRSAKeySize || c.PrivateKey.Size > maxRSAKeySize {
+			allErrs = append(allErrs, field.Invalid(keyPath.Child("size"), c.PrivateKey.Size,
+				"must be between "+strconv.Itoa(minRSAKeySize)+" and "+strconv.Itoa(maxRSAKeySize)+" for RSA"))
+		}
+	case PrivateKeyAlgorithmECDSA:
+		if c.PrivateKey.Size != 256 && c.PrivateKey.Size != 384 && c.PrivateKey.Size != 521 {
+			allErrs = append(allErrs, field.NotSupported(keyPath.Child("size"), c.PrivateKey.Size,
+				[]string{"256", "384", "521"}))
+		}
+	default:
+		allErrs = append(allErrs, field.NotSupported(keyPath.Child("algorithm"), c.PrivateKey.Algorithm,
+			[]string{string(PrivateKeyAlgorithmRSA), string(PrivateKeyAlgorithmECDSA)}))
+	}
+
+	for i, name := range c.DNSNames {
+		for _, msg := range validation.IsDNS1123Subdomain(strings.TrimPrefix(name, "*.")) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("dnsNames").Index(i), name, msg))
+		}
+	}
+	for i, ip := range c.IPAddresses {
+		if net.ParseIP(ip) == nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("ipAddresses").Index(i), ip, "must be a valid IP address"))
+		}
+	}
+	for _, msg := range validation.IsDNS1123Subdomain(c.ClusterDomain) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("clusterDomain"), c.ClusterDomain, msg))
+	}
+	return allErrs
+}
+
+func (m *MongoDBSpec) validate(fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if m.URISecretRef != nil {
+		// the URI sets the hosts and the connection options
+		uriPath := fldPath.Child("uriSecretRef")
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"host", m.Host != ""},
+			{"hosts", len(m.Hosts) > 0},
+			{"replicaSet", m.ReplicaSet != ""},
+			{"authSource", m.AuthSource != ""},
+			{"readPreference", m.ReadPreference != ""},
+		} {
+			if f.set {
+				allErrs = append(allErrs, field.Forbidden(fldPath.Child(f.name),
+					"may not be set with "+uriPath.String()+", set it in the URI instead"))
+			}
+		}
+		allErrs = append(allErrs, validateObjectName(m.URISecretRef.Name, uriPath.Child("name"))...)
+		allErrs = append(allErrs, validateSecretKey(m.URISecretRef.Key, uriPath.Child("key"))...)
+	} else if len(m.Hosts) > 0 {
+		if m.Host != "" {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("host"), "may not be set with hosts"))
+		}
+		seen := map[string]bool{}
+		for i, hostPort := range m.Hosts {
+			idxPath := fldPath.Child("hosts").Index(i)
+			host, port, err := splitMongoDBHost(hostPort)
+			if err != nil {
+				allErrs = append(allErrs, field.Invalid(idxPath, hostPort, "must be host or host:port"))
+				continue
+			}
+			allErrs = append(allErrs, validateMongoDBHost(host, idxPath)...)
+			if port != 0 {
+				for _, msg := range validation.IsValidPortNum(int(port)) {
+					allErrs = append(allErrs, field.Invalid(idxPath, hostPort, msg))
+				}
+			}
+			if seen[hostPort] {
+				allErrs = append(allErrs, field.Duplicate(idxPath, hostPort))
+			}
+			seen[hostPort] = true
+		}
+	} else if m.Host == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("host"), "the MongoDB host, hosts or uriSecretRef is required"))
+	} else {
+		allErrs = append(allErrs, validateMongoDBHost(m.Host, fldPath.Child("host"))...)
+	}
+
+	for _, msg := range validation.IsValidPortNum(int(m.Port)) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("port"), m.Port, msg))
+	}
+
+	if m.ReplicaSet != "" && strings.ContainsAny(m.ReplicaSet, "/?&=# ") {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("replicaSet"), m.ReplicaSet,
+			"must not contain '/', '?', '&', '=', '#' or spaces"))
+	}
+	if m.AuthSource != "" && strings.ContainsAny(m.AuthSource, "/\\. \"$*<>:|?") {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("authSource"), m.AuthSource,
+			"must be a MongoDB database name"))
+	}
+	switch m.ReadPreference {
+	case "", ReadPreferencePrimary, ReadPreferencePrimaryPreferred, ReadPreferenceSecondary,
+		ReadPreferenceSecondaryPreferred, ReadPreferenceNearest:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("readPreference"), m.ReadPreference,
+			[]string{string(ReadPreferencePrimary), string(ReadPreferencePrimaryPreferred), string(ReadPreferenceSecondary),
+				string(ReadPreferenceSecondaryPreferred), string(ReadPreferenceNearest)}))
+	}
+
+	// the credentials can be in the URI
+	if m.URISecretRef == nil || m.Credentials.IsSet() {
+		allErrs = append(allErrs, m.Credentials.validate(fldPath.Child("credentials"))...)
+	}
+	allErrs = append(allErrs, m.TLS.validate(fldPath.Child("tls"))...)
+	return allErrs
+}
+
+// validateMongoDBHost checks that host is an IP address or a DNS name
+func validateMongoDBHost(host string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if net.ParseIP(host) == nil {
+		for _, msg := range validation.IsDNS1123Subdomain(host) {
+			allErrs = append(allErrs, field.Invalid(fldPath, host, msg))
+		}
+	}
+	return allErrs
+}
+
+func (c *MongoDBCredentials) validate(fldPath *field.Path) field.ErrorList {
+	allErrs := validateObjectName(c.SecretRef.Name, fldPath.Child("secretRef", "name"))
+	allErrs = append(allErrs, validateSecretKey(c.UsernameKey, fldPath.Child("usernameKey"))...)
+	allErrs = append(allErrs, validateSecretKey(c.PasswordKey, fldPath.Child("passwordKey"))...)
+	if c.PasswordSecretRef != nil {
+		allErrs = append(allErrs, validateObjectName(c.PasswordSecretRef.Name, fldPath.Child("passwordSecretRef", "name"))...)
+	}
+	return allErrs
+}
+
+func (t *MongoDBTLS) validate(fldPath *field.Path) field.ErrorList {
+	// the certificate secrets are not used without TLS
+	if !t.IsEnabled() {
+		return nil
+	}
+	allErrs := validateObjectName(t.CASecretRef.Name, fldPath.Child("caSecretRef", "name"))
+	allErrs = append(allErrs, validateObjectName(t.ClientCertSecretRef.Name, fldPath.Child("clientCertSecretRef", "name"))...)
+	return allErrs
+}
+
+// validateVersion checks that version is major.minor.patch and that major.minor is supported
+func validateVersion(version string, fldPath *field.Path) field.ErrorList {
+	if version == "" {
+		return field.ErrorList{field.Required(fldPath, "the receiver version is required")}
+	}
+	match := versionRegexp.FindStringSubmatch(version)
+	if match == nil {
+		return field.ErrorList{field.Invalid(fldPath, version, "must be a version like 3.7.0")}
+	}
+	for _, supported := range SupportedVersions {
+		if match[1] == supported {
+			return nil
+		}
+	}
+	return field.ErrorList{field.Invalid(fldPath, version,
+		"unsupported version, the supported releases are "+strings.Join(SupportedVersions, ", "))}
+}
+
+// validateObjectName checks that name is set and is a valid name for a Kubernetes object
+func validateObjectName(name string, fldPath *field.Path) field.ErrorList {
+	if name == "" {
+		return field.ErrorList{field.Required(fldPath, "")}
+	}
+	allErrs := field.ErrorList{}
+	for _, msg := range validation.IsDNS1123Subdomain(name) {
+		allErrs = append(allErrs, field.Invalid(fldPath, name, msg))
+	}
+	return allErrs
+}
+
+// validateSecretKey checks the key of a value in a secret
+func validateSecretKey(key string, fldPath *field.Path) field.ErrorList {
+	if key == "" {
+		return field.ErrorList{field.Required(fldPath, "")}
+	}
+	allErrs := field.ErrorList{}
+	for _, msg := range validation.IsConfigMapKey(key) {
+		allErrs = append(allErrs, field.Invalid(fldPath, key, msg))
+	}
+	return allErrs
+}
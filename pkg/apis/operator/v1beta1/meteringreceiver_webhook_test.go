@@ -0,0 +1,302 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package v1beta1
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// newValidReceiver returns a MeteringReceiver with the defaults set by the defaulting webhook
+func newValidReceiver() *MeteringReceiver {
+	r := &MeteringReceiver{ObjectMeta: metav1.ObjectMeta{Name: "receiver", Namespace: "metering"}}
+	r.Default()
+	return r
+}
+
+func TestValidate(t *testing.T) {
+	int32Ptr := func(i int32) *int32 { return &i }
+	boolPtr := func(b bool) *bool { return &b }
+	intOrStringPtr := func(v intstr.IntOrString) *intstr.IntOrString { return &v }
+
+	tests := []struct {
+		name   string
+		mutate func(s *MeteringReceiverSpec)
+		want   []string
+	}{
+		{
+			name:   "defaults",
+			mutate: func(s *MeteringReceiverSpec) {},
+		},
+		{
+			name:   "unsupported version",
+			mutate: func(s *MeteringReceiverSpec) { s.Version = "3.4.0" },
+			want:   []string{"spec.version"},
+		},
+		{
+			name:   "version is not major.minor.patch",
+			mutate: func(s *MeteringReceiverSpec) { s.Version = "latest" },
+			want:   []string{"spec.version"},
+		},
+		{
+			name: "component not in the release",
+			mutate: func(s *MeteringReceiverSpec) {
+				s.Version = "3.5.0"
+				s.Components.SelfmeterPurger.Enabled = boolPtr(true)
+			},
+			want: []string{"spec.components.selfmeterPurger.enabled"},
+		},
+		{
+			name:   "purger retention days",
+			mutate: func(s *MeteringReceiverSpec) { s.Components.Purger.RetentionDays = int32Ptr(0) },
+			want:   []string{"spec.components.purger.retentionDays"},
+		},
+		{
+			name:   "image registry with a scheme",
+			mutate: func(s *MeteringReceiverSpec) { s.ImageRegistry = "https://quay.io/opencloudio" },
+			want:   []string{"spec.imageRegistry"},
+		},
+		{
+			name:   "image tag postfix with a space",
+			mutate: func(s *MeteringReceiverSpec) { s.ImageTagPostfix = "-dev build" },
+			want:   []string{"spec.imageTagPostfix"},
+		},
+		{
+			name:   "image tag postfix too long",
+			mutate: func(s *MeteringReceiverSpec) { s.ImageTagPostfix = strings.Repeat("x", maxImageTagPostfixLength+1) },
+			want:   []string{"spec.imageTagPostfix"},
+		},
+		{
+			name:   "cluster issuer name",
+			mutate: func(s *MeteringReceiverSpec) { s.ClusterIssuer = "My_Issuer" },
+			want:   []string{"spec.clusterIssuer"},
+		},
+		{
+			name:   "TLS mode not set",
+			mutate: func(s *MeteringReceiverSpec) { s.TLS.Mode = "" },
+			want:   []string{"spec.tls.mode"},
+		},
+		{
+			name:   "unsupported TLS mode",
+			mutate: func(s *MeteringReceiverSpec) { s.TLS.Mode = "none" },
+			want:   []string{"spec.tls.mode"},
+		},
+		{
+			name: "certificate renewed after it expires",
+			mutate: func(s *MeteringReceiverSpec) {
+				s.TLS.Certificate.Duration = &metav1.Duration{Duration: 2 * minCertificateDuration}
+				s.TLS.Certificate.RenewBefore = &metav1.Duration{Duration: 3 * minCertificateDuration}
+			},
+			want: []string{"spec.tls.certificate.renewBefore"},
+		},
+		{
+			name:   "RSA key too small",
+			mutate: func(s *MeteringReceiverSpec) { s.TLS.Certificate.PrivateKey.Size = 1024 },
+			want:   []string{"spec.tls.certificate.privateKey.size"},
+		},
+		{
+			name:   "unsupported log level",
+			mutate: func(s *MeteringReceiverSpec) { s.Logging.Level = "verbose" },
+			want:   []string{"spec.logging.level"},
+		},
+		{
+			name:   "MongoDB host missing",
+			mutate: func(s *MeteringReceiverSpec) { s.MongoDB.Host = "" },
+			want:   []string{"spec.mongodb.host"},
+		},
+		{
+			name: "MongoDB host set with the URI",
+			mutate: func(s *MeteringReceiverSpec) {
+				s.MongoDB.URISecretRef = &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "mongodb-uri"},
+					Key:                  "uri",
+				}
+			},
+			want: []string{"spec.mongodb.host"},
+		},
+		{
+			name: "duplicate MongoDB hosts",
+			mutate: func(s *MeteringReceiverSpec) {
+				s.MongoDB.Host = ""
+				s.MongoDB.Hosts = []string{"mongodb-0:27017", "mongodb-0:27017"}
+			},
+			want: []string{"spec.mongodb.hosts[1]"},
+		},
+		{
+			name:   "MongoDB port",
+			mutate: func(s *MeteringReceiverSpec) { s.MongoDB.Port = 70000 },
+			want:   []string{"spec.mongodb.port"},
+		},
+		{
+			name:   "MongoDB password key",
+			mutate: func(s *MeteringReceiverSpec) { s.MongoDB.Credentials.PasswordKey = "pass word" },
+			want:   []string{"spec.mongodb.credentials.passwordKey"},
+		},
+		{
+			name:   "negative replicas",
+			mutate: func(s *MeteringReceiverSpec) { s.Replicas = int32Ptr(-1) },
+			want:   []string{"spec.replicas"},
+		},
+		{
+			name: "autoscaling max replicas less than min replicas",
+			mutate: func(s *MeteringReceiverSpec) {
+				s.Autoscaling = &AutoscalingSpec{MinReplicas: int32Ptr(3), MaxReplicas: 2}
+			},
+			want: []string{"spec.autoscaling.maxReplicas"},
+		},
+		{
+			name: "PodDisruptionBudget with minAvailable and maxUnavailable",
+			mutate: func(s *MeteringReceiverSpec) {
+				s.PodDisruptionBudget.MinAvailable = intOrStringPtr(intstr.FromInt(1))
+			},
+			want: []string{"spec.podDisruptionBudget"},
+		},
+		{
+			name: "PodDisruptionBudget percentage",
+			mutate: func(s *MeteringReceiverSpec) {
+				s.PodDisruptionBudget.MaxUnavailable = intOrStringPtr(intstr.FromString("150%"))
+			},
+			want: []string{"spec.podDisruptionBudget.maxUnavailable"},
+		},
+		{
+			name: "request greater than the limit",
+			mutate: func(s *MeteringReceiverSpec) {
+				s.Resources = &ResourcesSpec{
+					Receiver: corev1.ResourceRequirements{
+						Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("128Mi")},
+						Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+					},
+				}
+			},
+			want: []string{"spec.resources.receiver.requests[memory]"},
+		},
+		{
+			name: "toleration without key",
+			mutate: func(s *MeteringReceiverSpec) {
+				s.Tolerations = []corev1.Toleration{{Operator: corev1.TolerationOpEqual, Value: "metering"}}
+			},
+			want: []string{"spec.tolerations[0].operator"},
+		},
+		{
+			name:   "unsupported Service type",
+			mutate: func(s *MeteringReceiverSpec) { s.Service.Type = corev1.ServiceTypeExternalName },
+			want:   []string{"spec.service.type"},
+		},
+		{
+			name:   "node port on a ClusterIP Service",
+			mutate: func(s *MeteringReceiverSpec) { s.Service.NodePort = 30500 },
+			want:   []string{"spec.service.nodePort"},
+		},
+		{
+			name: "load balancer source ranges on a NodePort Service",
+			mutate: func(s *MeteringReceiverSpec) {
+				s.Service.Type = corev1.ServiceTypeNodePort
+				s.Service.LoadBalancerSourceRanges = []string{"10.0.0.0"}
+			},
+			want: []string{"spec.service.loadBalancerSourceRanges", "spec.service.loadBalancerSourceRanges[0]"},
+		},
+		{
+			name: "relative Ingress path",
+			mutate: func(s *MeteringReceiverSpec) {
+				s.Ingress = &IngressSpec{Path: "receiver"}
+				s.Ingress.SetDefaults()
+			},
+			want: []string{"spec.ingress.path"},
+		},
+		{
+			name:   "unsupported exposure type",
+			mutate: func(s *MeteringReceiverSpec) { s.Exposure = &ExposureSpec{Type: "Ingress"} },
+			want:   []string{"spec.exposure.type"},
+		},
+		{
+			name:   "unsupported deletion policy",
+			mutate: func(s *MeteringReceiverSpec) { s.DeletionPolicy = "Orphan" },
+			want:   []string{"spec.deletionPolicy"},
+		},
+		{
+			name: "every problem is reported",
+			mutate: func(s *MeteringReceiverSpec) {
+				s.Version = "3.4.0"
+				s.ImageRegistry = "https://quay.io/opencloudio"
+				s.ClusterIssuer = "My_Issuer"
+			},
+			want: []string{"spec.clusterIssuer", "spec.imageRegistry", "spec.version"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newValidReceiver()
+			tt.mutate(&r.Spec)
+
+			err := r.ValidateCreate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("ValidateCreate() error = %v", err)
+				}
+				return
+			}
+			if !apierrors.IsInvalid(err) {
+				t.Fatalf("ValidateCreate() error = %v, want an Invalid error", err)
+			}
+			if got := invalidFields(err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidateCreate() fields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateUpdate(t *testing.T) {
+	// a CR created before the webhook existed can still be updated when its spec does not change
+	old := newValidReceiver()
+	old.Spec.Version = "3.4.0"
+	r := old.DeepCopy()
+	r.Labels = map[string]string{"app": "receiver"}
+	if err := r.ValidateUpdate(old); err != nil {
+		t.Errorf("ValidateUpdate() with the same spec error = %v", err)
+	}
+
+	r.Spec.ImageRegistry = "https://quay.io/opencloudio"
+	if err := r.ValidateUpdate(old); !apierrors.IsInvalid(err) {
+		t.Errorf("ValidateUpdate() with a changed spec error = %v, want an Invalid error", err)
+	}
+}
+
+// invalidFields returns the sorted fields of the causes of an Invalid error
+func invalidFields(err error) []string {
+	status, ok := err.(apierrors.APIStatus)
+	if !ok || status.Status().Details == nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	fields := []string{}
+	for _, cause := range status.Status().Details.Causes {
+		if !seen[cause.Field] {
+			seen[cause.Field] = true
+			fields = append(fields, cause.Field)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
@@ -18,18 +18,26 @@ package meteringreceiver
 
 import (
 	"context"
-	"reflect"
+	"fmt"
+	"os"
+	"strconv"
 	"time"
 
-	operatorv1alpha1 "github.com/ibm/ibm-metering-receiver-operator/pkg/apis/operator/v1alpha1"
+	operatorv1beta1 "github.com/ibm/ibm-metering-receiver-operator/pkg/apis/operator/v1beta1"
 	res "github.com/ibm/ibm-metering-receiver-operator/pkg/resources"
-	certmgr "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha1"
+	"github.com/operator-framework/operator-sdk/pkg/k8sutil"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
 	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/extensions/v1beta1"
+	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -42,9 +50,12 @@ import (
 
 const meteringReceiverCrType = "meteringreceiver_cr"
 
-var commonVolumes = []corev1.Volume{}
+// set MAX_CONCURRENT_RECONCILES to reconcile several MeteringReceivers at the same time
+const maxConcurrentReconcilesEnvVar = "MAX_CONCURRENT_RECONCILES"
 
-var mongoDBEnvVars = []corev1.EnvVar{}
+// resourceRequeueDelay is how long to wait before checking the resources that were just created or updated again.
+// Their changes are watched, the requeue only makes sure the status is refreshed when no event comes.
+const resourceRequeueDelay = 5 * time.Second
 
 var log = logf.Log.WithName("controller_meteringreceiver")
 
@@ -56,26 +67,40 @@ var log = logf.Log.WithName("controller_meteringreceiver")
 // Add creates a new MeteringReceiver Controller and adds it to the Manager. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
 func Add(mgr manager.Manager) error {
-	return add(mgr, newReconciler(mgr))
+	apis, err := discoverAPIs(mgr.GetConfig())
+	if err != nil {
+		return err
+	}
+	return add(mgr, newReconciler(mgr, apis), apis)
 }
 
 // newReconciler returns a new reconcile.Reconciler
-func newReconciler(mgr manager.Manager) reconcile.Reconciler {
-	return &ReconcileMeteringReceiver{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+func newReconciler(mgr manager.Manager, apis availableAPIs) reconcile.Reconciler {
+	// the operator namespace is not known when the operator runs outside the cluster
+	operatorNamespace, err := k8sutil.GetOperatorNamespace()
+	if err != nil {
+		log.Info("The operator namespace is not allowed by the default NetworkPolicies", "error", err.Error())
+	}
+	return &ReconcileMeteringReceiver{client: mgr.GetClient(), scheme: mgr.GetScheme(),
+		recorder: mgr.GetEventRecorderFor("meteringreceiver-controller"), apis: apis, operatorNamespace: operatorNamespace}
 }
 
-// add adds a new Controller to mgr with r as the reconcile.Reconciler
-func add(mgr manager.Manager, r reconcile.Reconciler) error {
+// add adds a new Controller to mgr with r as the reconcile.Reconciler.
+// Secondary resources of optional APIs are only watched when apis shows they are available.
+func add(mgr manager.Manager, r reconcile.Reconciler, apis availableAPIs) error {
 	reqLogger := log.WithValues("func", "add")
 
 	// Create a new controller
-	c, err := controller.New("meteringreceiver-controller", mgr, controller.Options{Reconciler: r})
+	c, err := controller.New("meteringreceiver-controller", mgr, controller.Options{
+		Reconciler:              r,
+		MaxConcurrentReconciles: maxConcurrentReconciles(),
+	})
 	if err != nil {
 		return err
 	}
 
 	// Watch for changes to primary resource MeteringReceiver
-	err = c.Watch(&source.Kind{Type: &operatorv1alpha1.MeteringReceiver{}}, &handler.EnqueueRequestForObject{})
+	err = c.Watch(&source.Kind{Type: &operatorv1beta1.MeteringReceiver{}}, &handler.EnqueueRequestForObject{})
 	if err != nil {
 		return err
 	}
@@ -84,7 +109,7 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 	// Watch for changes to secondary resource Deployment and requeue the owner MeteringReceiver
 	err = c.Watch(&source.Kind{Type: &appsv1.Deployment{}}, &handler.EnqueueRequestForOwner{
 		IsController: true,
-		OwnerType:    &operatorv1alpha1.MeteringReceiver{},
+		OwnerType:    &operatorv1beta1.MeteringReceiver{},
 	})
 	if err != nil {
 		return err
@@ -93,21 +118,98 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 	// Watch for changes to secondary resource "Service" and requeue the owner MeteringReceiver
 	err = c.Watch(&source.Kind{Type: &corev1.Service{}}, &handler.EnqueueRequestForOwner{
 		IsController: true,
-		OwnerType:    &operatorv1alpha1.MeteringReceiver{},
+		OwnerType:    &operatorv1beta1.MeteringReceiver{},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to secondary resource "Ingress" and requeue the owner MeteringReceiver
+	err = c.Watch(&source.Kind{Type: &netv1.Ingress{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &operatorv1beta1.MeteringReceiver{},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to secondary resource "ConfigMap" and requeue the owner MeteringReceiver
+	err = c.Watch(&source.Kind{Type: &corev1.ConfigMap{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &operatorv1beta1.MeteringReceiver{},
 	})
 	if err != nil {
 		return err
 	}
 
-	// Watch for changes to secondary resource "Certificate" and requeue the owner MeteringReceiver
-	err = c.Watch(&source.Kind{Type: &certmgr.Certificate{}}, &handler.EnqueueRequestForOwner{
+	// Watch for changes to secondary resource "NetworkPolicy" and requeue the owner MeteringReceiver
+	err = c.Watch(&source.Kind{Type: &networkingv1.NetworkPolicy{}}, &handler.EnqueueRequestForOwner{
 		IsController: true,
-		OwnerType:    &operatorv1alpha1.MeteringReceiver{},
+		OwnerType:    &operatorv1beta1.MeteringReceiver{},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to the Secrets and ConfigMaps used by the MeteringReceivers, which are not owned by them
+	err = c.Watch(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: referencedObjectToMeteringReceivers(mgr.GetClient(), "Secret"),
 	})
 	if err != nil {
-		reqLogger.Error(err, "Failed to watch Certificate")
-		// CertManager might not be installed, so don't fail
-		//CS??? return err
+		return err
+	}
+	err = c.Watch(&source.Kind{Type: &corev1.ConfigMap{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: referencedObjectToMeteringReceivers(mgr.GetClient(), "ConfigMap"),
+	})
+	if err != nil {
+		return err
+	}
+
+	if !apis.podDisruptionBudget.Empty() {
+		// Watch for changes to secondary resource "PodDisruptionBudget" and requeue the owner MeteringReceiver
+		err = c.Watch(&source.Kind{Type: res.NewPodDisruptionBudget(apis.podDisruptionBudget)}, &handler.EnqueueRequestForOwner{
+			IsController: true,
+			OwnerType:    &operatorv1beta1.MeteringReceiver{},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if apis.route {
+		// Watch for changes to secondary resource "Route" and requeue the owner MeteringReceiver
+		err = c.Watch(&source.Kind{Type: res.NewRoute()}, &handler.EnqueueRequestForOwner{
+			IsController: true,
+			OwnerType:    &operatorv1beta1.MeteringReceiver{},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if apis.horizontalPodAutoscaler {
+		// Watch for changes to secondary resource "HorizontalPodAutoscaler" and requeue the owner MeteringReceiver
+		err = c.Watch(&source.Kind{Type: &autoscalingv2beta2.HorizontalPodAutoscaler{}}, &handler.EnqueueRequestForOwner{
+			IsController: true,
+			OwnerType:    &operatorv1beta1.MeteringReceiver{},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if apis.certificate.Empty() {
+		// cert-manager might not be installed yet, so don't fail
+		reqLogger.Info("cert-manager Certificates are not served, Certificates will not be watched")
+	} else {
+		// Watch for changes to secondary resource "Certificate" and requeue the owner MeteringReceiver
+		err = c.Watch(&source.Kind{Type: res.NewCertificate(apis.certificate)}, &handler.EnqueueRequestForOwner{
+			IsController: true,
+			OwnerType:    &operatorv1beta1.MeteringReceiver{},
+		})
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -122,6 +224,12 @@ type ReconcileMeteringReceiver struct {
 	// that reads objects from the cache and writes to the apiserver
 	client client.Client
 	scheme *runtime.Scheme
+	// recorder creates the Events of the MeteringReceivers
+	recorder record.EventRecorder
+	// apis are the optional APIs served by the cluster
+	apis availableAPIs
+	// operatorNamespace is allowed to connect to the receivers by the default NetworkPolicies
+	operatorNamespace string
 }
 
 // Reconcile reads that state of the cluster for a MeteringReceiver object and makes changes based on the state read
@@ -139,7 +247,7 @@ func (r *ReconcileMeteringReceiver) Reconcile(request reconcile.Request) (reconc
 	needToRequeue := false
 
 	// Fetch the MeteringReceiver CR instance
-	instance := &operatorv1alpha1.MeteringReceiver{}
+	instance := &operatorv1beta1.MeteringReceiver{}
 	err := r.client.Get(context.TODO(), request.NamespacedName, instance)
 	if err != nil {
 		if errors.IsNotFound(err) {
@@ -154,102 +262,182 @@ func (r *ReconcileMeteringReceiver) Reconcile(request reconcile.Request) (reconc
 		return reconcile.Result{}, err
 	}
 
-	version := instance.Spec.Version
-	reqLogger.Info("got Metering instance, version=" + version)
+	// the defaulting webhook sets the defaults when the CR is stored.
+	// set them here too for CRs that were stored while the webhook was not available.
+	instance.Spec.SetDefaults()
 
-	// set a default Status value
-	if len(instance.Status.PodNames) == 0 {
-		instance.Status.PodNames = res.DefaultStatusForCR
-		err = r.client.Status().Update(context.TODO(), instance)
-		if err != nil {
-			reqLogger.Error(err, "Failed to set MeteringReceiver default status")
-			return reconcile.Result{}, err
-		}
+	// apply spec.deletionPolicy before the CR is deleted
+	if instance.GetDeletionTimestamp() != nil {
+		return r.finalize(instance)
+	}
+	err = r.addFinalizer(instance)
+	if err != nil {
+		return reconcile.Result{}, err
 	}
+	err = r.ensureResourceNaming(instance)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	names := res.ResourceNamesFor(instance)
+
+	version := instance.Spec.Version
+	reqLogger.Info("got Metering instance, version=" + version)
 
 	reqLogger.Info("Checking Services")
 	// Check if the Receiver Services already exist. If not, create new ones.
 	err = r.reconcileAllServices(instance, &needToRequeue)
 	if err != nil {
+		r.reportFailure(instance, err)
+		return reconcile.Result{}, err
+	}
+
+	reqLogger.Info("Checking Receiver Ingress", "Ingress.Name", names.Ingress)
+	// Create, update or delete the Ingress depending on spec.ingress
+	err = r.reconcileIngress(instance, &needToRequeue)
+	if err != nil {
+		r.reportFailure(instance, err)
+		return reconcile.Result{}, err
+	}
+
+	reqLogger.Info("Checking Receiver Route", "Route.Name", names.Route)
+	// Create, update or delete the Route depending on spec.exposure
+	err = r.reconcileRoute(instance, &needToRequeue)
+	if err != nil {
+		r.reportFailure(instance, err)
 		return reconcile.Result{}, err
 	}
 
-	reqLogger.Info("Checking Receiver Deployment", "Deployment.Name", res.ReceiverDeploymentName)
+	reqLogger.Info("Checking Receiver NetworkPolicies")
+	// Create, update or delete the NetworkPolicies depending on spec.networkPolicy
+	err = r.reconcileNetworkPolicies(instance, &needToRequeue)
+	if err != nil {
+		r.reportFailure(instance, err)
+		return reconcile.Result{}, err
+	}
 
-	// set common MongoDB env vars based on the instance
-	mongoDBEnvVars = res.BuildMongoDBEnvVars(instance.Spec.MongoDB)
+	reqLogger.Info("Checking Receiver logging ConfigMap", "ConfigMap.Name", names.LoggingConfigMap)
+	// Check if the logging ConfigMap already exists, if not create a new one
+	loggingConfigHash, err := r.reconcileLoggingConfigMap(instance, &needToRequeue)
+	if err != nil {
+		r.reportFailure(instance, err)
+		return reconcile.Result{}, err
+	}
 
-	// set common Volumes based on the instance
-	commonVolumes = res.BuildCommonVolumes(instance.Spec.MongoDB, res.ReceiverDeploymentName, "loglevel")
+	reqLogger.Info("Checking MongoDB Secrets")
+	// the receiver pods wait forever for missing secrets, so don't roll them out until the secrets exist.
+	// the Secrets are watched, so the CR is reconciled again when they are created.
+	secretsState, err := r.checkSecrets(instance)
+	if err != nil {
+		r.reportFailure(instance, err)
+		return reconcile.Result{}, err
+	}
+	if !secretsState.ready {
+		reqLogger.Info("Waiting for MongoDB Secrets", "problems", secretsState.message)
+		// only emit the Event when the Secrets go missing, not on every reconcile while they are missing
+		missingBefore := instance.Status.IsConditionTrue(operatorv1beta1.ConditionSecretsMissing)
+		err = r.updateStatus(instance, secretsState)
+		if err == nil && !missingBefore {
+			r.recorder.Event(instance, corev1.EventTypeWarning, reasonSecretsMissing, secretsState.message)
+		}
+		return statusResult(reconcile.Result{}, err)
+	}
 
+	reqLogger.Info("Checking Receiver Deployment", "Deployment.Name", names.Deployment)
 	// Check if the Receiver Deployment already exists, if not create a new one
-	newReceiverDeployment, err := r.deploymentForReceiver(instance)
+	newReceiverDeployment, err := r.deploymentForReceiver(instance, loggingConfigHash)
 	if err != nil {
+		r.reportFailure(instance, err)
 		return reconcile.Result{}, err
 	}
-	err = res.ReconcileDeployment(r.client, instance.Namespace, res.ReceiverDeploymentName, "Receiver", newReceiverDeployment, &needToRequeue)
+	err = res.ReconcileDeployment(r.client, instance.Namespace, names.Deployment, "Receiver", newReceiverDeployment, &needToRequeue)
 	if err != nil {
+		r.reportFailure(instance, err)
 		return reconcile.Result{}, err
 	}
 
-	reqLogger.Info("Checking Certificates")
-	// Check if the Certificates already exist, if not create new ones
-	err = r.reconcileAllCertificates(instance, &needToRequeue)
+	reqLogger.Info("Checking Receiver HorizontalPodAutoscaler", "HPA.Name", names.Deployment)
+	// Create, update or delete the HorizontalPodAutoscaler depending on spec.autoscaling
+	err = r.reconcileAutoscaler(instance, &needToRequeue)
 	if err != nil {
+		r.reportFailure(instance, err)
+		return reconcile.Result{}, err
+	}
+
+	reqLogger.Info("Checking Receiver PodDisruptionBudget", "PDB.Name", names.Deployment)
+	// Create, update or delete the PodDisruptionBudget depending on the number of receiver pods
+	err = r.reconcilePodDisruptionBudget(instance, &needToRequeue)
+	if err != nil {
+		r.reportFailure(instance, err)
+		return reconcile.Result{}, err
+	}
+
+	reqLogger.Info("Checking Certificates", "TLS.Mode", instance.Spec.TLS.Mode)
+	// Create the Certificates or the operator generated certificate, depending on spec.tls.mode
+	renewIn, err := r.reconcileTLS(instance, &needToRequeue)
+	if err != nil {
+		r.reportFailure(instance, err)
 		return reconcile.Result{}, err
 	}
 
 	if needToRequeue {
-		// one or more resources was created, so requeue the request after 5 seconds
-		reqLogger.Info("Requeue the request")
-		// tried RequeueAfter but it is ignored because we're watching secondary resources.
-		// so sleep instead to allow resources to be created by k8s.
-		time.Sleep(5 * time.Second)
-		return reconcile.Result{Requeue: true}, nil
+		// one or more resources was created or updated, show them as progressing in the status.
+		// the watches reconcile the CR again when they change.
+		reqLogger.Info("Requeue the request", "RequeueAfter", resourceRequeueDelay.String())
+		return statusResult(reconcile.Result{RequeueAfter: resourceRequeueDelay}, r.updateStatus(instance, secretsState))
 	}
 
 	reqLogger.Info("Updating MeteringReceiver status")
-	// Update the MeteringReceiver status with the pod names.
-	// List the pods for this instance's Deployments
+	// Update the MeteringReceiver conditions from the state of the Deployment, Service and Certificate.
+	// the operator generated certificate is renewed in a later reconcile, nothing is watched that would trigger it
+	result, err := statusResult(reconcile.Result{RequeueAfter: renewIn}, r.updateStatus(instance, secretsState))
+	if err == nil {
+		reqLogger.Info("Reconciliation completed")
+	}
+	return result, err
+}
 
-	podNames, err := r.getAllPodNames(instance)
+// statusResult returns the result of a reconcile that ends with a status update.
+// A conflict means the CR was changed since it was read, the change is watched,
+// so the CR is reconciled again with the new version instead of retrying with the old one.
+func statusResult(result reconcile.Result, err error) (reconcile.Result, error) {
+	if errors.IsConflict(err) {
+		log.Info("MeteringReceiver was changed during the reconcile, requeue the request")
+		return reconcile.Result{Requeue: true}, nil
+	}
 	if err != nil {
-		reqLogger.Error(err, "Failed to list pods")
 		return reconcile.Result{}, err
 	}
-	// if no pods were found set the default status
-	if len(podNames) == 0 {
-		podNames = res.DefaultStatusForCR
-	}
+	return result, nil
+}
 
-	// Update status.PodNames if needed
-	if !reflect.DeepEqual(podNames, instance.Status.PodNames) {
-		instance.Status.PodNames = podNames
-		err := r.client.Status().Update(context.TODO(), instance)
-		if err != nil {
-			reqLogger.Error(err, "Failed to update MeteringReceiver status")
-			return reconcile.Result{}, err
-		}
+// maxConcurrentReconciles returns the number of MeteringReceivers reconciled at the same time, 1 by default.
+// The same MeteringReceiver is never reconciled by two workers at the same time.
+func maxConcurrentReconciles() int {
+	value := os.Getenv(maxConcurrentReconcilesEnvVar)
+	if value == "" {
+		return 1
 	}
-
-	reqLogger.Info("Reconciliation completed")
-	// since we updated the status in the MeteringReceiver CR, sleep 5 seconds to allow the CR to be refreshed.
-	time.Sleep(5 * time.Second)
-	return reconcile.Result{}, nil
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		log.Info("Ignoring invalid "+maxConcurrentReconcilesEnvVar, "value", value)
+		return 1
+	}
+	return n
 }
 
 // Check if the Services already exist. If not, create new ones.
 // This function was created to reduce the cyclomatic complexity :)
-func (r *ReconcileMeteringReceiver) reconcileAllServices(instance *operatorv1alpha1.MeteringReceiver, needToRequeue *bool) error {
+func (r *ReconcileMeteringReceiver) reconcileAllServices(instance *operatorv1beta1.MeteringReceiver, needToRequeue *bool) error {
 	reqLogger := log.WithValues("func", "reconcileAllServices")
+	names := res.ResourceNamesFor(instance)
 
-	reqLogger.Info("Checking Receiver Service", "Service.Name", res.ReceiverServiceName)
+	reqLogger.Info("Checking Receiver Service", "Service.Name", names.Service)
 	// Check if the Receiver Service already exists, if not create a new one
 	newReceiverService, err := r.serviceForReceiver(instance)
 	if err != nil {
 		return err
 	}
-	err = res.ReconcileService(r.client, instance.Namespace, res.ReceiverServiceName, "Receiver", newReceiverService, needToRequeue)
+	err = res.ReconcileService(r.client, instance.Namespace, names.Service, "Receiver", newReceiverService, needToRequeue)
 	if err != nil {
 		return err
 	}
@@ -258,101 +446,379 @@ func (r *ReconcileMeteringReceiver) reconcileAllServices(instance *operatorv1alp
 }
 
 // Check if the Certificates already exist, if not create new ones.
+// The Certificates are created with the newest cert-manager API served by the cluster.
+// When certmanager.k8s.io/v1alpha1 is also served, the old Certificates are deleted once the new ones exist.
 // This function was created to reduce the cyclomatic complexity :)
-func (r *ReconcileMeteringReceiver) reconcileAllCertificates(instance *operatorv1alpha1.MeteringReceiver, needToRequeue *bool) error {
+func (r *ReconcileMeteringReceiver) reconcileAllCertificates(instance *operatorv1beta1.MeteringReceiver, needToRequeue *bool) error {
 	reqLogger := log.WithValues("func", "reconcileAllCertificates")
 
+	if r.apis.certificate.Empty() {
+		return fmt.Errorf("cert-manager is not installed, none of the Certificate APIs %v is served",
+			res.CertificateGroupVersionKinds)
+	}
+
 	certificateList := []res.CertificateData{}
 	// need to create the receiver certificate
-	certificateList = append(certificateList, res.ReceiverCertificateData)
+	certificateList = append(certificateList, receiverCertificateData(instance))
+	issuerName := instance.Spec.ClusterIssuer
+	if issuerRef := instance.Spec.TLS.Certificate.IssuerRef; issuerRef != nil {
+		issuerName = issuerRef.Name
+	}
 	for _, certData := range certificateList {
 		reqLogger.Info("Checking Certificate", "Certificate.Name", certData.Name)
-		newCertificate := res.BuildCertificate(instance.Namespace, instance.Spec.ClusterIssuer, certData)
+		newCertificate, err := res.BuildCertificate(r.apis.certificate, instance.Namespace, issuerName, certData)
+		if err != nil {
+			return err
+		}
 		// Set Metering instance as the owner and controller of the Certificate
-		err := controllerutil.SetControllerReference(instance, newCertificate, r.scheme)
+		err = controllerutil.SetControllerReference(instance, newCertificate, r.scheme)
 		if err != nil {
-			reqLogger.Error(err, "Failed to set owner for Certificate", "Certificate.Namespace", newCertificate.Namespace,
-				"Certificate.Name", newCertificate.Name)
+			reqLogger.Error(err, "Failed to set owner for Certificate", "Certificate.Namespace", newCertificate.GetNamespace(),
+				"Certificate.Name", newCertificate.GetName())
 			return err
 		}
 		err = res.ReconcileCertificate(r.client, instance.Namespace, certData.Name, newCertificate, needToRequeue)
 		if err != nil {
 			return err
 		}
+
+		if r.apis.legacyCertificate && r.apis.certificate != res.LegacyCertificateGroupVersionKind {
+			err = r.deleteCertificate(instance, res.LegacyCertificateGroupVersionKind, certData.Name)
+			if err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
+// deleteCertificate deletes the Certificate of the given cert-manager kind.
+// It is used when the Certificate was migrated to cert-manager.io, or when spec.tls.mode no longer uses cert-manager.
+// The secret of the Certificate is kept, so the receiver pods keep their certificate while the new one is issued.
+// Only a Certificate controlled by the MeteringReceiver is deleted.
+func (r *ReconcileMeteringReceiver) deleteCertificate(instance *operatorv1beta1.MeteringReceiver, gvk schema.GroupVersionKind,
+	certificateName string) error {
+	reqLogger := log.WithValues("func", "deleteCertificate", "Certificate.Name", certificateName,
+		"Certificate.APIVersion", gvk.GroupVersion().String())
+
+	certificate := res.NewCertificate(gvk)
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: certificateName, Namespace: instance.Namespace}, certificate)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		reqLogger.Error(err, "Failed to get Certificate")
+		return err
+	}
+	if !metav1.IsControlledBy(certificate, instance) {
+		return nil
+	}
+	reqLogger.Info("Deleting Certificate")
+	err = r.client.Delete(context.TODO(), certificate)
+	if err != nil && !errors.IsNotFound(err) {
+		reqLogger.Error(err, "Failed to delete Certificate")
+		return err
+	}
+	return nil
+}
+
+// Check if the Ingress already exists, if not create a new one.
+// The Ingress is deleted when it is not enabled.
+func (r *ReconcileMeteringReceiver) reconcileIngress(instance *operatorv1beta1.MeteringReceiver, needToRequeue *bool) error {
+	names := res.ResourceNamesFor(instance)
+	if instance.Spec.Ingress == nil || !instance.Spec.Ingress.Enabled {
+		return res.DeleteIfExists(r.client, instance, instance.Namespace, names.Ingress, "Ingress", &netv1.Ingress{})
+	}
+
+	newIngress, err := r.ingressForReceiver(instance)
+	if err != nil {
+		return err
+	}
+	return res.ReconcileIngress(r.client, instance.Namespace, names.Ingress, "Receiver", newIngress, needToRequeue)
+}
+
+// ingressForReceiver returns a Receiver Ingress object
+func (r *ReconcileMeteringReceiver) ingressForReceiver(instance *operatorv1beta1.MeteringReceiver) (*netv1.Ingress, error) {
+	reqLogger := log.WithValues("func", "ingressForReceiver", "instance.Name", instance.Name)
+	names := res.ResourceNamesFor(instance)
+	ingressSpec := instance.Spec.Ingress
+
+	// the annotations in the CR override the common annotations
+	annotations := map[string]string{}
+	for key, value := range res.CommonIngressAnnotations {
+		annotations[key] = value
+	}
+	for key, value := range res.ReceiverIngressAnnotations {
+		annotations[key] = value
+	}
+	annotations["kubernetes.io/ingress.class"] = ingressSpec.Class
+	for key, value := range ingressSpec.Annotations {
+		annotations[key] = value
+	}
+
+	ingress := res.BuildIngress(instance.Namespace, res.IngressData{
+		Name:        names.Ingress,
+		Host:        ingressSpec.Host,
+		Path:        ingressSpec.Path,
+		Service:     names.Service,
+		Port:        instance.Spec.Service.Port,
+		TLSSecret:   ingressSpec.TLSSecretName,
+		Annotations: annotations,
+	})
+	// Set Metering instance as the owner and controller of the Ingress
+	err := controllerutil.SetControllerReference(instance, ingress, r.scheme)
+	if err != nil {
+		reqLogger.Error(err, "Failed to set owner for Receiver Ingress")
+		return nil, err
+	}
+	return ingress, nil
+}
+
+// Check if the Route already exists, if not create a new one.
+// The Route is deleted when the exposure type is not Route.
+func (r *ReconcileMeteringReceiver) reconcileRoute(instance *operatorv1beta1.MeteringReceiver, needToRequeue *bool) error {
+	reqLogger := log.WithValues("func", "reconcileRoute", "instance.Name", instance.Name)
+	names := res.ResourceNamesFor(instance)
+
+	routeEnabled := instance.Spec.Exposure != nil && instance.Spec.Exposure.Type == operatorv1beta1.ExposureTypeRoute
+	if !r.apis.route {
+		if routeEnabled {
+			return fmt.Errorf("spec.exposure.type is %s, but the %s API is not available on this cluster",
+				operatorv1beta1.ExposureTypeRoute, res.RouteGroupVersionKind.GroupVersion())
+		}
+		// there can't be a Route to delete
+		return nil
+	}
+	if !routeEnabled {
+		return res.DeleteIfExists(r.client, instance, instance.Namespace, names.Route, "Route", res.NewRoute())
+	}
+
+	routeSpec := instance.Spec.Exposure.Route
+	routeData := res.RouteData{
+		Name:        names.Route,
+		Host:        routeSpec.Host,
+		Service:     names.Service,
+		ServicePort: res.ReceiverServicePortName,
+		Termination: string(routeSpec.Termination),
+	}
+	if routeSpec.Termination == operatorv1beta1.RouteTerminationReencrypt {
+		// the router checks the receiver certificate with the CA that signed it
+		secret := &corev1.Secret{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: names.CertSecret, Namespace: instance.Namespace}, secret)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				reqLogger.Info("Waiting for the receiver certificate secret", "Secret.Name", names.CertSecret)
+				*needToRequeue = true
+				return nil
+			}
+			reqLogger.Error(err, "Failed to get the receiver certificate secret", "Secret.Name", names.CertSecret)
+			return err
+		}
+		routeData.DestinationCACertificate = string(secret.Data["ca.crt"])
+		if routeData.DestinationCACertificate == "" {
+			reqLogger.Info("Waiting for the CA in the receiver certificate secret", "Secret.Name", names.CertSecret)
+			*needToRequeue = true
+			return nil
+		}
+	}
+
+	newRoute := res.BuildRoute(instance.Namespace, routeData)
+	// Set Metering instance as the owner and controller of the Route
+	err := controllerutil.SetControllerReference(instance, newRoute, r.scheme)
+	if err != nil {
+		reqLogger.Error(err, "Failed to set owner for Receiver Route")
+		return err
+	}
+	return res.ReconcileRoute(r.client, instance.Namespace, names.Route, "Receiver", newRoute, needToRequeue)
+}
+
+// Check if the logging ConfigMap already exists, if not create a new one.
+// Return the hash of the receiver logging configuration.
+func (r *ReconcileMeteringReceiver) reconcileLoggingConfigMap(instance *operatorv1beta1.MeteringReceiver,
+	needToRequeue *bool) (string, error) {
+	reqLogger := log.WithValues("func", "reconcileLoggingConfigMap", "instance.Name", instance.Name)
+	names := res.ResourceNamesFor(instance)
+
+	newConfigMap, hash, err := res.BuildLoggingConfigMap(instance.Namespace, names.LoggingConfigMap, res.ReceiverDeploymentName, "loglevel",
+		instance.Spec.Logging)
+	if err != nil {
+		reqLogger.Error(err, "Failed to build Logging ConfigMap")
+		return "", err
+	}
+	// Set Metering instance as the owner and controller of the ConfigMap, when the ConfigMap is created
+	err = controllerutil.SetControllerReference(instance, newConfigMap, r.scheme)
+	if err != nil {
+		reqLogger.Error(err, "Failed to set owner for Logging ConfigMap")
+		return "", err
+	}
+	err = res.ReconcileConfigMap(r.client, instance.Namespace, names.LoggingConfigMap, "Logging", newConfigMap, needToRequeue)
+	if err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// Check if the PodDisruptionBudget already exists, if not create a new one.
+// The PodDisruptionBudget is deleted when there can be only one receiver pod,
+// because it would block the eviction of that pod when a node is drained.
+func (r *ReconcileMeteringReceiver) reconcilePodDisruptionBudget(instance *operatorv1beta1.MeteringReceiver, needToRequeue *bool) error {
+	reqLogger := log.WithValues("func", "reconcilePodDisruptionBudget", "instance.Name", instance.Name)
+	names := res.ResourceNamesFor(instance)
+
+	gvk := r.apis.podDisruptionBudget
+	if gvk.Empty() {
+		reqLogger.Info("The cluster does not serve PodDisruptionBudgets")
+		return nil
+	}
+
+	// with autoscaling, only the minimum number of pods is guaranteed
+	var replicas int32 = operatorv1beta1.DefaultReplicas
+	if instance.Spec.Autoscaling != nil && instance.Spec.Autoscaling.MinReplicas != nil {
+		replicas = *instance.Spec.Autoscaling.MinReplicas
+	} else if instance.Spec.Autoscaling == nil && instance.Spec.Replicas != nil {
+		replicas = *instance.Spec.Replicas
+	}
+	if replicas <= 1 {
+		return res.DeleteIfExists(r.client, instance, instance.Namespace, names.Deployment, "PodDisruptionBudget",
+			res.NewPodDisruptionBudget(gvk))
+	}
+
+	selectorLabels := res.LabelsForSelector(res.ReceiverDeploymentName, meteringReceiverCrType, instance.Name)
+	pdbSpec := instance.Spec.PodDisruptionBudget
+	newPDB, err := res.BuildPodDisruptionBudget(gvk, instance.Namespace, names.Deployment, selectorLabels,
+		pdbSpec.MinAvailable, pdbSpec.MaxUnavailable)
+	if err != nil {
+		reqLogger.Error(err, "Failed to build Receiver PodDisruptionBudget")
+		return err
+	}
+	// Set Metering instance as the owner and controller of the PodDisruptionBudget
+	err = controllerutil.SetControllerReference(instance, newPDB, r.scheme)
+	if err != nil {
+		reqLogger.Error(err, "Failed to set owner for Receiver PodDisruptionBudget")
+		return err
+	}
+	return res.ReconcilePodDisruptionBudget(r.client, instance.Namespace, names.Deployment, "Receiver", newPDB, needToRequeue)
+}
+
+// Check if the HorizontalPodAutoscaler already exists, if not create a new one.
+// The HorizontalPodAutoscaler is deleted when autoscaling is not enabled.
+func (r *ReconcileMeteringReceiver) reconcileAutoscaler(instance *operatorv1beta1.MeteringReceiver, needToRequeue *bool) error {
+	names := res.ResourceNamesFor(instance)
+	if !r.apis.horizontalPodAutoscaler {
+		if instance.Spec.Autoscaling != nil {
+			return fmt.Errorf("spec.autoscaling is set, but the %s API is not available on this cluster",
+				res.HorizontalPodAutoscalerGroupVersionKind.GroupVersion())
+		}
+		// there can't be a HorizontalPodAutoscaler to delete
+		return nil
+	}
+	if instance.Spec.Autoscaling == nil {
+		return res.DeleteIfExists(r.client, instance, instance.Namespace, names.Deployment, "HorizontalPodAutoscaler",
+			&autoscalingv2beta2.HorizontalPodAutoscaler{})
+	}
+
+	newHPA, err := r.autoscalerForReceiver(instance)
+	if err != nil {
+		return err
+	}
+	return res.ReconcileHorizontalPodAutoscaler(r.client, instance.Namespace, names.Deployment, "Receiver",
+		newHPA, needToRequeue)
+}
+
 // deploymentForReceiver returns a Receiver Deployment object
-func (r *ReconcileMeteringReceiver) deploymentForReceiver(instance *operatorv1alpha1.MeteringReceiver) (*appsv1.Deployment, error) {
+// loggingConfigHash is set in a pod annotation, so that the pods are rolled when the log levels change.
+// The hash of the Secrets and ConfigMaps used by the pods is set in another annotation, for the same reason.
+func (r *ReconcileMeteringReceiver) deploymentForReceiver(instance *operatorv1beta1.MeteringReceiver,
+	loggingConfigHash string) (*appsv1.Deployment, error) {
 	reqLogger := log.WithValues("func", "deploymentForReceiver", "instance.Name", instance.Name)
+	names := res.ResourceNamesFor(instance)
 	metaLabels := res.LabelsForMetadata(res.ReceiverDeploymentName)
 	selectorLabels := res.LabelsForSelector(res.ReceiverDeploymentName, meteringReceiverCrType, instance.Name)
 	podLabels := res.LabelsForPodMetadata(res.ReceiverDeploymentName, meteringReceiverCrType, instance.Name)
 
 	receiverImage := res.GetImageID(instance.Spec.ImageRegistry, instance.Spec.ImageTagPostfix,
-		res.DefaultImageRegistry, res.DefaultReceiverImageName, res.VarImageSHAforReceiver, res.DefaultReceiverImageTag)
+		res.DefaultReceiverImageName, res.VarImageSHAforReceiver, res.DefaultReceiverImageTag)
 	reqLogger.Info("receiverImage=" + receiverImage)
 
 	var additionalInfo res.SecretCheckData
 	var additionalInfoPtr *res.SecretCheckData
 	// add to the SECRET_LIST env var
-	additionalInfo.Names = res.ReceiverCertSecretName
+	additionalInfo.Names = names.CertSecret
 	// add to the SECRET_DIR_LIST env var
 	additionalInfo.Dirs = res.ReceiverCertDirName
 	// add the volume mount for the receiver cert
 	additionalInfo.VolumeMounts = []corev1.VolumeMount{res.ReceiverCertVolumeMountForSecretCheck}
 	additionalInfoPtr = &additionalInfo
 
+	// the resources in the CR are merged over the default resources of the containers
+	var receiverResources, initResources corev1.ResourceRequirements
+	if instance.Spec.Resources != nil {
+		receiverResources = instance.Spec.Resources.Receiver
+		initResources = instance.Spec.Resources.Init
+	}
+
 	receiverSecretCheckContainer := res.BuildSecretCheckContainer(res.ReceiverDeploymentName, receiverImage,
-		res.SecretCheckCmd, instance.Spec.MongoDB, additionalInfoPtr)
+		res.SecretCheckCmd, instance.Spec.MongoDB, additionalInfoPtr, initResources)
 
+	mongoDBEnvVars := res.BuildMongoDBEnvVars(instance.Spec.MongoDB)
+
+	verboseInit := operatorv1beta1.DefaultVerboseInit
+	if instance.Spec.Logging.VerboseInit != nil {
+		verboseInit = *instance.Spec.Logging.VerboseInit
+	}
 	initEnvVars := []corev1.EnvVar{
 		{
 			Name:  "MCM_VERBOSE",
-			Value: "true",
+			Value: strconv.FormatBool(verboseInit),
 		},
 	}
 	initEnvVars = append(initEnvVars, res.CommonEnvVars...)
 	initEnvVars = append(initEnvVars, mongoDBEnvVars...)
-	receiverInitContainer := res.BuildInitContainer(res.ReceiverDeploymentName, receiverImage, initEnvVars)
+	receiverInitContainer := res.BuildInitContainer(res.ReceiverDeploymentName, receiverImage, initEnvVars,
+		instance.Spec.MongoDB, initResources)
 
-	receiverEnvVars := []corev1.EnvVar{
-		{
-			Name:  "HC_DM_MCM_RECEIVER_ENABLED",
-			Value: "true",
-		},
-	}
+	// the data manager components are enabled from the CR
+	receiverEnvVars := res.BuildComponentEnvVars(instance.Spec.Components)
 
 	receiverEnvVars = append(receiverEnvVars, res.ReceiverSslEnvVars...)
 	receiverMainContainer := res.ReceiverMainContainer
 	receiverMainContainer.Image = receiverImage
 	receiverMainContainer.Name = res.ReceiverDeploymentName
+	receiverMainContainer.Resources = res.MergeResources(res.ReceiverMainContainer.Resources, receiverResources)
 
 	receiverMainContainer.Env = append(receiverMainContainer.Env, receiverEnvVars...)
 	receiverMainContainer.Env = append(receiverMainContainer.Env, res.CommonEnvVars...)
 	receiverMainContainer.Env = append(receiverMainContainer.Env, mongoDBEnvVars...)
 
-	receiverVolumes := commonVolumes
+	receiverVolumes := res.BuildCommonVolumes(instance.Spec.MongoDB, names.LoggingConfigMap, res.ReceiverDeploymentName, "loglevel")
 	receiverMainContainer.VolumeMounts = append(receiverMainContainer.VolumeMounts, res.ReceiverCertVolumeMountForMain)
-	receiverVolumes = append(receiverVolumes, res.ReceiverCertVolume)
-	receiverMainContainer.VolumeMounts = append(receiverMainContainer.VolumeMounts, res.CommonMainVolumeMounts...)
+	receiverVolumes = append(receiverVolumes, res.BuildReceiverCertVolume(names.CertSecret))
+	receiverMainContainer.VolumeMounts = append(receiverMainContainer.VolumeMounts, res.BuildMongoDBVolumeMounts(instance.Spec.MongoDB)...)
+
+	podAnnotations := res.AnnotationsForPod()
+	podAnnotations[res.LoggingConfigHashAnnotation] = loggingConfigHash
+
+	// leave the replicas to the HorizontalPodAutoscaler when autoscaling is enabled
+	replicas := instance.Spec.Replicas
+	if instance.Spec.Autoscaling != nil {
+		replicas = nil
+	}
 
 	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      res.ReceiverDeploymentName,
+			Name:      names.Deployment,
 			Namespace: instance.Namespace,
 			Labels:    metaLabels,
 		},
 		Spec: appsv1.DeploymentSpec{
-			Replicas: &res.Replica1,
+			Replicas: replicas,
 			Selector: &metav1.LabelSelector{
 				MatchLabels: selectorLabels,
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels:      podLabels,
-					Annotations: res.AnnotationsForPod(),
+					Annotations: podAnnotations,
 				},
 				Spec: corev1.PodSpec{
 					ServiceAccountName:            res.GetServiceAccountName(),
@@ -360,35 +826,12 @@ func (r *ReconcileMeteringReceiver) deploymentForReceiver(instance *operatorv1al
 					HostPID:                       false,
 					HostIPC:                       false,
 					TerminationGracePeriodSeconds: &res.Seconds60,
-					Affinity: &corev1.Affinity{
-						NodeAffinity: &corev1.NodeAffinity{
-							RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
-								NodeSelectorTerms: []corev1.NodeSelectorTerm{
-									{
-										MatchExpressions: []corev1.NodeSelectorRequirement{
-											{
-												Key:      "beta.kubernetes.io/arch",
-												Operator: corev1.NodeSelectorOpIn,
-												Values:   res.ArchitectureList,
-											},
-										},
-									},
-								},
-							},
-						},
-					},
-					Tolerations: []corev1.Toleration{
-						{
-							Key:      "dedicated",
-							Operator: corev1.TolerationOpExists,
-							Effect:   corev1.TaintEffectNoSchedule,
-						},
-						{
-							Key:      "CriticalAddonsOnly",
-							Operator: corev1.TolerationOpExists,
-						},
-					},
-					Volumes: receiverVolumes,
+					NodeSelector:                  instance.Spec.NodeSelector,
+					Affinity:                      res.BuildAffinity(instance.Spec.Affinity),
+					Tolerations:                   res.BuildTolerations(instance.Spec.Tolerations),
+					TopologySpreadConstraints:     instance.Spec.TopologySpreadConstraints,
+					PriorityClassName:             instance.Spec.PriorityClassName,
+					Volumes:                       receiverVolumes,
 					InitContainers: []corev1.Container{
 						receiverSecretCheckContainer,
 						receiverInitContainer,
@@ -400,8 +843,16 @@ func (r *ReconcileMeteringReceiver) deploymentForReceiver(instance *operatorv1al
 			},
 		},
 	}
+	// roll the pods when the content of the Secrets and ConfigMaps they use changes
+	contentHash, err := r.contentHashForPodSpec(instance, deployment.Spec.Template.Spec)
+	if err != nil {
+		reqLogger.Error(err, "Failed to hash the Secrets and ConfigMaps of the Receiver pods")
+		return nil, err
+	}
+	podAnnotations[res.ContentHashAnnotation] = contentHash
+
 	// Set Metering instance as the owner and controller of the Deployment
-	err := controllerutil.SetControllerReference(instance, deployment, r.scheme)
+	err = controllerutil.SetControllerReference(instance, deployment, r.scheme)
 	if err != nil {
 		reqLogger.Error(err, "Failed to set owner for Receiver Deployment")
 		return nil, err
@@ -410,31 +861,46 @@ func (r *ReconcileMeteringReceiver) deploymentForReceiver(instance *operatorv1al
 }
 
 // serviceForReceiver returns a Receiver Service object
-func (r *ReconcileMeteringReceiver) serviceForReceiver(instance *operatorv1alpha1.MeteringReceiver) (*corev1.Service, error) {
+func (r *ReconcileMeteringReceiver) serviceForReceiver(instance *operatorv1beta1.MeteringReceiver) (*corev1.Service, error) {
 	reqLogger := log.WithValues("func", "serviceForReceiver", "instance.Name", instance.Name)
+	names := res.ResourceNamesFor(instance)
 	metaLabels := res.LabelsForMetadata(res.ReceiverDeploymentName)
 	selectorLabels := res.LabelsForSelector(res.ReceiverDeploymentName, meteringReceiverCrType, instance.Name)
 
+	serviceSpec := instance.Spec.Service
+
+	// set the external traffic policy default of Kubernetes, so the Service does not differ from the one read back
+	externalTrafficPolicy := serviceSpec.ExternalTrafficPolicy
+	if serviceSpec.Type == corev1.ServiceTypeClusterIP {
+		externalTrafficPolicy = ""
+	} else if externalTrafficPolicy == "" {
+		externalTrafficPolicy = corev1.ServiceExternalTrafficPolicyTypeCluster
+	}
+
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      res.ReceiverServiceName,
-			Namespace: instance.Namespace,
-			Labels:    metaLabels,
+			Name:        names.Service,
+			Namespace:   instance.Namespace,
+			Labels:      metaLabels,
+			Annotations: res.AnnotationsForService(serviceSpec.Annotations),
 		},
 		Spec: corev1.ServiceSpec{
-			Type: corev1.ServiceTypeClusterIP,
+			Type: serviceSpec.Type,
 			Ports: []corev1.ServicePort{
 				{
-					Name:     "metering-receiver",
+					Name:     res.ReceiverServicePortName,
 					Protocol: corev1.ProtocolTCP,
-					Port:     5000,
+					Port:     serviceSpec.Port,
 					TargetPort: intstr.IntOrString{
 						Type:   intstr.Int,
-						IntVal: 5000,
+						IntVal: res.ReceiverContainerPort,
 					},
+					NodePort: serviceSpec.NodePort,
 				},
 			},
-			Selector: selectorLabels,
+			Selector:                 selectorLabels,
+			LoadBalancerSourceRanges: serviceSpec.LoadBalancerSourceRanges,
+			ExternalTrafficPolicy:    externalTrafficPolicy,
 		},
 	}
 
@@ -447,21 +913,44 @@ func (r *ReconcileMeteringReceiver) serviceForReceiver(instance *operatorv1alpha
 	return service, nil
 }
 
-// getAllPodNames returns the list of pod names for the associated deployments
-func (r *ReconcileMeteringReceiver) getAllPodNames(instance *operatorv1alpha1.MeteringReceiver) ([]string, error) {
-	reqLogger := log.WithValues("func", "getAllPodNames")
-	// List the pods for this instance's Receiver Deployment
-	receiverPodList := &corev1.PodList{}
-	listOpts := []client.ListOption{
-		client.InNamespace(instance.Namespace),
-		client.MatchingLabels(res.LabelsForSelector(res.ReceiverDeploymentName, meteringReceiverCrType, instance.Name)),
-	}
-	if err := r.client.List(context.TODO(), receiverPodList, listOpts...); err != nil {
-		reqLogger.Error(err, "Failed to list pods", "MeteringReceiver.Namespace", instance.Namespace, "Deployment.Name", res.ReceiverDeploymentName)
-		return nil, err
+// autoscalerForReceiver returns a Receiver HorizontalPodAutoscaler object
+func (r *ReconcileMeteringReceiver) autoscalerForReceiver(instance *operatorv1beta1.MeteringReceiver) (*autoscalingv2beta2.HorizontalPodAutoscaler, error) {
+	reqLogger := log.WithValues("func", "autoscalerForReceiver", "instance.Name", instance.Name)
+	names := res.ResourceNamesFor(instance)
+	metaLabels := res.LabelsForMetadata(res.ReceiverDeploymentName)
+	autoscaling := instance.Spec.Autoscaling
+
+	metrics := []autoscalingv2beta2.MetricSpec{}
+	if autoscaling.TargetCPUUtilizationPercentage != nil {
+		metrics = append(metrics, res.BuildResourceMetric(corev1.ResourceCPU, *autoscaling.TargetCPUUtilizationPercentage))
+	}
+	if autoscaling.TargetMemoryUtilizationPercentage != nil {
+		metrics = append(metrics, res.BuildResourceMetric(corev1.ResourceMemory, *autoscaling.TargetMemoryUtilizationPercentage))
 	}
 
-	podNames := res.GetPodNames(receiverPodList.Items)
+	hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      names.Deployment,
+			Namespace: instance.Namespace,
+			Labels:    metaLabels,
+		},
+		Spec: autoscalingv2beta2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2beta2.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       names.Deployment,
+			},
+			MinReplicas: autoscaling.MinReplicas,
+			MaxReplicas: autoscaling.MaxReplicas,
+			Metrics:     metrics,
+		},
+	}
 
-	return podNames, nil
+	// Set Metering instance as the owner and controller of the HorizontalPodAutoscaler
+	err := controllerutil.SetControllerReference(instance, hpa, r.scheme)
+	if err != nil {
+		reqLogger.Error(err, "Failed to set owner for Receiver HorizontalPodAutoscaler")
+		return nil, err
+	}
+	return hpa, nil
 }
@@ -0,0 +1,399 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package meteringreceiver
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+
+	operatorv1beta1 "github.com/ibm/ibm-metering-receiver-operator/pkg/apis/operator/v1beta1"
+	res "github.com/ibm/ibm-metering-receiver-operator/pkg/resources"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// newTestAutoscaler returns a HorizontalPodAutoscaler with the name of the receiver Deployment,
+// controlled by the MeteringReceiver with the given UID
+func newTestAutoscaler(instance *operatorv1beta1.MeteringReceiver, ownerUID types.UID) *autoscalingv2beta2.HorizontalPodAutoscaler {
+	controller := true
+	return &autoscalingv2beta2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      res.ResourceNamesFor(instance).Deployment,
+			Namespace: testNamespace,
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: operatorv1beta1.SchemeGroupVersion.String(),
+				Kind:       "MeteringReceiver",
+				Name:       instance.Name,
+				UID:        ownerUID,
+				Controller: &controller,
+			}},
+		},
+		Spec: autoscalingv2beta2.HorizontalPodAutoscalerSpec{MaxReplicas: 2},
+	}
+}
+
+func TestReconcileAutoscaler(t *testing.T) {
+	minReplicas := int32(2)
+	cpu := int32(80)
+	autoscaling := &operatorv1beta1.AutoscalingSpec{MinReplicas: &minReplicas, MaxReplicas: 5, TargetCPUUtilizationPercentage: &cpu}
+
+	tests := []struct {
+		name        string
+		served      bool
+		autoscaling *operatorv1beta1.AutoscalingSpec
+		// existingOwner is the UID of the controller of the existing HorizontalPodAutoscaler, empty when there is none
+		existingOwner types.UID
+		wantErr       bool
+		wantMax       int32
+	}{
+		{
+			name: "API not served and autoscaling not set",
+		},
+		{
+			name:        "API not served and autoscaling set",
+			autoscaling: autoscaling,
+			wantErr:     true,
+		},
+		{
+			name:        "autoscaling set",
+			served:      true,
+			autoscaling: autoscaling,
+			wantMax:     5,
+		},
+		{
+			name:          "autoscaling changed",
+			served:        true,
+			autoscaling:   autoscaling,
+			existingOwner: "receiver-uid",
+			wantMax:       5,
+		},
+		{
+			name:          "autoscaling removed",
+			served:        true,
+			existingOwner: "receiver-uid",
+		},
+		{
+			name:          "autoscaling removed, HorizontalPodAutoscaler of another owner",
+			served:        true,
+			existingOwner: "other-uid",
+			wantMax:       2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := newTestReceiver()
+			instance.UID = "receiver-uid"
+			instance.Spec.Autoscaling = tt.autoscaling
+			r := newTestReconciler(t, instance)
+			if tt.existingOwner != "" {
+				if err := r.client.Create(context.TODO(), newTestAutoscaler(instance, tt.existingOwner)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r.apis.horizontalPodAutoscaler = tt.served
+
+			needToRequeue := false
+			err := r.reconcileAutoscaler(instance, &needToRequeue)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("reconcileAutoscaler() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{}
+			err = r.client.Get(context.TODO(), types.NamespacedName{Name: res.ResourceNamesFor(instance).Deployment, Namespace: testNamespace}, hpa)
+			if tt.wantMax == 0 {
+				if !errors.IsNotFound(err) {
+					t.Errorf("HorizontalPodAutoscaler error = %v, want not found", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("HorizontalPodAutoscaler error = %v", err)
+			}
+			if hpa.Spec.MaxReplicas != tt.wantMax {
+				t.Errorf("maxReplicas = %d, want %d", hpa.Spec.MaxReplicas, tt.wantMax)
+			}
+			if tt.autoscaling != nil && (hpa.Spec.MinReplicas == nil || *hpa.Spec.MinReplicas != minReplicas ||
+				len(hpa.Spec.Metrics) != 1 || hpa.Spec.ScaleTargetRef.Name != res.ResourceNamesFor(instance).Deployment) {
+				t.Errorf("HorizontalPodAutoscaler spec = %+v, want minReplicas %d, one metric and the receiver Deployment",
+					hpa.Spec, minReplicas)
+			}
+		})
+	}
+}
+
+func TestDeploymentReplicas(t *testing.T) {
+	replicas := int32(3)
+	instance := newTestReceiver()
+	instance.Spec.Replicas = &replicas
+	r := newTestReconciler(t, instance)
+
+	deployment, err := r.deploymentForReceiver(instance, "")
+	if err != nil {
+		t.Fatalf("deploymentForReceiver() error = %v", err)
+	}
+	if deployment.Spec.Replicas == nil || *deployment.Spec.Replicas != replicas {
+		t.Errorf("replicas = %v, want %d", deployment.Spec.Replicas, replicas)
+	}
+
+	// the HorizontalPodAutoscaler sets the replicas
+	instance.Spec.Autoscaling = &operatorv1beta1.AutoscalingSpec{MaxReplicas: 5}
+	deployment, err = r.deploymentForReceiver(instance, "")
+	if err != nil {
+		t.Fatalf("deploymentForReceiver() error = %v", err)
+	}
+	if deployment.Spec.Replicas != nil {
+		t.Errorf("replicas = %d with autoscaling, want nil", *deployment.Spec.Replicas)
+	}
+}
+
+func TestReconcilePodDisruptionBudget(t *testing.T) {
+	one := int32(1)
+	three := int32(3)
+	maxUnavailable := intstr.FromString("50%")
+
+	tests := []struct {
+		name   string
+		gvk    schema.GroupVersionKind
+		mutate func(s *operatorv1beta1.MeteringReceiverSpec)
+		// existing creates a PodDisruptionBudget controlled by the MeteringReceiver before the reconcile
+		existing bool
+		want     bool
+	}{
+		{
+			name:   "API not served",
+			mutate: func(s *operatorv1beta1.MeteringReceiverSpec) { s.Replicas = &three },
+		},
+		{
+			name: "one replica",
+			gvk:  res.PodDisruptionBudgetGroupVersionKinds[0],
+		},
+		{
+			name:   "policy/v1 with three replicas",
+			gvk:    res.PodDisruptionBudgetGroupVersionKinds[0],
+			mutate: func(s *operatorv1beta1.MeteringReceiverSpec) { s.Replicas = &three },
+			want:   true,
+		},
+		{
+			name:   "policy/v1beta1 with three replicas",
+			gvk:    res.PodDisruptionBudgetGroupVersionKinds[1],
+			mutate: func(s *operatorv1beta1.MeteringReceiverSpec) { s.Replicas = &three },
+			want:   true,
+		},
+		{
+			name: "autoscaling from three replicas",
+			gvk:  res.PodDisruptionBudgetGroupVersionKinds[0],
+			mutate: func(s *operatorv1beta1.MeteringReceiverSpec) {
+				s.Replicas = &one
+				s.Autoscaling = &operatorv1beta1.AutoscalingSpec{MinReplicas: &three, MaxReplicas: 5}
+			},
+			want: true,
+		},
+		{
+			name: "autoscaling from one replica",
+			gvk:  res.PodDisruptionBudgetGroupVersionKinds[0],
+			mutate: func(s *operatorv1beta1.MeteringReceiverSpec) {
+				s.Replicas = &three
+				s.Autoscaling = &operatorv1beta1.AutoscalingSpec{MinReplicas: &one, MaxReplicas: 5}
+			},
+			existing: true,
+		},
+		{
+			name:     "scaled down to one replica",
+			gvk:      res.PodDisruptionBudgetGroupVersionKinds[0],
+			existing: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := newTestReceiver()
+			if tt.mutate != nil {
+				tt.mutate(&instance.Spec)
+			}
+			instance.Spec.PodDisruptionBudget = &operatorv1beta1.PodDisruptionBudgetSpec{MaxUnavailable: &maxUnavailable}
+			r := newTestReconciler(t, instance)
+			r.apis.podDisruptionBudget = tt.gvk
+			name := types.NamespacedName{Name: res.ResourceNamesFor(instance).Deployment, Namespace: testNamespace}
+			if tt.existing {
+				pdb, err := res.BuildPodDisruptionBudget(tt.gvk, testNamespace, name.Name, nil, nil, &maxUnavailable)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := controllerutil.SetControllerReference(instance, pdb, r.scheme); err != nil {
+					t.Fatal(err)
+				}
+				if err := r.client.Create(context.TODO(), pdb); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			needToRequeue := false
+			if err := r.reconcilePodDisruptionBudget(instance, &needToRequeue); err != nil {
+				t.Fatalf("reconcilePodDisruptionBudget() error = %v", err)
+			}
+			if tt.gvk.Empty() {
+				return
+			}
+
+			pdb := res.NewPodDisruptionBudget(tt.gvk)
+			err := r.client.Get(context.TODO(), name, pdb)
+			if !tt.want {
+				if !errors.IsNotFound(err) {
+					t.Errorf("PodDisruptionBudget error = %v, want not found", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PodDisruptionBudget error = %v", err)
+			}
+			if got, _, _ := unstructured.NestedString(pdb.Object, "spec", "maxUnavailable"); got != "50%" {
+				t.Errorf("maxUnavailable = %q, want 50%%", got)
+			}
+			selector, _, _ := unstructured.NestedStringMap(pdb.Object, "spec", "selector", "matchLabels")
+			if !reflect.DeepEqual(selector, res.LabelsForSelector(res.ReceiverDeploymentName, meteringReceiverCrType, instance.Name)) {
+				t.Errorf("selector = %v, want the receiver pods", selector)
+			}
+		})
+	}
+}
+
+func TestReconcileLoggingConfigMap(t *testing.T) {
+	instance := newTestReceiver()
+	names := res.ResourceNamesFor(instance)
+	r := newTestReconciler(t, instance)
+	verboseInit := false
+
+	// each step reconciles the logging ConfigMap of the spec after the previous step
+	steps := []struct {
+		name        string
+		logging     operatorv1beta1.LoggingSpec
+		wantChanged bool
+	}{
+		{
+			name:        "created",
+			logging:     operatorv1beta1.LoggingSpec{Level: operatorv1beta1.LogLevelInfo},
+			wantChanged: true,
+		},
+		{
+			name:    "unchanged",
+			logging: operatorv1beta1.LoggingSpec{Level: operatorv1beta1.LogLevelInfo},
+		},
+		{
+			name:        "level changed",
+			logging:     operatorv1beta1.LoggingSpec{Level: operatorv1beta1.LogLevelDebug},
+			wantChanged: true,
+		},
+		{
+			name: "module level added",
+			logging: operatorv1beta1.LoggingSpec{
+				Level:   operatorv1beta1.LogLevelDebug,
+				Modules: map[string]operatorv1beta1.LogLevel{"mongodb": operatorv1beta1.LogLevelTrace},
+			},
+			wantChanged: true,
+		},
+		{
+			name: "verbose init is not in the logging file",
+			logging: operatorv1beta1.LoggingSpec{
+				Level:       operatorv1beta1.LogLevelDebug,
+				Modules:     map[string]operatorv1beta1.LogLevel{"mongodb": operatorv1beta1.LogLevelTrace},
+				VerboseInit: &verboseInit,
+			},
+		},
+	}
+	var previousHash string
+	for _, step := range steps {
+		instance.Spec.Logging = step.logging
+		needToRequeue := false
+		hash, err := r.reconcileLoggingConfigMap(instance, &needToRequeue)
+		if err != nil {
+			t.Fatalf("%s: reconcileLoggingConfigMap() error = %v", step.name, err)
+		}
+		if changed := hash != previousHash; changed != step.wantChanged {
+			t.Errorf("%s: hash changed = %v, want %v", step.name, changed, step.wantChanged)
+		}
+		previousHash = hash
+
+		// the ConfigMap has the file of the returned hash
+		want, wantHash, err := res.BuildLoggingConfigMap(testNamespace, names.LoggingConfigMap, res.ReceiverDeploymentName,
+			"loglevel", step.logging)
+		if err != nil {
+			t.Fatalf("%s: BuildLoggingConfigMap() error = %v", step.name, err)
+		}
+		if hash != wantHash {
+			t.Errorf("%s: hash = %s, want %s", step.name, hash, wantHash)
+		}
+		configMap := &corev1.ConfigMap{}
+		err = r.client.Get(context.TODO(), types.NamespacedName{Name: names.LoggingConfigMap, Namespace: testNamespace}, configMap)
+		if err != nil {
+			t.Fatalf("%s: get ConfigMap error = %v", step.name, err)
+		}
+		if !reflect.DeepEqual(configMap.Data, want.Data) {
+			t.Errorf("%s: ConfigMap data = %v, want %v", step.name, configMap.Data, want.Data)
+		}
+
+		// the pods are rolled with the hash
+		deployment, err := r.deploymentForReceiver(instance, hash)
+		if err != nil {
+			t.Fatalf("%s: deploymentForReceiver() error = %v", step.name, err)
+		}
+		if got := deployment.Spec.Template.Annotations[res.LoggingConfigHashAnnotation]; got != hash {
+			t.Errorf("%s: pod annotation %s = %s, want %s", step.name, res.LoggingConfigHashAnnotation, got, hash)
+		}
+	}
+}
+
+func TestMaxConcurrentReconciles(t *testing.T) {
+	if value, ok := os.LookupEnv(maxConcurrentReconcilesEnvVar); ok {
+		defer os.Setenv(maxConcurrentReconcilesEnvVar, value)
+	} else {
+		defer os.Unsetenv(maxConcurrentReconcilesEnvVar)
+	}
+
+	tests := []struct {
+		name  string
+		value string
+		unset bool
+		want  int
+	}{
+		{name: "not set", unset: true, want: 1},
+		{name: "empty", value: "", want: 1},
+		{name: "set", value: "4", want: 4},
+		{name: "zero", value: "0", want: 1},
+		{name: "negative", value: "-1", want: 1},
+		{name: "not a number", value: "four", want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.unset {
+				os.Unsetenv(maxConcurrentReconcilesEnvVar)
+			} else {
+				os.Setenv(maxConcurrentReconcilesEnvVar, tt.value)
+			}
+			if got := maxConcurrentReconciles(); got != tt.want {
+				t.Errorf("maxConcurrentReconciles() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package meteringreceiver
+
+import (
+	res "github.com/ibm/ibm-metering-receiver-operator/pkg/resources"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+)
+
+// availableAPIs are the optional APIs found on the cluster when the operator started
+type availableAPIs struct {
+	// route is true on OpenShift, where route.openshift.io/v1 Routes can be created
+	route bool
+	// podDisruptionBudget is the preferred PodDisruptionBudget kind served by the cluster,
+	// it is empty when none is served
+	podDisruptionBudget schema.GroupVersionKind
+	// horizontalPodAutoscaler is true when autoscaling/v2beta2 HorizontalPodAutoscalers are served
+	horizontalPodAutoscaler bool
+	// certificate is the preferred cert-manager Certificate kind served by the cluster,
+	// it is empty when cert-manager is not installed
+	certificate schema.GroupVersionKind
+	// legacyCertificate is true when certmanager.k8s.io/v1alpha1 Certificates are served
+	legacyCertificate bool
+}
+
+// discoverAPIs checks which of the optional APIs are served by the cluster
+func discoverAPIs(cfg *rest.Config) (availableAPIs, error) {
+	reqLogger := log.WithValues("func", "discoverAPIs")
+
+	apis := availableAPIs{}
+	dc, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		reqLogger.Error(err, "Failed to create discovery client")
+		return apis, err
+	}
+
+	apis.route, err = res.APIExists(dc, res.RouteGroupVersionKind)
+	if err != nil {
+		return apis, err
+	}
+	apis.podDisruptionBudget, err = res.PreferredGroupVersionKind(dc, res.PodDisruptionBudgetGroupVersionKinds)
+	if err != nil {
+		return apis, err
+	}
+	apis.horizontalPodAutoscaler, err = res.APIExists(dc, res.HorizontalPodAutoscalerGroupVersionKind)
+	if err != nil {
+		return apis, err
+	}
+	apis.certificate, err = res.PreferredGroupVersionKind(dc, res.CertificateGroupVersionKinds)
+	if err != nil {
+		return apis, err
+	}
+	apis.legacyCertificate, err = res.APIExists(dc, res.LegacyCertificateGroupVersionKind)
+	if err != nil {
+		return apis, err
+	}
+	reqLogger.Info("Discovered optional APIs", "route", apis.route,
+		"podDisruptionBudget", apis.podDisruptionBudget.GroupVersion().String(),
+		"horizontalPodAutoscaler", apis.horizontalPodAutoscaler,
+		"certificate", apis.certificate.GroupVersion().String(), "legacyCertificate", apis.legacyCertificate)
+	return apis, nil
+}
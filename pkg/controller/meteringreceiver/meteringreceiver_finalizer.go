@@ -0,0 +1,212 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package meteringreceiver
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"time"
+
+	operatorv1beta1 "github.com/ibm/ibm-metering-receiver-operator/pkg/apis/operator/v1beta1"
+	res "github.com/ibm/ibm-metering-receiver-operator/pkg/resources"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// cleanupFinalizer keeps a deleted MeteringReceiver until the operator has applied spec.deletionPolicy
+const cleanupFinalizer = "operator.ibm.com/metering-receiver-cleanup"
+
+// cleanupRequeueDelay is how long to wait for deleted resources to go away before checking them again
+const cleanupRequeueDelay = 5 * time.Second
+
+// cert-manager annotations on the secret of a Certificate
+var certificateNameAnnotations = []string{"cert-manager.io/certificate-name", "certmanager.k8s.io/certificate-name"}
+
+// hasFinalizer returns true if the object has the finalizer
+func hasFinalizer(obj metav1.Object, finalizer string) bool {
+	for _, f := range obj.GetFinalizers() {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// addFinalizer adds the cleanup finalizer to the MeteringReceiver.
+// Only the finalizers are patched, so the defaults set by the operator are not stored in the CR.
+func (r *ReconcileMeteringReceiver) addFinalizer(instance *operatorv1beta1.MeteringReceiver) error {
+	if hasFinalizer(instance, cleanupFinalizer) {
+		return nil
+	}
+	reqLogger := log.WithValues("func", "addFinalizer", "instance.Name", instance.Name)
+	reqLogger.Info("Adding finalizer", "Finalizer", cleanupFinalizer)
+
+	patch := client.MergeFrom(instance.DeepCopy())
+	controllerutil.AddFinalizer(instance, cleanupFinalizer)
+	err := r.client.Patch(context.TODO(), instance, patch)
+	if err != nil {
+		reqLogger.Error(err, "Failed to add finalizer")
+		return err
+	}
+	return nil
+}
+
+// finalize applies spec.deletionPolicy to a deleted MeteringReceiver, then removes the cleanup finalizer.
+// The Deployment, Service and the other owned resources are garbage collected by Kubernetes.
+// With Delete, the Certificate is deleted first so cert-manager does not issue the secret again,
+// then the receiver certificate secrets are deleted. The CleanupComplete condition shows the progress.
+func (r *ReconcileMeteringReceiver) finalize(instance *operatorv1beta1.MeteringReceiver) (reconcile.Result, error) {
+	reqLogger := log.WithValues("func", "finalize", "instance.Name", instance.Name)
+	names := res.ResourceNamesFor(instance)
+
+	if !hasFinalizer(instance, cleanupFinalizer) {
+		return reconcile.Result{}, nil
+	}
+
+	if instance.Spec.DeletionPolicy == operatorv1beta1.DeletionPolicyRetain {
+		reqLogger.Info("Retaining the receiver resources that are not garbage collected")
+		err := r.updateCleanupStatus(instance, corev1.ConditionTrue, reasonResourcesRetained,
+			"The deletion policy is Retain, Secret "+names.CertSecret+" is kept")
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		return reconcile.Result{}, r.removeFinalizer(instance)
+	}
+
+	remaining, err := r.cleanup(instance)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if len(remaining) > 0 {
+		message := "Waiting for " + strings.Join(remaining, ", ") + " to be deleted"
+		reqLogger.Info(message)
+		err = r.updateCleanupStatus(instance, corev1.ConditionFalse, reasonCleanupInProgress, message)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		return reconcile.Result{RequeueAfter: cleanupRequeueDelay}, nil
+	}
+
+	reqLogger.Info("Cleanup completed")
+	err = r.updateCleanupStatus(instance, corev1.ConditionTrue, reasonCleanupComplete, "The receiver resources have been deleted")
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{}, r.removeFinalizer(instance)
+}
+
+// cleanup deletes the Certificates, then the receiver certificate secrets.
+// It returns the resources that still exist. The secrets are only deleted once the Certificates are gone.
+func (r *ReconcileMeteringReceiver) cleanup(instance *operatorv1beta1.MeteringReceiver) ([]string, error) {
+	names := res.ResourceNamesFor(instance)
+	var remaining []string
+	for _, gvk := range r.servedCertificateKinds() {
+		certificate := res.NewCertificate(gvk)
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: names.Certificate, Namespace: instance.Namespace}, certificate)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		if !metav1.IsControlledBy(certificate, instance) {
+			continue
+		}
+		err = r.deleteCertificate(instance, gvk, names.Certificate)
+		if err != nil {
+			return nil, err
+		}
+		remaining = append(remaining, "Certificate "+names.Certificate)
+	}
+	if len(remaining) > 0 {
+		return remaining, nil
+	}
+
+	secretNames := []string{names.CASecret}
+	// the secret of the user is never deleted
+	if instance.Spec.TLS.Mode != operatorv1beta1.TLSModeExternal {
+		secretNames = append([]string{names.CertSecret}, secretNames...)
+	}
+	for _, name := range secretNames {
+		secret, found, err := r.getSecret(instance.Namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		if !found || !isReceiverCertificateSecret(instance, secret) {
+			continue
+		}
+		err = res.DeleteIfExists(r.client, nil, instance.Namespace, name, "Secret", &corev1.Secret{})
+		if err != nil {
+			return nil, err
+		}
+		remaining = append(remaining, "Secret "+name)
+	}
+	return remaining, nil
+}
+
+// isReceiverCertificateSecret returns true if the secret was generated by the operator for the MeteringReceiver,
+// or issued by cert-manager for the receiver Certificate
+func isReceiverCertificateSecret(instance *operatorv1beta1.MeteringReceiver, secret *corev1.Secret) bool {
+	if metav1.IsControlledBy(secret, instance) {
+		return true
+	}
+	for _, annotation := range certificateNameAnnotations {
+		if secret.Annotations[annotation] == res.ResourceNamesFor(instance).Certificate {
+			return true
+		}
+	}
+	return false
+}
+
+// removeFinalizer removes the cleanup finalizer, so Kubernetes deletes the MeteringReceiver
+func (r *ReconcileMeteringReceiver) removeFinalizer(instance *operatorv1beta1.MeteringReceiver) error {
+	reqLogger := log.WithValues("func", "removeFinalizer", "instance.Name", instance.Name)
+	reqLogger.Info("Removing finalizer", "Finalizer", cleanupFinalizer)
+
+	patch := client.MergeFrom(instance.DeepCopy())
+	controllerutil.RemoveFinalizer(instance, cleanupFinalizer)
+	err := r.client.Patch(context.TODO(), instance, patch)
+	if err != nil && !errors.IsNotFound(err) {
+		reqLogger.Error(err, "Failed to remove finalizer")
+		return err
+	}
+	return nil
+}
+
+// updateCleanupStatus sets the CleanupComplete condition and the Terminating phase of a deleted MeteringReceiver
+func (r *ReconcileMeteringReceiver) updateCleanupStatus(instance *operatorv1beta1.MeteringReceiver,
+	conditionStatus corev1.ConditionStatus, reason, message string) error {
+	status := instance.Status.DeepCopy()
+	status.Phase = operatorv1beta1.PhaseTerminating
+	status.SetCondition(operatorv1beta1.ConditionCleanupComplete, conditionStatus, reason, message)
+	if reflect.DeepEqual(*status, instance.Status) {
+		return nil
+	}
+	instance.Status = *status
+	err := r.client.Status().Update(context.TODO(), instance)
+	if err != nil && !errors.IsNotFound(err) {
+		log.Error(err, "Failed to update MeteringReceiver status", "instance.Name", instance.Name)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package meteringreceiver
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	operatorv1beta1 "github.com/ibm/ibm-metering-receiver-operator/pkg/apis/operator/v1beta1"
+	res "github.com/ibm/ibm-metering-receiver-operator/pkg/resources"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestAddFinalizer(t *testing.T) {
+	instance := newTestReceiver()
+	r := newTestReconciler(t, instance.DeepCopy())
+
+	for i := 0; i < 2; i++ {
+		if err := r.addFinalizer(instance); err != nil {
+			t.Fatalf("addFinalizer() error = %v", err)
+		}
+	}
+	stored := &operatorv1beta1.MeteringReceiver{}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: instance.Name, Namespace: testNamespace}, stored); err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.Finalizers) != 1 || stored.Finalizers[0] != cleanupFinalizer {
+		t.Errorf("finalizers = %v, want [%s]", stored.Finalizers, cleanupFinalizer)
+	}
+}
+
+func TestFinalize(t *testing.T) {
+	controller := true
+	newSecret := func(instance *operatorv1beta1.MeteringReceiver, name string, owned bool, annotations map[string]string) *corev1.Secret {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace, Annotations: annotations},
+		}
+		if owned {
+			secret.OwnerReferences = []metav1.OwnerReference{{
+				APIVersion: operatorv1beta1.SchemeGroupVersion.String(),
+				Kind:       "MeteringReceiver",
+				Name:       instance.Name,
+				UID:        instance.UID,
+				Controller: &controller,
+			}}
+		}
+		return secret
+	}
+	newCertificate := func(instance *operatorv1beta1.MeteringReceiver, owned bool) runtime.Object {
+		certificate := newTestCertificate(instance, corev1.ConditionTrue)
+		if owned {
+			certificate.SetOwnerReferences(newSecret(instance, "", true, nil).OwnerReferences)
+		}
+		return certificate
+	}
+
+	tests := []struct {
+		name           string
+		deletionPolicy operatorv1beta1.DeletionPolicy
+		mode           operatorv1beta1.TLSMode
+		// objects returns the objects that exist when the MeteringReceiver is deleted
+		objects func(instance *operatorv1beta1.MeteringReceiver) []runtime.Object
+		// wantRequeues is the number of times finalize waits for deleted resources
+		wantRequeues int
+		wantReason   string
+		// wantCertSecret is true when the receiver certificate secret is kept
+		wantCertSecret bool
+		wantNoCert     bool
+	}{
+		{
+			name:           "retain",
+			deletionPolicy: operatorv1beta1.DeletionPolicyRetain,
+			mode:           operatorv1beta1.TLSModeCertManager,
+			objects: func(instance *operatorv1beta1.MeteringReceiver) []runtime.Object {
+				return []runtime.Object{
+					newCertificate(instance, true),
+					newSecret(instance, res.ResourceNamesFor(instance).CertSecret, false,
+						map[string]string{certificateNameAnnotations[0]: res.ResourceNamesFor(instance).Certificate}),
+				}
+			},
+			wantReason:     reasonResourcesRetained,
+			wantCertSecret: true,
+		},
+		{
+			name:           "delete the Certificate, then the secret it issued",
+			deletionPolicy: operatorv1beta1.DeletionPolicyDelete,
+			mode:           operatorv1beta1.TLSModeCertManager,
+			objects: func(instance *operatorv1beta1.MeteringReceiver) []runtime.Object {
+				return []runtime.Object{
+					newCertificate(instance, true),
+					newSecret(instance, res.ResourceNamesFor(instance).CertSecret, false,
+						map[string]string{certificateNameAnnotations[0]: res.ResourceNamesFor(instance).Certificate}),
+				}
+			},
+			wantRequeues: 2,
+			wantReason:   reasonCleanupComplete,
+			wantNoCert:   true,
+		},
+		{
+			name:           "delete the secrets generated by the operator",
+			deletionPolicy: operatorv1beta1.DeletionPolicyDelete,
+			mode:           operatorv1beta1.TLSModeOperator,
+			objects: func(instance *operatorv1beta1.MeteringReceiver) []runtime.Object {
+				names := res.ResourceNamesFor(instance)
+				return []runtime.Object{
+					newSecret(instance, names.CertSecret, true, nil),
+					newSecret(instance, names.CASecret, true, nil),
+				}
+			},
+			wantRequeues: 1,
+			wantReason:   reasonCleanupComplete,
+		},
+		{
+			name:           "keep the resources of others",
+			deletionPolicy: operatorv1beta1.DeletionPolicyDelete,
+			mode:           operatorv1beta1.TLSModeCertManager,
+			objects: func(instance *operatorv1beta1.MeteringReceiver) []runtime.Object {
+				return []runtime.Object{
+					newCertificate(instance, false),
+					newSecret(instance, res.ResourceNamesFor(instance).CertSecret, false, nil),
+				}
+			},
+			wantReason:     reasonCleanupComplete,
+			wantCertSecret: true,
+		},
+		{
+			name:           "keep the secret of the user",
+			deletionPolicy: operatorv1beta1.DeletionPolicyDelete,
+			mode:           operatorv1beta1.TLSModeExternal,
+			objects: func(instance *operatorv1beta1.MeteringReceiver) []runtime.Object {
+				return []runtime.Object{newSecret(instance, res.ResourceNamesFor(instance).CertSecret, true, nil)}
+			},
+			wantReason:     reasonCleanupComplete,
+			wantCertSecret: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := newTestReceiver()
+			instance.UID = "receiver-uid"
+			instance.Finalizers = []string{cleanupFinalizer}
+			instance.Spec.DeletionPolicy = tt.deletionPolicy
+			instance.Spec.TLS.Mode = tt.mode
+			r := newTestReconciler(t, append(tt.objects(instance), instance.DeepCopy())...)
+
+			requeues := 0
+			for {
+				result, err := r.finalize(instance)
+				if err != nil {
+					t.Fatalf("finalize() error = %v", err)
+				}
+				if result.RequeueAfter == 0 {
+					break
+				}
+				if requeues++; requeues > tt.wantRequeues {
+					t.Fatalf("finalize() requeued %d times, want %d", requeues, tt.wantRequeues)
+				}
+				if condition := instance.Status.GetCondition(operatorv1beta1.ConditionCleanupComplete); condition == nil ||
+					condition.Reason != reasonCleanupInProgress {
+					t.Errorf("CleanupComplete condition = %+v while waiting, want reason %s", condition, reasonCleanupInProgress)
+				}
+			}
+			if requeues != tt.wantRequeues {
+				t.Errorf("finalize() requeued %d times, want %d", requeues, tt.wantRequeues)
+			}
+
+			if hasFinalizer(instance, cleanupFinalizer) {
+				t.Error("finalizer not removed")
+			}
+			if instance.Status.Phase != operatorv1beta1.PhaseTerminating {
+				t.Errorf("Phase = %v, want %v", instance.Status.Phase, operatorv1beta1.PhaseTerminating)
+			}
+			if condition := instance.Status.GetCondition(operatorv1beta1.ConditionCleanupComplete); condition == nil ||
+				condition.Reason != tt.wantReason {
+				t.Errorf("CleanupComplete condition = %+v, want reason %s", condition, tt.wantReason)
+			}
+
+			secrets := &corev1.SecretList{}
+			if err := r.client.List(context.TODO(), secrets); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, secret := range secrets.Items {
+				got = append(got, secret.Name)
+			}
+			want := []string(nil)
+			if tt.wantCertSecret {
+				want = []string{res.ResourceNamesFor(instance).CertSecret}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("secrets = %v, want %v", got, want)
+			}
+			certificate := res.NewCertificate(res.CertificateGroupVersionKinds[0])
+			err := r.client.Get(context.TODO(), types.NamespacedName{Name: res.ResourceNamesFor(instance).Certificate, Namespace: testNamespace}, certificate)
+			if tt.wantNoCert && !errors.IsNotFound(err) {
+				t.Errorf("Certificate error = %v, want not found", err)
+			}
+		})
+	}
+}
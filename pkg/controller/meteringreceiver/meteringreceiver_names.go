@@ -0,0 +1,80 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package meteringreceiver
+
+import (
+	"context"
+
+	operatorv1beta1 "github.com/ibm/ibm-metering-receiver-operator/pkg/apis/operator/v1beta1"
+	res "github.com/ibm/ibm-metering-receiver-operator/pkg/resources"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ensureResourceNaming sets the resource naming annotation of the MeteringReceiver when it is not set.
+// A CR that already owns the receiver Deployment or Service with the fixed names keeps them,
+// so upgrading the operator does not create a second receiver. Other CRs get names derived from their name.
+// Only the annotations are patched, so the defaults set by the operator are not stored in the CR.
+func (r *ReconcileMeteringReceiver) ensureResourceNaming(instance *operatorv1beta1.MeteringReceiver) error {
+	if _, ok := instance.Annotations[operatorv1beta1.ResourceNamingAnnotation]; ok {
+		return nil
+	}
+	reqLogger := log.WithValues("func", "ensureResourceNaming", "instance.Name", instance.Name)
+
+	naming := operatorv1beta1.ResourceNamingInstance
+	legacyObjects := []struct {
+		name string
+		obj  runtime.Object
+	}{
+		{res.ReceiverDeploymentName, &appsv1.Deployment{}},
+		{res.ReceiverServiceName, &corev1.Service{}},
+	}
+	for _, legacy := range legacyObjects {
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: legacy.name, Namespace: instance.Namespace}, legacy.obj)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			reqLogger.Error(err, "Failed to get the receiver objects with the fixed names")
+			return err
+		}
+		if metav1.IsControlledBy(legacy.obj.(metav1.Object), instance) {
+			naming = operatorv1beta1.ResourceNamingLegacy
+			break
+		}
+	}
+
+	reqLogger.Info("Setting resource naming", "Naming", naming)
+	patch := client.MergeFrom(instance.DeepCopy())
+	annotations := instance.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[operatorv1beta1.ResourceNamingAnnotation] = naming
+	instance.SetAnnotations(annotations)
+	err := r.client.Patch(context.TODO(), instance, patch)
+	if err != nil {
+		reqLogger.Error(err, "Failed to set resource naming")
+		return err
+	}
+	return nil
+}
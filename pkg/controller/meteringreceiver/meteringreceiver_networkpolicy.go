@@ -0,0 +1,291 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package meteringreceiver
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+
+	operatorv1beta1 "github.com/ibm/ibm-metering-receiver-operator/pkg/apis/operator/v1beta1"
+	res "github.com/ibm/ibm-metering-receiver-operator/pkg/resources"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// namespaceNameLabel is set by Kubernetes 1.21 and newer on every namespace, with the name of the namespace
+const namespaceNameLabel = "kubernetes.io/metadata.name"
+
+// openShiftIngressPolicyGroupLabel selects the namespace of the OpenShift router
+var openShiftIngressPolicyGroupLabel = map[string]string{"network.openshift.io/policy-group": "ingress"}
+
+// Check if the NetworkPolicies already exist, if not create new ones.
+// The NetworkPolicies are deleted when they are not enabled.
+func (r *ReconcileMeteringReceiver) reconcileNetworkPolicies(instance *operatorv1beta1.MeteringReceiver, needToRequeue *bool) error {
+	reqLogger := log.WithValues("func", "reconcileNetworkPolicies", "instance.Name", instance.Name)
+	names := res.ResourceNamesFor(instance)
+
+	if instance.Spec.NetworkPolicy == nil || !instance.Spec.NetworkPolicy.Enabled {
+		for _, name := range []string{names.IngressNetworkPolicy, names.EgressNetworkPolicy} {
+			err := res.DeleteIfExists(r.client, instance, instance.Namespace, name, "NetworkPolicy", &networkingv1.NetworkPolicy{})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	newPolicies, openRules, err := r.networkPoliciesForReceiver(instance)
+	if err != nil {
+		return err
+	}
+	if len(openRules) > 0 {
+		message := "NetworkPolicy rules that can't be narrowed: " + strings.Join(openRules, "; ")
+		reqLogger.Info(message)
+		// only emit the Event when the spec changes, not on every reconcile
+		if instance.Status.ObservedGeneration != instance.Generation {
+			r.recorder.Event(instance, corev1.EventTypeWarning, reasonNetworkPolicyNotNarrowed, message)
+		}
+	}
+
+	for _, newPolicy := range newPolicies {
+		// Set Metering instance as the owner and controller of the NetworkPolicy
+		err := controllerutil.SetControllerReference(instance, newPolicy, r.scheme)
+		if err != nil {
+			reqLogger.Error(err, "Failed to set owner for NetworkPolicy", "NetworkPolicy.Name", newPolicy.Name)
+			return err
+		}
+		err = res.ReconcileNetworkPolicy(r.client, instance.Namespace, newPolicy.Name, "Receiver", newPolicy, needToRequeue)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// networkPoliciesForReceiver returns the Receiver NetworkPolicy objects.
+// The ingress policy allows the metering data from the clients in spec.networkPolicy.from and the kubelet probes.
+// The egress policy allows the connections to MongoDB and to DNS.
+// openRules describes the rules that allow all peers because the defaults can't be narrowed.
+func (r *ReconcileMeteringReceiver) networkPoliciesForReceiver(
+	instance *operatorv1beta1.MeteringReceiver) (policies []*networkingv1.NetworkPolicy, openRules []string, err error) {
+	names := res.ResourceNamesFor(instance)
+	metaLabels := res.LabelsForMetadata(res.ReceiverDeploymentName)
+	selectorLabels := res.LabelsForSelector(res.ReceiverDeploymentName, meteringReceiverCrType, instance.Name)
+	networkPolicy := instance.Spec.NetworkPolicy
+	mongoDB := instance.Spec.MongoDB
+
+	tcp := corev1.ProtocolTCP
+	udp := corev1.ProtocolUDP
+	receiverPort := intstr.FromInt(int(res.ReceiverContainerPort))
+	probePort := intstr.FromInt(int(res.ReceiverProbePort))
+	dnsPort := intstr.FromInt(53)
+
+	// the ports of the MongoDB hosts, or spec.mongodb.port when the hosts are in the connection URI
+	endpoints := mongoDB.Endpoints()
+	mongoDBPorts := []networkingv1.NetworkPolicyPort{}
+	seenPorts := map[int32]bool{}
+	for _, endpoint := range endpoints {
+		if !seenPorts[endpoint.Port] {
+			seenPorts[endpoint.Port] = true
+			port := intstr.FromInt(int(endpoint.Port))
+			mongoDBPorts = append(mongoDBPorts, networkingv1.NetworkPolicyPort{Protocol: &tcp, Port: &port})
+		}
+	}
+	if len(mongoDBPorts) == 0 {
+		port := intstr.FromInt(int(mongoDB.Port))
+		mongoDBPorts = append(mongoDBPorts, networkingv1.NetworkPolicyPort{Protocol: &tcp, Port: &port})
+	}
+
+	from := networkPolicy.From
+	if len(from) == 0 {
+		var reason string
+		from, reason = r.defaultReceiverClients(instance)
+		if reason != "" {
+			openRules = append(openRules, "port 5000 is allowed from all clients because "+reason+
+				", set spec.networkPolicy.from to restrict it")
+		}
+	}
+
+	mongoDBTo := networkPolicy.MongoDBTo
+	if len(mongoDBTo) == 0 {
+		var reason string
+		mongoDBTo, reason, err = r.defaultMongoDBPeers(instance, endpoints)
+		if err != nil {
+			return nil, nil, err
+		}
+		if reason != "" {
+			openRules = append(openRules, "the MongoDB ports are allowed to all destinations because "+reason+
+				", set spec.networkPolicy.mongoDBTo to restrict them")
+		}
+	}
+
+	ingressPolicy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      names.IngressNetworkPolicy,
+			Namespace: instance.Namespace,
+			Labels:    metaLabels,
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: selectorLabels},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{
+					Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &receiverPort}},
+					From:  from,
+				},
+				{
+					Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &probePort}},
+				},
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+		},
+	}
+
+	egressPolicy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      names.EgressNetworkPolicy,
+			Namespace: instance.Namespace,
+			Labels:    metaLabels,
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: selectorLabels},
+			Egress: []networkingv1.NetworkPolicyEgressRule{
+				{
+					Ports: mongoDBPorts,
+					To:    mongoDBTo,
+				},
+				{
+					Ports: []networkingv1.NetworkPolicyPort{
+						{Protocol: &udp, Port: &dnsPort},
+						{Protocol: &tcp, Port: &dnsPort},
+					},
+				},
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+		},
+	}
+	return []*networkingv1.NetworkPolicy{ingressPolicy, egressPolicy}, openRules, nil
+}
+
+// defaultReceiverClients returns the peers allowed to send metering data when spec.networkPolicy.from is empty:
+// the pods of the CR namespace, where the metering sender runs, the pods of the operator namespace,
+// and the OpenShift router when the receiver is exposed with a Route.
+// When the receiver is exposed by an Ingress or a NodePort or LoadBalancer Service, the clients can't be
+// narrowed, so it returns no peers and the reason.
+func (r *ReconcileMeteringReceiver) defaultReceiverClients(
+	instance *operatorv1beta1.MeteringReceiver) ([]networkingv1.NetworkPolicyPeer, string) {
+	if instance.Spec.Ingress != nil {
+		return nil, "the receiver is exposed with an Ingress"
+	}
+	if instance.Spec.Service.Type == corev1.ServiceTypeNodePort || instance.Spec.Service.Type == corev1.ServiceTypeLoadBalancer {
+		return nil, "the receiver Service is of type " + string(instance.Spec.Service.Type)
+	}
+
+	from := []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}}
+	if r.operatorNamespace != "" && r.operatorNamespace != instance.Namespace {
+		from = append(from, networkingv1.NetworkPolicyPeer{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{namespaceNameLabel: r.operatorNamespace}},
+		})
+	}
+	if instance.Spec.Exposure != nil && instance.Spec.Exposure.Type == operatorv1beta1.ExposureTypeRoute {
+		from = append(from, networkingv1.NetworkPolicyPeer{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: openShiftIngressPolicyGroupLabel},
+		})
+	}
+	return from, ""
+}
+
+// defaultMongoDBPeers returns the peers allowed for the MongoDB connections when spec.networkPolicy.mongoDBTo is empty.
+// The hosts that are IP addresses are matched by an IP block, and the hosts that are names of Services of the CR
+// namespace, or of their pods, are matched by the selector of the Service.
+// When a host can't be matched, it returns no peers and the reason.
+func (r *ReconcileMeteringReceiver) defaultMongoDBPeers(instance *operatorv1beta1.MeteringReceiver,
+	endpoints []operatorv1beta1.MongoDBEndpoint) ([]networkingv1.NetworkPolicyPeer, string, error) {
+	if len(endpoints) == 0 {
+		return nil, "the MongoDB hosts are in spec.mongodb.uriSecretRef", nil
+	}
+
+	peers := []networkingv1.NetworkPolicyPeer{}
+	for _, endpoint := range endpoints {
+		var peer networkingv1.NetworkPolicyPeer
+		if ip := net.ParseIP(endpoint.Host); ip != nil {
+			cidr := ip.String() + "/32"
+			if ip.To4() == nil {
+				cidr = ip.String() + "/128"
+			}
+			peer = networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: cidr}}
+		} else {
+			serviceName, namespace := serviceForHost(endpoint.Host, instance.Namespace)
+			if serviceName == "" {
+				return nil, "the MongoDB host " + endpoint.Host + " is not a Service of the cluster", nil
+			}
+			// the Services of the other namespaces are not in the cache of the operator
+			if namespace != instance.Namespace {
+				return nil, "the MongoDB host " + endpoint.Host + " is not in the namespace of the CR", nil
+			}
+			service := &corev1.Service{}
+			err := r.client.Get(context.TODO(), types.NamespacedName{Name: serviceName, Namespace: namespace}, service)
+			if errors.IsNotFound(err) {
+				return nil, "the Service of the MongoDB host " + endpoint.Host + " is not found", nil
+			} else if err != nil {
+				return nil, "", err
+			}
+			if len(service.Spec.Selector) == 0 {
+				return nil, "the Service of the MongoDB host " + endpoint.Host + " has no pod selector", nil
+			}
+			peer = networkingv1.NetworkPolicyPeer{PodSelector: &metav1.LabelSelector{MatchLabels: service.Spec.Selector}}
+		}
+		if !containsPeer(peers, peer) {
+			peers = append(peers, peer)
+		}
+	}
+	return peers, "", nil
+}
+
+// serviceForHost returns the Service and namespace of a host name of the cluster DNS:
+// <service>, <service>.<namespace>, or <service>.<namespace>.svc[.<cluster domain>] with an optional pod name in front.
+// It returns an empty service name for the other hosts.
+func serviceForHost(host, instanceNamespace string) (string, string) {
+	labels := strings.Split(strings.TrimSuffix(host, "."), ".")
+	for i, label := range labels {
+		if label == "svc" && i >= 2 {
+			return labels[i-2], labels[i-1]
+		}
+	}
+	switch len(labels) {
+	case 1:
+		return labels[0], instanceNamespace
+	case 2:
+		return labels[0], labels[1]
+	}
+	return "", ""
+}
+
+func containsPeer(peers []networkingv1.NetworkPolicyPeer, peer networkingv1.NetworkPolicyPeer) bool {
+	for i := range peers {
+		if reflect.DeepEqual(peers[i], peer) {
+			return true
+		}
+	}
+	return false
+}
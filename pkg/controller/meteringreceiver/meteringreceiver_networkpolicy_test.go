@@ -0,0 +1,277 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package meteringreceiver
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	operatorv1beta1 "github.com/ibm/ibm-metering-receiver-operator/pkg/apis/operator/v1beta1"
+	res "github.com/ibm/ibm-metering-receiver-operator/pkg/resources"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestNetworkPoliciesForReceiver(t *testing.T) {
+	mongoDBLabels := map[string]string{"app": "icp-mongodb"}
+	mongoDBService := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "mongodb", Namespace: testNamespace},
+		Spec:       corev1.ServiceSpec{Selector: mongoDBLabels},
+	}
+	externalService := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "external-mongodb", Namespace: testNamespace},
+		Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeExternalName, ExternalName: "mongodb.example.com"},
+	}
+	namespacePods := networkingv1.NetworkPolicyPeer{PodSelector: &metav1.LabelSelector{}}
+	operatorPods := networkingv1.NetworkPolicyPeer{
+		NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{namespaceNameLabel: "ibm-common-services"}},
+	}
+	routerPods := networkingv1.NetworkPolicyPeer{
+		NamespaceSelector: &metav1.LabelSelector{MatchLabels: openShiftIngressPolicyGroupLabel},
+	}
+	mongoDBPods := networkingv1.NetworkPolicyPeer{PodSelector: &metav1.LabelSelector{MatchLabels: mongoDBLabels}}
+	ipBlock := func(cidr string) networkingv1.NetworkPolicyPeer {
+		return networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: cidr}}
+	}
+
+	tests := []struct {
+		name              string
+		operatorNamespace string
+		mutate            func(s *operatorv1beta1.MeteringReceiverSpec)
+		wantFrom          []networkingv1.NetworkPolicyPeer
+		wantTo            []networkingv1.NetworkPolicyPeer
+		wantPorts         []int
+		wantOpenRules     []string
+	}{
+		{
+			name:              "defaults",
+			operatorNamespace: "ibm-common-services",
+			wantFrom:          []networkingv1.NetworkPolicyPeer{namespacePods, operatorPods},
+			wantTo:            []networkingv1.NetworkPolicyPeer{mongoDBPods},
+			wantPorts:         []int{27017},
+		},
+		{
+			name:              "operator in the CR namespace",
+			operatorNamespace: testNamespace,
+			wantFrom:          []networkingv1.NetworkPolicyPeer{namespacePods},
+			wantTo:            []networkingv1.NetworkPolicyPeer{mongoDBPods},
+			wantPorts:         []int{27017},
+		},
+		{
+			name: "exposed with a Route",
+			mutate: func(s *operatorv1beta1.MeteringReceiverSpec) {
+				s.Exposure = &operatorv1beta1.ExposureSpec{Type: operatorv1beta1.ExposureTypeRoute}
+			},
+			wantFrom:  []networkingv1.NetworkPolicyPeer{namespacePods, routerPods},
+			wantTo:    []networkingv1.NetworkPolicyPeer{mongoDBPods},
+			wantPorts: []int{27017},
+		},
+		{
+			name: "exposed with an Ingress",
+			mutate: func(s *operatorv1beta1.MeteringReceiverSpec) {
+				s.Ingress = &operatorv1beta1.IngressSpec{Host: "metering.example.com"}
+			},
+			wantTo:        []networkingv1.NetworkPolicyPeer{mongoDBPods},
+			wantPorts:     []int{27017},
+			wantOpenRules: []string{"port 5000"},
+		},
+		{
+			name:          "NodePort Service",
+			mutate:        func(s *operatorv1beta1.MeteringReceiverSpec) { s.Service.Type = corev1.ServiceTypeNodePort },
+			wantTo:        []networkingv1.NetworkPolicyPeer{mongoDBPods},
+			wantPorts:     []int{27017},
+			wantOpenRules: []string{"port 5000"},
+		},
+		{
+			name: "peers in the spec",
+			mutate: func(s *operatorv1beta1.MeteringReceiverSpec) {
+				s.Service.Type = corev1.ServiceTypeLoadBalancer
+				s.MongoDB.Host = "mongodb.example.com"
+				s.NetworkPolicy.From = []networkingv1.NetworkPolicyPeer{ipBlock("10.20.0.0/16")}
+				s.NetworkPolicy.MongoDBTo = []networkingv1.NetworkPolicyPeer{ipBlock("10.30.0.0/16")}
+			},
+			wantFrom:  []networkingv1.NetworkPolicyPeer{ipBlock("10.20.0.0/16")},
+			wantTo:    []networkingv1.NetworkPolicyPeer{ipBlock("10.30.0.0/16")},
+			wantPorts: []int{27017},
+		},
+		{
+			name: "IP addresses",
+			mutate: func(s *operatorv1beta1.MeteringReceiverSpec) {
+				s.MongoDB.Hosts = []string{"10.0.0.1", "10.0.0.2:27018", "[fd00::1]:27018"}
+			},
+			wantFrom:  []networkingv1.NetworkPolicyPeer{namespacePods},
+			wantTo:    []networkingv1.NetworkPolicyPeer{ipBlock("10.0.0.1/32"), ipBlock("10.0.0.2/32"), ipBlock("fd00::1/128")},
+			wantPorts: []int{27017, 27018},
+		},
+		{
+			name: "pods of a headless Service",
+			mutate: func(s *operatorv1beta1.MeteringReceiverSpec) {
+				s.MongoDB.Hosts = []string{
+					"icp-mongodb-0.mongodb." + testNamespace + ".svc.cluster.local",
+					"icp-mongodb-1.mongodb." + testNamespace + ".svc.cluster.local",
+					"mongodb." + testNamespace,
+				}
+			},
+			wantFrom:  []networkingv1.NetworkPolicyPeer{namespacePods},
+			wantTo:    []networkingv1.NetworkPolicyPeer{mongoDBPods},
+			wantPorts: []int{27017},
+		},
+		{
+			name:          "external host",
+			mutate:        func(s *operatorv1beta1.MeteringReceiverSpec) { s.MongoDB.Host = "mongodb.example.com" },
+			wantFrom:      []networkingv1.NetworkPolicyPeer{namespacePods},
+			wantPorts:     []int{27017},
+			wantOpenRules: []string{"mongodb.example.com is not a Service"},
+		},
+		{
+			name:          "Service in another namespace",
+			mutate:        func(s *operatorv1beta1.MeteringReceiverSpec) { s.MongoDB.Host = "mongodb.ibm-common-services.svc" },
+			wantFrom:      []networkingv1.NetworkPolicyPeer{namespacePods},
+			wantPorts:     []int{27017},
+			wantOpenRules: []string{"is not in the namespace of the CR"},
+		},
+		{
+			name:          "Service not found",
+			mutate:        func(s *operatorv1beta1.MeteringReceiverSpec) { s.MongoDB.Host = "icp-mongodb" },
+			wantFrom:      []networkingv1.NetworkPolicyPeer{namespacePods},
+			wantPorts:     []int{27017},
+			wantOpenRules: []string{"is not found"},
+		},
+		{
+			name: "one host can't be matched",
+			mutate: func(s *operatorv1beta1.MeteringReceiverSpec) {
+				s.MongoDB.Hosts = []string{"10.0.0.1", "external-mongodb"}
+			},
+			wantFrom:      []networkingv1.NetworkPolicyPeer{namespacePods},
+			wantPorts:     []int{27017},
+			wantOpenRules: []string{"has no pod selector"},
+		},
+		{
+			name: "URI secret",
+			mutate: func(s *operatorv1beta1.MeteringReceiverSpec) {
+				s.MongoDB.URISecretRef = &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "mongodb-uri"}}
+				s.MongoDB.Port = 27018
+			},
+			wantFrom:      []networkingv1.NetworkPolicyPeer{namespacePods},
+			wantPorts:     []int{27018},
+			wantOpenRules: []string{"uriSecretRef"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := newTestReceiver()
+			instance.Spec.NetworkPolicy = &operatorv1beta1.NetworkPolicySpec{Enabled: true}
+			if tt.mutate != nil {
+				tt.mutate(&instance.Spec)
+			}
+			r := newTestReconciler(t, mongoDBService, externalService)
+			r.operatorNamespace = tt.operatorNamespace
+
+			policies, openRules, err := r.networkPoliciesForReceiver(instance)
+			if err != nil {
+				t.Fatalf("networkPoliciesForReceiver() error = %v", err)
+			}
+			ingress, egress := policies[0].Spec, policies[1].Spec
+			if got := ingress.Ingress[0].From; !reflect.DeepEqual(got, tt.wantFrom) {
+				t.Errorf("ingress from = %+v, want %+v", got, tt.wantFrom)
+			}
+			if len(ingress.Ingress[1].From) != 0 || ingress.Ingress[1].Ports[0].Port.IntValue() != int(res.ReceiverProbePort) {
+				t.Errorf("probe rule = %+v, want port %d from everywhere", ingress.Ingress[1], res.ReceiverProbePort)
+			}
+			if got := egress.Egress[0].To; !reflect.DeepEqual(got, tt.wantTo) {
+				t.Errorf("MongoDB to = %+v, want %+v", got, tt.wantTo)
+			}
+			ports := []int{}
+			for _, port := range egress.Egress[0].Ports {
+				ports = append(ports, port.Port.IntValue())
+			}
+			if !reflect.DeepEqual(ports, tt.wantPorts) {
+				t.Errorf("MongoDB ports = %v, want %v", ports, tt.wantPorts)
+			}
+			if len(openRules) != len(tt.wantOpenRules) {
+				t.Fatalf("open rules = %q, want %q", openRules, tt.wantOpenRules)
+			}
+			for i, want := range tt.wantOpenRules {
+				if !strings.Contains(openRules[i], want) {
+					t.Errorf("open rule = %q, want it to contain %q", openRules[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestReconcileNetworkPolicies(t *testing.T) {
+	instance := newTestReceiver()
+	instance.Spec.NetworkPolicy = &operatorv1beta1.NetworkPolicySpec{Enabled: true}
+	instance.Spec.MongoDB.Host = "mongodb.example.com"
+	r := newTestReconciler(t, instance)
+	recorder := r.recorder.(*record.FakeRecorder)
+	names := res.ResourceNamesFor(instance)
+
+	// a new generation of the CR with a rule that can't be narrowed emits an Event
+	needToRequeue := false
+	if err := r.reconcileNetworkPolicies(instance, &needToRequeue); err != nil {
+		t.Fatalf("reconcileNetworkPolicies() error = %v", err)
+	}
+	if !needToRequeue {
+		t.Error("needToRequeue = false after the NetworkPolicies were created")
+	}
+	for _, name := range []string{names.IngressNetworkPolicy, names.EgressNetworkPolicy} {
+		policy := &networkingv1.NetworkPolicy{}
+		if err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: testNamespace}, policy); err != nil {
+			t.Errorf("NetworkPolicy %s: %v", name, err)
+		}
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, reasonNetworkPolicyNotNarrowed) || !strings.Contains(event, "mongodb.example.com") {
+			t.Errorf("Event = %q, want reason %s about mongodb.example.com", event, reasonNetworkPolicyNotNarrowed)
+		}
+	default:
+		t.Errorf("no %s Event", reasonNetworkPolicyNotNarrowed)
+	}
+
+	// the Event is not emitted again while the generation is the same
+	instance.Status.ObservedGeneration = instance.Generation
+	if err := r.reconcileNetworkPolicies(instance, &needToRequeue); err != nil {
+		t.Fatalf("reconcileNetworkPolicies() error = %v", err)
+	}
+	select {
+	case event := <-recorder.Events:
+		t.Errorf("Event = %q, want none for an observed generation", event)
+	default:
+	}
+
+	// the NetworkPolicies are deleted when they are disabled
+	instance.Spec.NetworkPolicy.Enabled = false
+	if err := r.reconcileNetworkPolicies(instance, &needToRequeue); err != nil {
+		t.Fatalf("reconcileNetworkPolicies() error = %v", err)
+	}
+	for _, name := range []string{names.IngressNetworkPolicy, names.EgressNetworkPolicy} {
+		policy := &networkingv1.NetworkPolicy{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: testNamespace}, policy)
+		if !errors.IsNotFound(err) {
+			t.Errorf("NetworkPolicy %s after it was disabled: error = %v, want not found", name, err)
+		}
+	}
+}
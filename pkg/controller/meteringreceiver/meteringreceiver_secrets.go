@@ -0,0 +1,202 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package meteringreceiver
+
+import (
+	"context"
+	"strings"
+
+	operatorv1beta1 "github.com/ibm/ibm-metering-receiver-operator/pkg/apis/operator/v1beta1"
+	res "github.com/ibm/ibm-metering-receiver-operator/pkg/resources"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// secretRequirement is a secret the receiver pods need and the keys it must contain
+type secretRequirement struct {
+	name string
+	keys []string
+}
+
+// requiredSecrets returns the secrets referenced by the MongoDB settings of the CR,
+// and the receiver certificate secret when it is provided by the user.
+// A secret that is referenced more than once is returned once with all its keys, each key once.
+func requiredSecrets(instance *operatorv1beta1.MeteringReceiver) []secretRequirement {
+	var secrets []secretRequirement
+	add := func(name string, keys ...string) {
+		for i := range secrets {
+			if secrets[i].name == name {
+				for _, key := range keys {
+					if !containsString(secrets[i].keys, key) {
+						secrets[i].keys = append(secrets[i].keys, key)
+					}
+				}
+				return
+			}
+		}
+		secrets = append(secrets, secretRequirement{name: name, keys: keys})
+	}
+
+	spec := instance.Spec
+	mongoDB := spec.MongoDB
+	if mongoDB.URISecretRef != nil {
+		add(mongoDB.URISecretRef.Name, mongoDB.URISecretRef.Key)
+	}
+	if mongoDB.Credentials.IsSet() {
+		add(mongoDB.Credentials.UsernameSecretName(), mongoDB.Credentials.UsernameKey)
+		add(mongoDB.Credentials.PasswordSecretName(), mongoDB.Credentials.PasswordKey)
+	}
+	if mongoDB.TLS.IsEnabled() {
+		add(mongoDB.TLS.CASecretRef.Name, corev1.TLSCertKey)
+		add(mongoDB.TLS.ClientCertSecretRef.Name, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+	}
+	if spec.TLS.Mode == operatorv1beta1.TLSModeExternal {
+		add(res.ResourceNamesFor(instance).CertSecret, "ca.crt", corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+	}
+	return secrets
+}
+
+// checkSecrets returns the state of the secrets referenced by the CR.
+// The state is failed when a secret or a key in it does not exist.
+func (r *ReconcileMeteringReceiver) checkSecrets(instance *operatorv1beta1.MeteringReceiver) (resourceState, error) {
+	var problems []string
+	for _, required := range requiredSecrets(instance) {
+		secret := &corev1.Secret{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: required.name, Namespace: instance.Namespace}, secret)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				problems = append(problems, "Secret "+required.name+" not found")
+				continue
+			}
+			return resourceState{}, err
+		}
+		var missingKeys []string
+		for _, key := range required.keys {
+			if _, ok := secret.Data[key]; !ok {
+				missingKeys = append(missingKeys, key)
+			}
+		}
+		if len(missingKeys) > 0 {
+			problems = append(problems, "Secret "+required.name+" does not have key "+strings.Join(missingKeys, ", "))
+		}
+	}
+
+	if len(problems) > 0 {
+		return resourceState{failed: true, reason: reasonSecretsMissing, message: strings.Join(problems, "; ")}, nil
+	}
+	return resourceState{ready: true}, nil
+}
+
+// contentHashForPodSpec returns the hash of the Secrets and ConfigMaps used by the receiver pods.
+// The logging ConfigMap is left out: its key is rendered from the CR and already hashed by reconcileLoggingConfigMap,
+// and the cached copy can be older than the update that was just made.
+func (r *ReconcileMeteringReceiver) contentHashForPodSpec(instance *operatorv1beta1.MeteringReceiver,
+	podSpec corev1.PodSpec) (string, error) {
+	names := res.ResourceNamesFor(instance)
+	var references []res.PodSpecReference
+	for _, ref := range res.PodSpecReferences(podSpec) {
+		if ref.Kind == "ConfigMap" && ref.Name == names.LoggingConfigMap {
+			continue
+		}
+		references = append(references, ref)
+	}
+	return res.HashPodSpecReferences(r.client, instance.Namespace, references)
+}
+
+// referencedObjectToMeteringReceivers maps a Secret or ConfigMap to the MeteringReceivers in its namespace
+// that use it, so they are reconciled when it is created or changed.
+// A MeteringReceiver uses the object when its receiver pods use it, when it is a secret of the CR,
+// which is checked before the receiver Deployment is created, or when it is the CA generated by the operator.
+func referencedObjectToMeteringReceivers(c client.Client, kind string) handler.ToRequestsFunc {
+	return func(a handler.MapObject) []reconcile.Request {
+		name := a.Meta.GetName()
+		namespace := a.Meta.GetNamespace()
+		reqLogger := log.WithValues("func", "referencedObjectToMeteringReceivers", "Kind", kind, "Name", name)
+
+		instances := &operatorv1beta1.MeteringReceiverList{}
+		err := c.List(context.TODO(), instances, client.InNamespace(namespace))
+		if err != nil {
+			reqLogger.Error(err, "Failed to list MeteringReceivers")
+			return nil
+		}
+
+		var requests []reconcile.Request
+		for i := range instances.Items {
+			instance := &instances.Items[i]
+			instance.Spec.SetDefaults()
+			if usesReferencedObject(c, instance, kind, name) {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+					Name:      instance.Name,
+					Namespace: namespace,
+				}})
+			}
+		}
+		return requests
+	}
+}
+
+// usesReferencedObject returns true if the MeteringReceiver uses the Secret or ConfigMap with the given name
+func usesReferencedObject(c client.Client, instance *operatorv1beta1.MeteringReceiver, kind, name string) bool {
+	reqLogger := log.WithValues("func", "usesReferencedObject", "instance.Name", instance.Name, "Kind", kind, "Name", name)
+	names := res.ResourceNamesFor(instance)
+
+	if kind == "Secret" {
+		// the operator generates the receiver certificate again when its CA secret is deleted
+		if instance.Spec.TLS.Mode == operatorv1beta1.TLSModeOperator && name == names.CASecret {
+			return true
+		}
+		for _, required := range requiredSecrets(instance) {
+			if required.name == name {
+				return true
+			}
+		}
+	}
+
+	deployment := &appsv1.Deployment{}
+	err := c.Get(context.TODO(), types.NamespacedName{Name: names.Deployment, Namespace: instance.Namespace}, deployment)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			reqLogger.Error(err, "Failed to get Receiver Deployment")
+		}
+		return false
+	}
+	if !metav1.IsControlledBy(deployment, instance) {
+		return false
+	}
+	for _, ref := range res.PodSpecReferences(deployment.Spec.Template.Spec) {
+		if ref.Kind == kind && ref.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString returns true if value is in values
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,400 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package meteringreceiver
+
+import (
+	"reflect"
+	"testing"
+
+	operatorv1beta1 "github.com/ibm/ibm-metering-receiver-operator/pkg/apis/operator/v1beta1"
+	res "github.com/ibm/ibm-metering-receiver-operator/pkg/resources"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// newTestSecret returns a secret in the test namespace with the given keys
+func newTestSecret(name string, keys ...string) *corev1.Secret {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Data:       map[string][]byte{},
+	}
+	for _, key := range keys {
+		secret.Data[key] = []byte(key)
+	}
+	return secret
+}
+
+// newTestReceiverWithSpec returns a receiver with the defaults set after mutate changes its spec
+func newTestReceiverWithSpec(mutate func(spec *operatorv1beta1.MeteringReceiverSpec)) *operatorv1beta1.MeteringReceiver {
+	instance := newTestReceiver()
+	instance.Spec = operatorv1beta1.MeteringReceiverSpec{}
+	if mutate != nil {
+		mutate(&instance.Spec)
+	}
+	instance.Spec.SetDefaults()
+	return instance
+}
+
+func TestRequiredSecrets(t *testing.T) {
+	disabled := false
+	tests := []struct {
+		name   string
+		mutate func(spec *operatorv1beta1.MeteringReceiverSpec)
+		want   []secretRequirement
+	}{
+		{
+			name: "defaults",
+			want: []secretRequirement{
+				{name: operatorv1beta1.DefaultMongoDBCredentialsSecret, keys: []string{"user", "password"}},
+				{name: operatorv1beta1.DefaultMongoDBCASecret, keys: []string{"tls.crt"}},
+				{name: operatorv1beta1.DefaultMongoDBClientCertSecret, keys: []string{"tls.crt", "tls.key"}},
+			},
+		},
+		{
+			name: "URI secret without credentials",
+			mutate: func(spec *operatorv1beta1.MeteringReceiverSpec) {
+				spec.MongoDB.URISecretRef = &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "mongodb-uri"}}
+				spec.MongoDB.TLS.Enabled = &disabled
+			},
+			want: []secretRequirement{
+				{name: "mongodb-uri", keys: []string{"uri"}},
+			},
+		},
+		{
+			name: "URI secret with the credentials",
+			mutate: func(spec *operatorv1beta1.MeteringReceiverSpec) {
+				spec.MongoDB.URISecretRef = &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "mongodb"},
+					Key:                  "connection",
+				}
+				spec.MongoDB.Credentials.SecretRef.Name = "mongodb"
+				spec.MongoDB.TLS.Enabled = &disabled
+			},
+			want: []secretRequirement{
+				{name: "mongodb", keys: []string{"connection", "user", "password"}},
+			},
+		},
+		{
+			name: "separate password secret",
+			mutate: func(spec *operatorv1beta1.MeteringReceiverSpec) {
+				spec.MongoDB.Credentials.SecretRef.Name = "mongodb-user"
+				spec.MongoDB.Credentials.PasswordSecretRef = &corev1.LocalObjectReference{Name: "mongodb-password"}
+				spec.MongoDB.Credentials.PasswordKey = "secret"
+				spec.MongoDB.TLS.Enabled = &disabled
+			},
+			want: []secretRequirement{
+				{name: "mongodb-user", keys: []string{"user"}},
+				{name: "mongodb-password", keys: []string{"secret"}},
+			},
+		},
+		{
+			name: "same secret for the MongoDB certificates",
+			mutate: func(spec *operatorv1beta1.MeteringReceiverSpec) {
+				spec.MongoDB.TLS.CASecretRef.Name = "mongodb-tls"
+				spec.MongoDB.TLS.ClientCertSecretRef.Name = "mongodb-tls"
+			},
+			want: []secretRequirement{
+				{name: operatorv1beta1.DefaultMongoDBCredentialsSecret, keys: []string{"user", "password"}},
+				{name: "mongodb-tls", keys: []string{"tls.crt", "tls.key"}},
+			},
+		},
+		{
+			name: "external receiver certificate",
+			mutate: func(spec *operatorv1beta1.MeteringReceiverSpec) {
+				spec.TLS.Mode = operatorv1beta1.TLSModeExternal
+				spec.MongoDB.TLS.Enabled = &disabled
+			},
+			want: []secretRequirement{
+				{name: operatorv1beta1.DefaultMongoDBCredentialsSecret, keys: []string{"user", "password"}},
+				{name: "", keys: []string{"ca.crt", "tls.crt", "tls.key"}},
+			},
+		},
+		{
+			name: "operator receiver certificate",
+			mutate: func(spec *operatorv1beta1.MeteringReceiverSpec) {
+				spec.TLS.Mode = operatorv1beta1.TLSModeOperator
+				spec.MongoDB.TLS.Enabled = &disabled
+			},
+			want: []secretRequirement{
+				{name: operatorv1beta1.DefaultMongoDBCredentialsSecret, keys: []string{"user", "password"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := newTestReceiverWithSpec(tt.mutate)
+			want := append([]secretRequirement(nil), tt.want...)
+			for i := range want {
+				// the receiver certificate secret is named after the instance
+				if want[i].name == "" {
+					want[i].name = res.ResourceNamesFor(instance).CertSecret
+				}
+			}
+			if got := requiredSecrets(instance); !reflect.DeepEqual(got, want) {
+				t.Errorf("requiredSecrets() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestCheckSecrets(t *testing.T) {
+	disabled := false
+	noTLS := func(spec *operatorv1beta1.MeteringReceiverSpec) {
+		spec.MongoDB.TLS.Enabled = &disabled
+	}
+	tests := []struct {
+		name        string
+		mutate      func(spec *operatorv1beta1.MeteringReceiverSpec)
+		objs        []runtime.Object
+		wantReady   bool
+		wantMessage string
+	}{
+		{
+			name: "all secrets exist",
+			objs: []runtime.Object{
+				newTestSecret(operatorv1beta1.DefaultMongoDBCredentialsSecret, "user", "password"),
+				newTestSecret(operatorv1beta1.DefaultMongoDBCASecret, "tls.crt"),
+				newTestSecret(operatorv1beta1.DefaultMongoDBClientCertSecret, "tls.crt", "tls.key"),
+			},
+			wantReady: true,
+		},
+		{
+			name:   "MongoDB certificates not needed without TLS",
+			mutate: noTLS,
+			objs: []runtime.Object{
+				newTestSecret(operatorv1beta1.DefaultMongoDBCredentialsSecret, "user", "password"),
+			},
+			wantReady: true,
+		},
+		{
+			name:        "secret not found",
+			mutate:      noTLS,
+			wantMessage: "Secret " + operatorv1beta1.DefaultMongoDBCredentialsSecret + " not found",
+		},
+		{
+			name:   "keys missing",
+			mutate: noTLS,
+			objs: []runtime.Object{
+				newTestSecret(operatorv1beta1.DefaultMongoDBCredentialsSecret, "username"),
+			},
+			wantMessage: "Secret " + operatorv1beta1.DefaultMongoDBCredentialsSecret + " does not have key user, password",
+		},
+		{
+			name: "every problem is reported",
+			objs: []runtime.Object{
+				newTestSecret(operatorv1beta1.DefaultMongoDBCredentialsSecret, "user", "password"),
+				newTestSecret(operatorv1beta1.DefaultMongoDBClientCertSecret, "tls.crt"),
+			},
+			wantMessage: "Secret " + operatorv1beta1.DefaultMongoDBCASecret + " not found; " +
+				"Secret " + operatorv1beta1.DefaultMongoDBClientCertSecret + " does not have key tls.key",
+		},
+		{
+			name:   "secret in another namespace",
+			mutate: noTLS,
+			objs: []runtime.Object{
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: operatorv1beta1.DefaultMongoDBCredentialsSecret, Namespace: "other"},
+					Data:       map[string][]byte{"user": []byte("user"), "password": []byte("password")},
+				},
+			},
+			wantMessage: "Secret " + operatorv1beta1.DefaultMongoDBCredentialsSecret + " not found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := newTestReceiverWithSpec(tt.mutate)
+			r := newTestReconciler(t, tt.objs...)
+
+			state, err := r.checkSecrets(instance)
+			if err != nil {
+				t.Fatalf("checkSecrets() error = %v", err)
+			}
+			if state.ready != tt.wantReady || state.failed == tt.wantReady {
+				t.Errorf("checkSecrets() ready = %v, failed = %v, want ready %v", state.ready, state.failed, tt.wantReady)
+			}
+			if state.message != tt.wantMessage {
+				t.Errorf("checkSecrets() message = %q, want %q", state.message, tt.wantMessage)
+			}
+			if !tt.wantReady && state.reason != reasonSecretsMissing {
+				t.Errorf("checkSecrets() reason = %q, want %q", state.reason, reasonSecretsMissing)
+			}
+		})
+	}
+}
+
+func TestDeploymentContentHash(t *testing.T) {
+	instance := newTestReceiver()
+	names := res.ResourceNamesFor(instance)
+	newObjects := func() []runtime.Object {
+		loggingConfigMap, _, err := res.BuildLoggingConfigMap(testNamespace, names.LoggingConfigMap, res.ReceiverDeploymentName,
+			"loglevel", instance.Spec.Logging)
+		if err != nil {
+			t.Fatalf("BuildLoggingConfigMap() error = %v", err)
+		}
+		return []runtime.Object{
+			newTestSecret(operatorv1beta1.DefaultMongoDBCredentialsSecret, "user", "password"),
+			newTestSecret(operatorv1beta1.DefaultMongoDBCASecret, "tls.crt"),
+			newTestSecret(operatorv1beta1.DefaultMongoDBClientCertSecret, "tls.crt", "tls.key"),
+			newTestSecret(names.CertSecret, "ca.crt", "tls.crt", "tls.key"),
+			loggingConfigMap,
+		}
+	}
+	contentHash := func(t *testing.T, objs []runtime.Object) string {
+		r := newTestReconciler(t, objs...)
+		deployment, err := r.deploymentForReceiver(instance, "")
+		if err != nil {
+			t.Fatalf("deploymentForReceiver() error = %v", err)
+		}
+		return deployment.Spec.Template.Annotations[res.ContentHashAnnotation]
+	}
+	original := contentHash(t, newObjects())
+	if original == "" {
+		t.Fatalf("annotation %s not set", res.ContentHashAnnotation)
+	}
+
+	tests := []struct {
+		name        string
+		mutate      func(objs []runtime.Object) []runtime.Object
+		wantChanged bool
+	}{
+		{
+			name:   "nothing changed",
+			mutate: func(objs []runtime.Object) []runtime.Object { return objs },
+		},
+		{
+			name: "MongoDB password changed",
+			mutate: func(objs []runtime.Object) []runtime.Object {
+				objs[0].(*corev1.Secret).Data["password"] = []byte("changed")
+				return objs
+			},
+			wantChanged: true,
+		},
+		{
+			name: "receiver certificate renewed",
+			mutate: func(objs []runtime.Object) []runtime.Object {
+				objs[3].(*corev1.Secret).Data["tls.crt"] = []byte("renewed")
+				return objs
+			},
+			wantChanged: true,
+		},
+		{
+			name: "MongoDB CA secret deleted",
+			mutate: func(objs []runtime.Object) []runtime.Object {
+				return append(objs[:1], objs[2:]...)
+			},
+			wantChanged: true,
+		},
+		{
+			name: "logging ConfigMap changed",
+			mutate: func(objs []runtime.Object) []runtime.Object {
+				data := objs[4].(*corev1.ConfigMap).Data
+				for key := range data {
+					data[key] = "changed"
+				}
+				return objs
+			},
+		},
+		{
+			name: "unused secret created",
+			mutate: func(objs []runtime.Object) []runtime.Object {
+				return append(objs, newTestSecret("unused", "key"))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := contentHash(t, tt.mutate(newObjects()))
+			if changed := got != original; changed != tt.wantChanged {
+				t.Errorf("content hash changed = %v, want %v", changed, tt.wantChanged)
+			}
+		})
+	}
+}
+
+func TestUsesReferencedObject(t *testing.T) {
+	instance := newTestReceiverWithSpec(func(spec *operatorv1beta1.MeteringReceiverSpec) {
+		spec.TLS.Mode = operatorv1beta1.TLSModeOperator
+	})
+	names := res.ResourceNamesFor(instance)
+	r := newTestReconciler(t)
+	deployment, err := r.deploymentForReceiver(instance, "")
+	if err != nil {
+		t.Fatalf("deploymentForReceiver() error = %v", err)
+	}
+	notControlled := deployment.DeepCopy()
+	notControlled.OwnerReferences = nil
+
+	tests := []struct {
+		name       string
+		objs       []runtime.Object
+		kind       string
+		objectName string
+		want       bool
+	}{
+		{
+			name:       "MongoDB secret before the Deployment is created",
+			kind:       "Secret",
+			objectName: operatorv1beta1.DefaultMongoDBCredentialsSecret,
+			want:       true,
+		},
+		{
+			name:       "CA generated by the operator",
+			kind:       "Secret",
+			objectName: names.CASecret,
+			want:       true,
+		},
+		{
+			name:       "logging ConfigMap used by the pods",
+			objs:       []runtime.Object{deployment},
+			kind:       "ConfigMap",
+			objectName: names.LoggingConfigMap,
+			want:       true,
+		},
+		{
+			name:       "logging ConfigMap without the Deployment",
+			kind:       "ConfigMap",
+			objectName: names.LoggingConfigMap,
+		},
+		{
+			name:       "Deployment not controlled by the instance",
+			objs:       []runtime.Object{notControlled},
+			kind:       "ConfigMap",
+			objectName: names.LoggingConfigMap,
+		},
+		{
+			name:       "ConfigMap with the name of a MongoDB secret",
+			objs:       []runtime.Object{deployment},
+			kind:       "ConfigMap",
+			objectName: operatorv1beta1.DefaultMongoDBCredentialsSecret,
+		},
+		{
+			name:       "unused secret",
+			objs:       []runtime.Object{deployment},
+			kind:       "Secret",
+			objectName: "unused",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestReconciler(t, tt.objs...).client
+			if got := usesReferencedObject(c, instance, tt.kind, tt.objectName); got != tt.want {
+				t.Errorf("usesReferencedObject() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package meteringreceiver
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	operatorv1beta1 "github.com/ibm/ibm-metering-receiver-operator/pkg/apis/operator/v1beta1"
+	res "github.com/ibm/ibm-metering-receiver-operator/pkg/resources"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Reasons used in the MeteringReceiver conditions
+const (
+	reasonAsExpected           = "AsExpected"
+	reasonReconcileFailed      = "ReconcileFailed"
+	reasonDeploymentNotFound   = "DeploymentNotFound"
+	reasonDeploymentRollingOut = "DeploymentRollingOut"
+	reasonDeploymentFailed     = "DeploymentFailed"
+	reasonReplicasAvailable    = "MinimumReplicasAvailable"
+	reasonReplicasUnavailable  = "MinimumReplicasUnavailable"
+	reasonServiceNotFound      = "ServiceNotFound"
+	reasonCertificateNotFound  = "CertificateNotFound"
+	reasonCertificateNotReady  = "CertificateNotReady"
+	reasonCertificateInvalid   = "CertificateInvalid"
+	reasonCertificateExpired   = "CertificateExpired"
+	reasonSecretsMissing       = "SecretsMissing"
+	reasonCleanupInProgress    = "CleanupInProgress"
+	reasonCleanupComplete      = "CleanupComplete"
+	reasonResourcesRetained    = "ResourcesRetained"
+	// reasonNetworkPolicyNotNarrowed is only used in Events
+	reasonNetworkPolicyNotNarrowed = "NetworkPolicyNotNarrowed"
+)
+
+// progressDeadlineExceededReason is the reason of the Progressing condition of a Deployment
+// whose rollout did not make progress within spec.progressDeadlineSeconds
+const progressDeadlineExceededReason = "ProgressDeadlineExceeded"
+
+// resourceState is the observed state of one of the resources managed for a MeteringReceiver.
+// ready is true when the resource exists and is up to date.
+// failed is true when the resource reported an error that will not go away by itself.
+type resourceState struct {
+	ready   bool
+	failed  bool
+	reason  string
+	message string
+}
+
+// updateStatus sets the conditions, phase and observedGeneration of the MeteringReceiver
+// from the state of the Deployment, Service, Certificate and Secrets, then updates the status if it changed.
+// secretsState is the result of checkSecrets in the same reconcile, so the Secrets are only checked once.
+func (r *ReconcileMeteringReceiver) updateStatus(instance *operatorv1beta1.MeteringReceiver, secretsState resourceState) error {
+	reqLogger := log.WithValues("func", "updateStatus", "instance.Name", instance.Name)
+
+	deploymentState, available, err := r.checkDeployment(instance)
+	if err != nil {
+		return err
+	}
+	serviceState, err := r.checkService(instance)
+	if err != nil {
+		return err
+	}
+	certificateState, err := r.checkCertificate(instance)
+	if err != nil {
+		return err
+	}
+	states := []resourceState{secretsState, deploymentState, serviceState, certificateState}
+
+	status := instance.Status.DeepCopy()
+	status.ObservedGeneration = instance.Generation
+
+	if secretsState.ready {
+		status.SetCondition(operatorv1beta1.ConditionSecretsMissing, corev1.ConditionFalse, reasonAsExpected, "")
+	} else {
+		status.SetCondition(operatorv1beta1.ConditionSecretsMissing, corev1.ConditionTrue, secretsState.reason, secretsState.message)
+	}
+
+	if available {
+		status.SetCondition(operatorv1beta1.ConditionAvailable, corev1.ConditionTrue, reasonReplicasAvailable,
+			"The receiver Deployment has minimum availability")
+	} else {
+		status.SetCondition(operatorv1beta1.ConditionAvailable, corev1.ConditionFalse, deploymentState.reason, deploymentState.message)
+	}
+
+	var failedReason, pendingReason string
+	var failedMessages, pendingMessages []string
+	for _, state := range states {
+		if state.failed {
+			if failedReason == "" {
+				failedReason = state.reason
+			}
+			failedMessages = append(failedMessages, state.message)
+		} else if !state.ready {
+			if pendingReason == "" {
+				pendingReason = state.reason
+			}
+			pendingMessages = append(pendingMessages, state.message)
+		}
+	}
+
+	if failedReason != "" {
+		status.SetCondition(operatorv1beta1.ConditionDegraded, corev1.ConditionTrue, failedReason, strings.Join(failedMessages, "; "))
+	} else {
+		status.SetCondition(operatorv1beta1.ConditionDegraded, corev1.ConditionFalse, reasonAsExpected, "")
+	}
+
+	if failedReason == "" && pendingReason != "" {
+		status.SetCondition(operatorv1beta1.ConditionProgressing, corev1.ConditionTrue, pendingReason, strings.Join(pendingMessages, "; "))
+	} else {
+		status.SetCondition(operatorv1beta1.ConditionProgressing, corev1.ConditionFalse, reasonAsExpected, "")
+	}
+
+	if available && failedReason == "" && pendingReason == "" {
+		status.SetCondition(operatorv1beta1.ConditionReady, corev1.ConditionTrue, reasonAsExpected, "All resources are available and up to date")
+	} else {
+		var reason string
+		if failedReason != "" {
+			reason = failedReason
+		} else if pendingReason != "" {
+			reason = pendingReason
+		} else {
+			reason = deploymentState.reason
+		}
+		status.SetCondition(operatorv1beta1.ConditionReady, corev1.ConditionFalse, reason, "The receiver is not ready")
+	}
+
+	switch {
+	case failedReason != "":
+		status.Phase = operatorv1beta1.PhaseDegraded
+	case status.IsConditionTrue(operatorv1beta1.ConditionReady):
+		status.Phase = operatorv1beta1.PhaseReady
+	case deploymentState.reason == reasonDeploymentNotFound:
+		status.Phase = operatorv1beta1.PhasePending
+	default:
+		status.Phase = operatorv1beta1.PhaseProgressing
+	}
+
+	if reflect.DeepEqual(*status, instance.Status) {
+		return nil
+	}
+	reqLogger.Info("Updating MeteringReceiver status", "Phase", status.Phase)
+	instance.Status = *status
+	err = r.client.Status().Update(context.TODO(), instance)
+	if err != nil {
+		reqLogger.Error(err, "Failed to update MeteringReceiver status")
+		return err
+	}
+	return nil
+}
+
+// reportFailure sets the Degraded condition of the MeteringReceiver when a resource could not be reconciled.
+// The reconcile error is returned to the caller, so an error from the status update is only logged.
+func (r *ReconcileMeteringReceiver) reportFailure(instance *operatorv1beta1.MeteringReceiver, reconcileErr error) {
+	reqLogger := log.WithValues("func", "reportFailure", "instance.Name", instance.Name)
+
+	status := instance.Status.DeepCopy()
+	status.ObservedGeneration = instance.Generation
+	status.SetCondition(operatorv1beta1.ConditionDegraded, corev1.ConditionTrue, reasonReconcileFailed, reconcileErr.Error())
+	status.SetCondition(operatorv1beta1.ConditionReady, corev1.ConditionFalse, reasonReconcileFailed, "The receiver is not ready")
+	status.Phase = operatorv1beta1.PhaseDegraded
+	if reflect.DeepEqual(*status, instance.Status) {
+		return
+	}
+	instance.Status = *status
+	if err := r.client.Status().Update(context.TODO(), instance); err != nil {
+		reqLogger.Error(err, "Failed to update MeteringReceiver status")
+	}
+}
+
+// checkDeployment returns the state of the receiver Deployment and whether it has minimum availability
+func (r *ReconcileMeteringReceiver) checkDeployment(instance *operatorv1beta1.MeteringReceiver) (resourceState, bool, error) {
+	names := res.ResourceNamesFor(instance)
+	deployment := &appsv1.Deployment{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: names.Deployment, Namespace: instance.Namespace}, deployment)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return resourceState{reason: reasonDeploymentNotFound, message: "Deployment " + names.Deployment + " has not been created"},
+				false, nil
+		}
+		return resourceState{}, false, err
+	}
+
+	// the conditions are only about the latest spec once the Deployment controller has observed it,
+	// before that they can be left from the previous rollout
+	observed := deployment.Status.ObservedGeneration == deployment.Generation
+	available := false
+	var failure *appsv1.DeploymentCondition
+	for i, condition := range deployment.Status.Conditions {
+		switch {
+		case condition.Type == appsv1.DeploymentAvailable && condition.Status == corev1.ConditionTrue:
+			available = true
+		case condition.Type == appsv1.DeploymentProgressing && condition.Status == corev1.ConditionFalse &&
+			condition.Reason == progressDeadlineExceededReason && observed,
+			condition.Type == appsv1.DeploymentReplicaFailure && condition.Status == corev1.ConditionTrue:
+			failure = &deployment.Status.Conditions[i]
+		}
+	}
+	if failure != nil {
+		return resourceState{failed: true, reason: reasonDeploymentFailed,
+			message: "Deployment " + deployment.Name + ": " + failure.Message}, available, nil
+	}
+
+	var replicas int32 = 1
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	if deployment.Status.ObservedGeneration < deployment.Generation ||
+		deployment.Status.UpdatedReplicas < replicas ||
+		deployment.Status.Replicas > deployment.Status.UpdatedReplicas ||
+		deployment.Status.AvailableReplicas < deployment.Status.UpdatedReplicas {
+		return resourceState{reason: reasonDeploymentRollingOut, message: "Deployment " + deployment.Name + " is rolling out"},
+			available, nil
+	}
+	if !available {
+		return resourceState{reason: reasonReplicasUnavailable, message: "Deployment " + deployment.Name + " does not have minimum availability"},
+			false, nil
+	}
+	return resourceState{ready: true}, true, nil
+}
+
+// checkService returns the state of the receiver Service
+func (r *ReconcileMeteringReceiver) checkService(instance *operatorv1beta1.MeteringReceiver) (resourceState, error) {
+	names := res.ResourceNamesFor(instance)
+	service := &corev1.Service{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: names.Service, Namespace: instance.Namespace}, service)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return resourceState{reason: reasonServiceNotFound, message: "Service " + names.Service + " has not been created"}, nil
+		}
+		return resourceState{}, err
+	}
+	return resourceState{ready: true}, nil
+}
+
+// checkCertificate returns the state of the receiver Certificate,
+// or of the receiver certificate secret when spec.tls.mode is not certManager
+func (r *ReconcileMeteringReceiver) checkCertificate(instance *operatorv1beta1.MeteringReceiver) (resourceState, error) {
+	names := res.ResourceNamesFor(instance)
+	if instance.Spec.TLS.Mode != operatorv1beta1.TLSModeCertManager {
+		return r.checkCertificateSecret(instance)
+	}
+	if r.apis.certificate.Empty() {
+		return resourceState{failed: true, reason: reasonCertificateNotFound,
+			message: "Certificate " + names.Certificate + " cannot be created because cert-manager is not installed"}, nil
+	}
+	certificate := res.NewCertificate(r.apis.certificate)
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: names.Certificate, Namespace: instance.Namespace}, certificate)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return resourceState{reason: reasonCertificateNotFound, message: "Certificate " + names.Certificate + " has not been created"}, nil
+		}
+		return resourceState{}, err
+	}
+	// both cert-manager APIs have the same Ready condition
+	conditions, _, _ := unstructured.NestedSlice(certificate.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["type"] != "Ready" {
+			continue
+		}
+		if condition["status"] == string(corev1.ConditionTrue) {
+			return resourceState{ready: true}, nil
+		}
+		message, _ := condition["message"].(string)
+		return resourceState{reason: reasonCertificateNotReady,
+			message: "Certificate " + certificate.GetName() + " is not ready: " + message}, nil
+	}
+	return resourceState{reason: reasonCertificateNotReady, message: "Certificate " + certificate.GetName() + " is not ready"}, nil
+}
@@ -0,0 +1,411 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package meteringreceiver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	operatorv1beta1 "github.com/ibm/ibm-metering-receiver-operator/pkg/apis/operator/v1beta1"
+	res "github.com/ibm/ibm-metering-receiver-operator/pkg/resources"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const testNamespace = "metering"
+
+func newTestReceiver() *operatorv1beta1.MeteringReceiver {
+	instance := &operatorv1beta1.MeteringReceiver{
+		ObjectMeta: metav1.ObjectMeta{Name: "receiver", Namespace: testNamespace, Generation: 2},
+	}
+	instance.Spec.SetDefaults()
+	return instance
+}
+
+func newTestReconciler(t *testing.T, objs ...runtime.Object) *ReconcileMeteringReceiver {
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := operatorv1beta1.SchemeBuilder.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	return &ReconcileMeteringReceiver{
+		client:   fake.NewFakeClientWithScheme(s, objs...),
+		scheme:   s,
+		recorder: record.NewFakeRecorder(10),
+		apis:     availableAPIs{certificate: res.CertificateGroupVersionKinds[0]},
+	}
+}
+
+// newTestDeployment returns the receiver Deployment, rolled out and available when ready is true
+func newTestDeployment(instance *operatorv1beta1.MeteringReceiver, ready bool) *appsv1.Deployment {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: res.ResourceNamesFor(instance).Deployment, Namespace: testNamespace, Generation: 1},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: 1,
+			Replicas:           1,
+			UpdatedReplicas:    1,
+		},
+	}
+	if ready {
+		deployment.Status.AvailableReplicas = 1
+		deployment.Status.Conditions = []appsv1.DeploymentCondition{
+			{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionTrue},
+		}
+	}
+	return deployment
+}
+
+func newTestService(instance *operatorv1beta1.MeteringReceiver) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: res.ResourceNamesFor(instance).Service, Namespace: testNamespace},
+	}
+}
+
+// newTestCertificate returns the receiver Certificate with its Ready condition
+func newTestCertificate(instance *operatorv1beta1.MeteringReceiver, ready corev1.ConditionStatus) *unstructured.Unstructured {
+	certificate := res.NewCertificate(res.CertificateGroupVersionKinds[0])
+	certificate.SetName(res.ResourceNamesFor(instance).Certificate)
+	certificate.SetNamespace(testNamespace)
+	_ = unstructured.SetNestedSlice(certificate.Object, []interface{}{
+		map[string]interface{}{"type": "Ready", "status": string(ready), "message": "issuing"},
+	}, "status", "conditions")
+	return certificate
+}
+
+func TestUpdateStatus(t *testing.T) {
+	instance := newTestReceiver()
+	ready := resourceState{ready: true}
+	secretsMissing := resourceState{failed: true, reason: reasonSecretsMissing, message: "Secret icp-mongodb-admin not found"}
+
+	tests := []struct {
+		name           string
+		objs           []runtime.Object
+		secretsState   resourceState
+		wantPhase      operatorv1beta1.MeteringPhase
+		wantConditions map[operatorv1beta1.ConditionType]corev1.ConditionStatus
+		wantReason     string
+	}{
+		{
+			name:         "nothing created",
+			secretsState: ready,
+			wantPhase:    operatorv1beta1.PhasePending,
+			wantConditions: map[operatorv1beta1.ConditionType]corev1.ConditionStatus{
+				operatorv1beta1.ConditionReady:          corev1.ConditionFalse,
+				operatorv1beta1.ConditionProgressing:    corev1.ConditionTrue,
+				operatorv1beta1.ConditionDegraded:       corev1.ConditionFalse,
+				operatorv1beta1.ConditionAvailable:      corev1.ConditionFalse,
+				operatorv1beta1.ConditionSecretsMissing: corev1.ConditionFalse,
+			},
+			wantReason: reasonDeploymentNotFound,
+		},
+		{
+			name:         "rolling out",
+			objs:         []runtime.Object{newTestDeployment(instance, false), newTestService(instance), newTestCertificate(instance, corev1.ConditionTrue)},
+			secretsState: ready,
+			wantPhase:    operatorv1beta1.PhaseProgressing,
+			wantConditions: map[operatorv1beta1.ConditionType]corev1.ConditionStatus{
+				operatorv1beta1.ConditionReady:       corev1.ConditionFalse,
+				operatorv1beta1.ConditionProgressing: corev1.ConditionTrue,
+				operatorv1beta1.ConditionDegraded:    corev1.ConditionFalse,
+				operatorv1beta1.ConditionAvailable:   corev1.ConditionFalse,
+			},
+			wantReason: reasonDeploymentRollingOut,
+		},
+		{
+			name:         "certificate not issued",
+			objs:         []runtime.Object{newTestDeployment(instance, true), newTestService(instance), newTestCertificate(instance, corev1.ConditionFalse)},
+			secretsState: ready,
+			wantPhase:    operatorv1beta1.PhaseProgressing,
+			wantConditions: map[operatorv1beta1.ConditionType]corev1.ConditionStatus{
+				operatorv1beta1.ConditionReady:       corev1.ConditionFalse,
+				operatorv1beta1.ConditionProgressing: corev1.ConditionTrue,
+				operatorv1beta1.ConditionDegraded:    corev1.ConditionFalse,
+				operatorv1beta1.ConditionAvailable:   corev1.ConditionTrue,
+			},
+			wantReason: reasonCertificateNotReady,
+		},
+		{
+			name:         "ready",
+			objs:         []runtime.Object{newTestDeployment(instance, true), newTestService(instance), newTestCertificate(instance, corev1.ConditionTrue)},
+			secretsState: ready,
+			wantPhase:    operatorv1beta1.PhaseReady,
+			wantConditions: map[operatorv1beta1.ConditionType]corev1.ConditionStatus{
+				operatorv1beta1.ConditionReady:          corev1.ConditionTrue,
+				operatorv1beta1.ConditionProgressing:    corev1.ConditionFalse,
+				operatorv1beta1.ConditionDegraded:       corev1.ConditionFalse,
+				operatorv1beta1.ConditionAvailable:      corev1.ConditionTrue,
+				operatorv1beta1.ConditionSecretsMissing: corev1.ConditionFalse,
+			},
+			wantReason: reasonAsExpected,
+		},
+		{
+			name:         "secrets missing",
+			objs:         []runtime.Object{newTestDeployment(instance, true), newTestService(instance), newTestCertificate(instance, corev1.ConditionTrue)},
+			secretsState: secretsMissing,
+			wantPhase:    operatorv1beta1.PhaseDegraded,
+			wantConditions: map[operatorv1beta1.ConditionType]corev1.ConditionStatus{
+				operatorv1beta1.ConditionReady:          corev1.ConditionFalse,
+				operatorv1beta1.ConditionProgressing:    corev1.ConditionFalse,
+				operatorv1beta1.ConditionDegraded:       corev1.ConditionTrue,
+				operatorv1beta1.ConditionAvailable:      corev1.ConditionTrue,
+				operatorv1beta1.ConditionSecretsMissing: corev1.ConditionTrue,
+			},
+			wantReason: reasonSecretsMissing,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := newTestReceiver()
+			r := newTestReconciler(t, append(tt.objs, instance)...)
+
+			if err := r.updateStatus(instance, tt.secretsState); err != nil {
+				t.Fatalf("updateStatus() error = %v", err)
+			}
+			if instance.Status.Phase != tt.wantPhase {
+				t.Errorf("Phase = %v, want %v", instance.Status.Phase, tt.wantPhase)
+			}
+			if instance.Status.ObservedGeneration != instance.Generation {
+				t.Errorf("ObservedGeneration = %v, want %v", instance.Status.ObservedGeneration, instance.Generation)
+			}
+			for conditionType, want := range tt.wantConditions {
+				condition := instance.Status.GetCondition(conditionType)
+				if condition == nil {
+					t.Errorf("condition %v not set", conditionType)
+				} else if condition.Status != want {
+					t.Errorf("condition %v = %v, want %v", conditionType, condition.Status, want)
+				}
+			}
+			if ready := instance.Status.GetCondition(operatorv1beta1.ConditionReady); ready == nil || ready.Reason != tt.wantReason {
+				t.Errorf("Ready condition = %+v, want reason %v", ready, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestUpdateStatusTransitions(t *testing.T) {
+	instance := newTestReceiver()
+	deployment := newTestDeployment(instance, true)
+	r := newTestReconciler(t, instance, deployment, newTestService(instance), newTestCertificate(instance, corev1.ConditionTrue))
+	ready := resourceState{ready: true}
+
+	if err := r.updateStatus(instance, ready); err != nil {
+		t.Fatalf("updateStatus() error = %v", err)
+	}
+	if !instance.Status.IsConditionTrue(operatorv1beta1.ConditionReady) {
+		t.Fatalf("Ready condition = %+v, want True", instance.Status.GetCondition(operatorv1beta1.ConditionReady))
+	}
+
+	// move the transition times to the past, so the transitions made below can be seen
+	past := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+	for i := range instance.Status.Conditions {
+		instance.Status.Conditions[i].LastTransitionTime = past
+	}
+	if err := r.client.Status().Update(context.TODO(), instance); err != nil {
+		t.Fatal(err)
+	}
+
+	// an update with the same states changes nothing
+	resourceVersion := instance.ResourceVersion
+	if err := r.updateStatus(instance, ready); err != nil {
+		t.Fatalf("updateStatus() error = %v", err)
+	}
+	if instance.ResourceVersion != resourceVersion {
+		t.Errorf("status updated when nothing changed, resourceVersion %v, was %v", instance.ResourceVersion, resourceVersion)
+	}
+
+	// the Deployment loses its replicas: only the conditions that change status get a new transition time
+	deployment.Status.AvailableReplicas = 0
+	deployment.Status.Conditions = []appsv1.DeploymentCondition{
+		{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionFalse},
+	}
+	if err := r.client.Status().Update(context.TODO(), deployment); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.updateStatus(instance, ready); err != nil {
+		t.Fatalf("updateStatus() error = %v", err)
+	}
+
+	changed := map[operatorv1beta1.ConditionType]bool{
+		operatorv1beta1.ConditionReady:       true,
+		operatorv1beta1.ConditionAvailable:   true,
+		operatorv1beta1.ConditionProgressing: true,
+	}
+	for _, condition := range instance.Status.Conditions {
+		moved := !condition.LastTransitionTime.Equal(&past)
+		if moved != changed[condition.Type] {
+			t.Errorf("condition %v status %v transition time moved = %v, want %v",
+				condition.Type, condition.Status, moved, changed[condition.Type])
+		}
+	}
+	if instance.Status.Phase != operatorv1beta1.PhaseProgressing {
+		t.Errorf("Phase = %v, want %v", instance.Status.Phase, operatorv1beta1.PhaseProgressing)
+	}
+
+	// the stored status is the one that was set
+	stored := &operatorv1beta1.MeteringReceiver{}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: instance.Name, Namespace: testNamespace}, stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status.Phase != instance.Status.Phase || len(stored.Status.Conditions) != len(instance.Status.Conditions) {
+		t.Errorf("stored status = %+v, want %+v", stored.Status, instance.Status)
+	}
+}
+
+func TestCheckDeploymentProgressing(t *testing.T) {
+	deadlineExceeded := appsv1.DeploymentCondition{
+		Type:    appsv1.DeploymentProgressing,
+		Status:  corev1.ConditionFalse,
+		Reason:  progressDeadlineExceededReason,
+		Message: "ReplicaSet has timed out progressing",
+	}
+	tests := []struct {
+		name               string
+		observedGeneration int64
+		ready              bool
+		condition          appsv1.DeploymentCondition
+		wantFailed         bool
+		wantReason         string
+	}{
+		{
+			name:               "deadline exceeded in the first rollout",
+			observedGeneration: 2,
+			condition:          deadlineExceeded,
+			wantFailed:         true,
+			wantReason:         reasonDeploymentFailed,
+		},
+		{
+			name:               "deadline exceeded after the pods were available",
+			observedGeneration: 2,
+			ready:              true,
+			condition:          deadlineExceeded,
+			wantFailed:         true,
+			wantReason:         reasonDeploymentFailed,
+		},
+		{
+			name:               "deadline exceeded in the previous rollout",
+			observedGeneration: 1,
+			ready:              true,
+			condition:          deadlineExceeded,
+			wantReason:         reasonDeploymentRollingOut,
+		},
+		{
+			name:               "progressing false for another reason",
+			observedGeneration: 2,
+			condition:          appsv1.DeploymentCondition{Type: appsv1.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: "Unknown"},
+			wantReason:         reasonDeploymentRollingOut,
+		},
+		{
+			name:               "replica failure",
+			observedGeneration: 2,
+			condition:          appsv1.DeploymentCondition{Type: appsv1.DeploymentReplicaFailure, Status: corev1.ConditionTrue, Message: "exceeded quota"},
+			wantFailed:         true,
+			wantReason:         reasonDeploymentFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := newTestReceiver()
+			deployment := newTestDeployment(instance, tt.ready)
+			deployment.Generation = 2
+			deployment.Status.ObservedGeneration = tt.observedGeneration
+			deployment.Status.Conditions = append(deployment.Status.Conditions, tt.condition)
+			r := newTestReconciler(t, instance, deployment)
+
+			state, _, err := r.checkDeployment(instance)
+			if err != nil {
+				t.Fatalf("checkDeployment() error = %v", err)
+			}
+			if state.failed != tt.wantFailed || state.reason != tt.wantReason {
+				t.Errorf("checkDeployment() = %+v, want failed %v and reason %v", state, tt.wantFailed, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestUpdateStatusRolloutTransitions(t *testing.T) {
+	instance := newTestReceiver()
+	deployment := newTestDeployment(instance, false)
+	deployment.Status.Conditions = []appsv1.DeploymentCondition{
+		{Type: appsv1.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: progressDeadlineExceededReason},
+	}
+	r := newTestReconciler(t, instance, deployment, newTestService(instance), newTestCertificate(instance, corev1.ConditionTrue))
+	ready := resourceState{ready: true}
+
+	steps := []struct {
+		name       string
+		update     func(d *appsv1.Deployment)
+		wantPhase  operatorv1beta1.MeteringPhase
+		wantReason string
+	}{
+		{
+			name:       "progress deadline exceeded",
+			update:     func(d *appsv1.Deployment) {},
+			wantPhase:  operatorv1beta1.PhaseDegraded,
+			wantReason: reasonDeploymentFailed,
+		},
+		{
+			name: "spec fixed, not yet observed by the Deployment controller",
+			update: func(d *appsv1.Deployment) {
+				d.Generation = 2
+			},
+			wantPhase:  operatorv1beta1.PhaseProgressing,
+			wantReason: reasonDeploymentRollingOut,
+		},
+		{
+			name: "new rollout done",
+			update: func(d *appsv1.Deployment) {
+				d.Status.ObservedGeneration = 2
+				d.Status.AvailableReplicas = 1
+				d.Status.Conditions = []appsv1.DeploymentCondition{
+					{Type: appsv1.DeploymentProgressing, Status: corev1.ConditionTrue, Reason: "NewReplicaSetAvailable"},
+					{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionTrue},
+				}
+			},
+			wantPhase:  operatorv1beta1.PhaseReady,
+			wantReason: reasonAsExpected,
+		},
+	}
+	for _, step := range steps {
+		current := &appsv1.Deployment{}
+		if err := r.client.Get(context.TODO(), types.NamespacedName{Name: deployment.Name, Namespace: testNamespace}, current); err != nil {
+			t.Fatal(err)
+		}
+		step.update(current)
+		if err := r.client.Update(context.TODO(), current); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.updateStatus(instance, ready); err != nil {
+			t.Fatalf("%s: updateStatus() error = %v", step.name, err)
+		}
+		if instance.Status.Phase != step.wantPhase {
+			t.Errorf("%s: Phase = %v, want %v", step.name, instance.Status.Phase, step.wantPhase)
+		}
+		if condition := instance.Status.GetCondition(operatorv1beta1.ConditionReady); condition == nil || condition.Reason != step.wantReason {
+			t.Errorf("%s: Ready condition = %+v, want reason %v", step.name, condition, step.wantReason)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package meteringreceiver
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"time"
+
+	operatorv1beta1 "github.com/ibm/ibm-metering-receiver-operator/pkg/apis/operator/v1beta1"
+	"github.com/ibm/ibm-metering-receiver-operator/pkg/pki"
+	res "github.com/ibm/ibm-metering-receiver-operator/pkg/resources"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// validity of the certificates generated when spec.tls.mode is operator.
+// The serving certificate uses spec.tls.certificate.duration and renewBefore when they are set.
+const (
+	receiverCAValidity      = 10 * 365 * 24 * time.Hour
+	receiverServingValidity = 365 * 24 * time.Hour
+	receiverRenewBefore     = 30 * 24 * time.Hour
+)
+
+// receiverCertificateData returns the receiver certificate with the settings of spec.tls.certificate
+func receiverCertificateData(instance *operatorv1beta1.MeteringReceiver) res.CertificateData {
+	spec := instance.Spec.TLS.Certificate
+	certData := res.ReceiverCertificateData(res.ResourceNamesFor(instance))
+	certData.AdditionalDNSNames = spec.DNSNames
+	certData.IPAddresses = spec.IPAddresses
+	certData.ClusterDomain = spec.ClusterDomain
+	certData.Duration = spec.Duration
+	certData.RenewBefore = spec.RenewBefore
+	certData.KeyAlgorithm = string(spec.PrivateKey.Algorithm)
+	certData.KeySize = spec.PrivateKey.Size
+	if spec.IssuerRef != nil {
+		certData.IssuerKind = string(spec.IssuerRef.Kind)
+	}
+	return certData
+}
+
+// reconcileTLS provides the receiver certificate in the icp-metering-receiver-secret secret, depending on spec.tls.mode.
+// It returns how long until the operator generated certificate must be renewed, or 0 when the operator does not generate it.
+func (r *ReconcileMeteringReceiver) reconcileTLS(instance *operatorv1beta1.MeteringReceiver, needToRequeue *bool) (time.Duration, error) {
+	names := res.ResourceNamesFor(instance)
+	if instance.Spec.TLS.Mode == operatorv1beta1.TLSModeCertManager {
+		return 0, r.reconcileAllCertificates(instance, needToRequeue)
+	}
+
+	// the secret is no longer issued by cert-manager, delete the Certificates so they don't overwrite it
+	for _, gvk := range r.servedCertificateKinds() {
+		err := r.deleteCertificate(instance, gvk, names.Certificate)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if instance.Spec.TLS.Mode == operatorv1beta1.TLSModeOperator {
+		return r.reconcileOperatorCertificate(instance, needToRequeue)
+	}
+	// spec.tls.mode is external, the secret is checked by checkSecrets
+	return 0, nil
+}
+
+// servedCertificateKinds returns the cert-manager Certificate kinds served by the cluster
+func (r *ReconcileMeteringReceiver) servedCertificateKinds() []schema.GroupVersionKind {
+	var gvks []schema.GroupVersionKind
+	if !r.apis.certificate.Empty() {
+		gvks = append(gvks, r.apis.certificate)
+	}
+	if r.apis.legacyCertificate && r.apis.certificate != res.LegacyCertificateGroupVersionKind {
+		gvks = append(gvks, res.LegacyCertificateGroupVersionKind)
+	}
+	return gvks
+}
+
+// reconcileOperatorCertificate generates the receiver CA and serving certificate.
+// The CA is kept in its own secret, so the serving certificate can be renewed without changing the CA the clients trust.
+// Both are generated again when they are missing or about to expire. The serving certificate is also generated again
+// when it does not have the DNS names and IP addresses, or the private key, of spec.tls.certificate.
+func (r *ReconcileMeteringReceiver) reconcileOperatorCertificate(instance *operatorv1beta1.MeteringReceiver,
+	needToRequeue *bool) (time.Duration, error) {
+	certData := receiverCertificateData(instance)
+	reqLogger := log.WithValues("func", "reconcileOperatorCertificate", "Secret.Name", certData.Secret)
+
+	ca, err := r.reconcileReceiverCA(instance, needToRequeue)
+	if err != nil {
+		return 0, err
+	}
+
+	dnsNames := res.CertificateDNSNames(instance.Namespace, certData)
+	var ips []net.IP
+	for _, ip := range certData.IPAddresses {
+		ips = append(ips, net.ParseIP(ip))
+	}
+	keyOptions := pki.KeyOptions{Algorithm: certData.KeyAlgorithm, Size: certData.KeySize}
+	validity := receiverServingValidity
+	if certData.Duration != nil {
+		validity = certData.Duration.Duration
+	}
+	renewBefore := receiverRenewBefore
+	if certData.RenewBefore != nil {
+		renewBefore = certData.RenewBefore.Duration
+	}
+	if renewBefore >= validity {
+		// like cert-manager, renew a short lived certificate when two thirds of its duration have passed
+		renewBefore = validity / 3
+	}
+
+	secret, found, err := r.getSecret(instance.Namespace, certData.Secret)
+	if err != nil {
+		reqLogger.Error(err, "Failed to get the receiver certificate secret")
+		return 0, err
+	}
+	if !found || !bytes.Equal(secret.Data["ca.crt"], ca.Cert) || len(secret.Data[corev1.TLSPrivateKeyKey]) == 0 ||
+		pki.NeedsRenewal(secret.Data[corev1.TLSCertKey], append(dnsNames, certData.IPAddresses...), renewBefore) ||
+		!servingKeyMatches(secret.Data[corev1.TLSCertKey], keyOptions) {
+		reqLogger.Info("Generating the receiver serving certificate")
+		cert, err := pki.NewServingCertWithKey(ca, certData.Common, dnsNames, ips, validity, keyOptions)
+		if err != nil {
+			return 0, err
+		}
+		secret, err = r.saveTLSSecret(instance, secret, found, certData.Secret, map[string][]byte{
+			"ca.crt":                ca.Cert,
+			corev1.TLSCertKey:       cert.Cert,
+			corev1.TLSPrivateKeyKey: cert.Key,
+		})
+		if err != nil {
+			reqLogger.Error(err, "Failed to save the receiver certificate secret")
+			return 0, err
+		}
+		*needToRequeue = true
+	}
+
+	cert, err := pki.ParseCertificate(secret.Data[corev1.TLSCertKey])
+	if err != nil {
+		return 0, err
+	}
+	renewIn := time.Until(cert.NotAfter.Add(-renewBefore))
+	reqLogger.Info("Receiver serving certificate is valid", "NotAfter", cert.NotAfter, "RenewIn", renewIn.String())
+	return renewIn, nil
+}
+
+// servingKeyMatches returns true if the certificate has a private key of the given algorithm and size
+func servingKeyMatches(certPEM []byte, keyOptions pki.KeyOptions) bool {
+	cert, err := pki.ParseCertificate(certPEM)
+	if err != nil {
+		return false
+	}
+	return pki.KeyMatches(cert, keyOptions)
+}
+
+// reconcileReceiverCA returns the CA that signs the receiver serving certificate.
+// A new CA is generated when its secret is missing or the CA expires within 30 days.
+func (r *ReconcileMeteringReceiver) reconcileReceiverCA(instance *operatorv1beta1.MeteringReceiver,
+	needToRequeue *bool) (*pki.KeyPair, error) {
+	names := res.ResourceNamesFor(instance)
+	reqLogger := log.WithValues("func", "reconcileReceiverCA", "Secret.Name", names.CASecret)
+
+	secret, found, err := r.getSecret(instance.Namespace, names.CASecret)
+	if err != nil {
+		reqLogger.Error(err, "Failed to get the receiver CA secret")
+		return nil, err
+	}
+	if found && len(secret.Data[corev1.TLSPrivateKeyKey]) > 0 &&
+		!pki.NeedsRenewal(secret.Data[corev1.TLSCertKey], nil, receiverRenewBefore) {
+		return &pki.KeyPair{Cert: secret.Data[corev1.TLSCertKey], Key: secret.Data[corev1.TLSPrivateKeyKey]}, nil
+	}
+
+	reqLogger.Info("Generating the receiver CA")
+	ca, err := pki.NewCA(res.ReceiverCertCommonName+"-ca", receiverCAValidity)
+	if err != nil {
+		return nil, err
+	}
+	_, err = r.saveTLSSecret(instance, secret, found, names.CASecret, map[string][]byte{
+		corev1.TLSCertKey:       ca.Cert,
+		corev1.TLSPrivateKeyKey: ca.Key,
+	})
+	if err != nil {
+		reqLogger.Error(err, "Failed to save the receiver CA secret")
+		return nil, err
+	}
+	*needToRequeue = true
+	return ca, nil
+}
+
+// getSecret returns the secret and whether it exists
+func (r *ReconcileMeteringReceiver) getSecret(namespace, name string) (*corev1.Secret, bool, error) {
+	secret := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, secret)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return secret, false, nil
+		}
+		return nil, false, err
+	}
+	return secret, true, nil
+}
+
+// saveTLSSecret creates the secret with the data, or replaces the data of the existing secret.
+// A new secret is controlled by the MeteringReceiver. An existing secret keeps its owner,
+// it can be the secret created by cert-manager before spec.tls.mode was changed.
+func (r *ReconcileMeteringReceiver) saveTLSSecret(instance *operatorv1beta1.MeteringReceiver, secret *corev1.Secret, found bool,
+	name string, data map[string][]byte) (*corev1.Secret, error) {
+	if found {
+		secret.Data = data
+		return secret, r.client.Update(context.TODO(), secret)
+	}
+
+	secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: instance.Namespace,
+			Labels:    res.LabelsForMetadata(res.ReceiverDeploymentName),
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: data,
+	}
+	err := controllerutil.SetControllerReference(instance, secret, r.scheme)
+	if err != nil {
+		return nil, err
+	}
+	return secret, r.client.Create(context.TODO(), secret)
+}
+
+// checkCertificateSecret returns the state of the receiver certificate secret
+// when the certificate is not issued by cert-manager
+func (r *ReconcileMeteringReceiver) checkCertificateSecret(instance *operatorv1beta1.MeteringReceiver) (resourceState, error) {
+	names := res.ResourceNamesFor(instance)
+	secret, found, err := r.getSecret(instance.Namespace, names.CertSecret)
+	if err != nil {
+		return resourceState{}, err
+	}
+	if !found {
+		// the user has to create the secret in external mode
+		return resourceState{failed: instance.Spec.TLS.Mode == operatorv1beta1.TLSModeExternal, reason: reasonCertificateNotFound,
+			message: "Secret " + names.CertSecret + " has not been created"}, nil
+	}
+	cert, err := pki.ParseCertificate(secret.Data[corev1.TLSCertKey])
+	if err != nil {
+		return resourceState{failed: true, reason: reasonCertificateInvalid,
+			message: "Secret " + names.CertSecret + " does not have a valid certificate: " + err.Error()}, nil
+	}
+	if time.Now().After(cert.NotAfter) {
+		return resourceState{failed: true, reason: reasonCertificateExpired,
+			message: "The certificate in Secret " + names.CertSecret + " expired on " + cert.NotAfter.Format(time.RFC3339)}, nil
+	}
+	return resourceState{ready: true}, nil
+}
@@ -0,0 +1,192 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package meteringreceiver
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	operatorv1beta1 "github.com/ibm/ibm-metering-receiver-operator/pkg/apis/operator/v1beta1"
+	"github.com/ibm/ibm-metering-receiver-operator/pkg/pki"
+	res "github.com/ibm/ibm-metering-receiver-operator/pkg/resources"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// getTestSecret returns the data of a secret of the test namespace
+func getTestSecret(t *testing.T, r *ReconcileMeteringReceiver, name string) map[string][]byte {
+	secret := &corev1.Secret{}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: testNamespace}, secret); err != nil {
+		t.Fatalf("Secret %s: %v", name, err)
+	}
+	return secret.Data
+}
+
+func TestReconcileOperatorCertificate(t *testing.T) {
+	instance := newTestReceiver()
+	instance.Spec.TLS.Mode = operatorv1beta1.TLSModeOperator
+	names := res.ResourceNamesFor(instance)
+	r := newTestReconciler(t, instance)
+
+	reconcile := func(step string, wantRequeue bool) (caData, certData map[string][]byte) {
+		needToRequeue := false
+		renewIn, err := r.reconcileTLS(instance, &needToRequeue)
+		if err != nil {
+			t.Fatalf("%s: reconcileTLS() error = %v", step, err)
+		}
+		if needToRequeue != wantRequeue {
+			t.Errorf("%s: needToRequeue = %v, want %v", step, needToRequeue, wantRequeue)
+		}
+		caData = getTestSecret(t, r, names.CASecret)
+		certData = getTestSecret(t, r, names.CertSecret)
+		if !bytes.Equal(certData["ca.crt"], caData[corev1.TLSCertKey]) {
+			t.Errorf("%s: ca.crt of the serving certificate is not the CA", step)
+		}
+		ca, err := pki.ParseCertificate(caData[corev1.TLSCertKey])
+		if err != nil {
+			t.Fatalf("%s: CA: %v", step, err)
+		}
+		cert, err := pki.ParseCertificate(certData[corev1.TLSCertKey])
+		if err != nil {
+			t.Fatalf("%s: serving certificate: %v", step, err)
+		}
+		if err := cert.CheckSignatureFrom(ca); err != nil {
+			t.Errorf("%s: serving certificate is not signed by the CA: %v", step, err)
+		}
+		if want := time.Until(cert.NotAfter.Add(-receiverRenewBefore)); renewIn > want+time.Minute || renewIn < want-time.Minute {
+			t.Errorf("%s: renewIn = %v, want %v", step, renewIn, want)
+		}
+		return caData, certData
+	}
+
+	ca, cert := reconcile("secrets created", true)
+	_, unchanged := reconcile("secrets unchanged", false)
+	if !bytes.Equal(unchanged[corev1.TLSCertKey], cert[corev1.TLSCertKey]) {
+		t.Error("serving certificate generated again without a change")
+	}
+
+	// a new DNS name needs a new serving certificate of the same CA
+	instance.Spec.TLS.Certificate.DNSNames = []string{"metering.example.com"}
+	newCA, newCert := reconcile("DNS name added", true)
+	if !bytes.Equal(newCA[corev1.TLSCertKey], ca[corev1.TLSCertKey]) {
+		t.Error("CA generated again for a new DNS name")
+	}
+	if pki.NeedsRenewal(newCert[corev1.TLSCertKey], []string{"metering.example.com"}, 0) {
+		t.Error("serving certificate does not have the new DNS name")
+	}
+
+	// a CA about to expire is generated again with a new serving certificate
+	expiringCA, err := pki.NewCA(res.ReceiverCertCommonName+"-ca", receiverRenewBefore-time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caSecret := &corev1.Secret{}
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Name: names.CASecret, Namespace: testNamespace}, caSecret); err != nil {
+		t.Fatal(err)
+	}
+	caSecret.Data = map[string][]byte{corev1.TLSCertKey: expiringCA.Cert, corev1.TLSPrivateKeyKey: expiringCA.Key}
+	if err := r.client.Update(context.TODO(), caSecret); err != nil {
+		t.Fatal(err)
+	}
+	renewedCA, renewedCert := reconcile("CA about to expire", true)
+	if bytes.Equal(renewedCA[corev1.TLSCertKey], expiringCA.Cert) || bytes.Equal(renewedCert[corev1.TLSCertKey], newCert[corev1.TLSCertKey]) {
+		t.Error("CA and serving certificate not generated again for a CA about to expire")
+	}
+}
+
+func TestCheckCertificateSecret(t *testing.T) {
+	ca, err := pki.NewCA("test-ca", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newCert := func(validity time.Duration) []byte {
+		cert, err := pki.NewServingCert(ca, "metering-receiver", []string{"metering-receiver"}, nil, validity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert.Cert
+	}
+
+	tests := []struct {
+		name       string
+		mode       operatorv1beta1.TLSMode
+		cert       []byte
+		wantReady  bool
+		wantFailed bool
+		wantReason string
+	}{
+		{
+			name:       "not generated yet",
+			mode:       operatorv1beta1.TLSModeOperator,
+			wantReason: reasonCertificateNotFound,
+		},
+		{
+			name:       "not created by the user",
+			mode:       operatorv1beta1.TLSModeExternal,
+			wantFailed: true,
+			wantReason: reasonCertificateNotFound,
+		},
+		{
+			name:       "invalid certificate",
+			mode:       operatorv1beta1.TLSModeExternal,
+			cert:       []byte("not a certificate"),
+			wantFailed: true,
+			wantReason: reasonCertificateInvalid,
+		},
+		{
+			name:       "expired certificate",
+			mode:       operatorv1beta1.TLSModeExternal,
+			cert:       newCert(-time.Minute),
+			wantFailed: true,
+			wantReason: reasonCertificateExpired,
+		},
+		{
+			name:      "valid certificate",
+			mode:      operatorv1beta1.TLSModeExternal,
+			cert:      newCert(time.Hour),
+			wantReady: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := newTestReceiver()
+			instance.Spec.TLS.Mode = tt.mode
+			r := newTestReconciler(t, instance)
+			if tt.cert != nil {
+				err := r.client.Create(context.TODO(), &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: res.ResourceNamesFor(instance).CertSecret, Namespace: testNamespace},
+					Data:       map[string][]byte{corev1.TLSCertKey: tt.cert},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			state, err := r.checkCertificateSecret(instance)
+			if err != nil {
+				t.Fatalf("checkCertificateSecret() error = %v", err)
+			}
+			if state.ready != tt.wantReady || state.failed != tt.wantFailed || state.reason != tt.wantReason {
+				t.Errorf("checkCertificateSecret() = %+v, want ready %v, failed %v and reason %v",
+					state, tt.wantReady, tt.wantFailed, tt.wantReason)
+			}
+		})
+	}
+}
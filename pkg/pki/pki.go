@@ -0,0 +1,227 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package pki generates the self-signed certificates used when the operator
+// provides its own TLS material instead of relying on cert-manager.
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+)
+
+const rsaKeySize = 2048
+
+// Private key algorithms of the serving certificates
+const (
+	AlgorithmRSA   = "RSA"
+	AlgorithmECDSA = "ECDSA"
+)
+
+// KeyOptions are the algorithm and size in bits of a private key
+type KeyOptions struct {
+	Algorithm string
+	Size      int
+}
+
+// DefaultKeyOptions are the options of the keys generated by NewServingCert
+var DefaultKeyOptions = KeyOptions{Algorithm: AlgorithmRSA, Size: rsaKeySize}
+
+// KeyPair is a PEM encoded certificate and its PEM encoded private key
+type KeyPair struct {
+	Cert []byte
+	Key  []byte
+}
+
+// NewCA returns a self-signed CA certificate valid for the given duration
+func NewCA(commonName string, validity time.Duration) (*KeyPair, error) {
+	key, err := rsa.GenerateKey(rand.Reader, rsaKeySize)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName, Organization: []string{"IBM"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	return encode(der, key), nil
+}
+
+// NewServingCert returns a serving certificate signed by ca, valid for the given duration.
+// dnsNames and ips are added as subject alternative names.
+func NewServingCert(ca *KeyPair, commonName string, dnsNames []string, ips []net.IP, validity time.Duration) (*KeyPair, error) {
+	return NewServingCertWithKey(ca, commonName, dnsNames, ips, validity, DefaultKeyOptions)
+}
+
+// NewServingCertWithKey returns a serving certificate like NewServingCert, with a private key of the given algorithm and size
+func NewServingCertWithKey(ca *KeyPair, commonName string, dnsNames []string, ips []net.IP, validity time.Duration,
+	keyOptions KeyOptions) (*KeyPair, error) {
+	caCert, caKey, err := ca.parse()
+	if err != nil {
+		return nil, err
+	}
+	key, keyPEM, err := newKey(keyOptions)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	notAfter := now.Add(validity)
+	if notAfter.After(caCert.NotAfter) {
+		notAfter = caCert.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"IBM"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, key.Public(), caKey)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyPair{Cert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), Key: keyPEM}, nil
+}
+
+// KeyMatches returns true if the public key of cert has the algorithm and size of keyOptions
+func KeyMatches(cert *x509.Certificate, keyOptions KeyOptions) bool {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return keyOptions.Algorithm == AlgorithmRSA && key.N.BitLen() == keyOptions.Size
+	case *ecdsa.PublicKey:
+		return keyOptions.Algorithm == AlgorithmECDSA && key.Curve.Params().BitSize == keyOptions.Size
+	}
+	return false
+}
+
+// NeedsRenewal returns true if certPEM can't be parsed, expires within renewBefore,
+// or does not contain all the given DNS names.
+func NeedsRenewal(certPEM []byte, dnsNames []string, renewBefore time.Duration) bool {
+	cert, err := ParseCertificate(certPEM)
+	if err != nil {
+		return true
+	}
+	if time.Now().Add(renewBefore).After(cert.NotAfter) {
+		return true
+	}
+	for _, name := range dnsNames {
+		if cert.VerifyHostname(name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCertificate returns the first certificate in certPEM
+func ParseCertificate(certPEM []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no PEM encoded certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func (kp *KeyPair) parse() (*x509.Certificate, *rsa.PrivateKey, error) {
+	cert, err := ParseCertificate(kp.Cert)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, _ := pem.Decode(kp.Key)
+	if block == nil || block.Type != "RSA PRIVATE KEY" {
+		return nil, nil, errors.New("no PEM encoded RSA private key found")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+// newKey returns a private key and its PEM encoding
+func newKey(keyOptions KeyOptions) (crypto.Signer, []byte, error) {
+	switch keyOptions.Algorithm {
+	case AlgorithmRSA:
+		key, err := rsa.GenerateKey(rand.Reader, keyOptions.Size)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), nil
+	case AlgorithmECDSA:
+		var curve elliptic.Curve
+		switch keyOptions.Size {
+		case 256:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		case 521:
+			curve = elliptic.P521()
+		default:
+			return nil, nil, fmt.Errorf("unsupported ECDSA key size %d", keyOptions.Size)
+		}
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+	}
+	return nil, nil, fmt.Errorf("unsupported key algorithm %q", keyOptions.Algorithm)
+}
+
+func encode(der []byte, key *rsa.PrivateKey) *KeyPair {
+	return &KeyPair{
+		Cert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		Key:  pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+	}
+}
+
+func newSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
@@ -36,11 +36,8 @@ type SecretCheckData struct {
 	VolumeMounts []corev1.VolumeMount
 }
 
-const DefaultImageRegistry = "quay.io/opencloudio"
 const DefaultReceiverImageName = "metering-data-manager"
 
-const DefaultClusterIssuer = "cs-ca-clusterissuer"
-
 // starting with Common Services 3.4, images can be pulled by SHA or tag.
 // run scripts/get-image-sha.sh to update operator.yaml with the SHA values.
 // a SHA value looks like this: "sha256:nnnnnnnn"
@@ -56,7 +53,6 @@ const DefaultPlatformOidcSecretName = "platform-oidc-credentials" + ""
 
 var TrueVar = true
 var FalseVar = false
-var Replica1 int32 = 1
 var Seconds60 int64 = 60
 
 var cpu100 = resource.NewMilliQuantity(100, resource.DecimalSI)        // 100m
@@ -67,12 +63,31 @@ var memory512 = resource.NewQuantity(512*1024*1024, resource.BinarySI) // 512Mi
 
 const DefaultClusterName = "mycluster"
 
+// ReceiverContainerPort is the port the receiver accepts the metering data on
+const ReceiverContainerPort int32 = 5000
+
+// ReceiverProbePort is the port of the liveness and readiness probes of the receiver
+const ReceiverProbePort int32 = 3000
+
 var ArchitectureList = []string{
 	"amd64",
 	"ppc64le",
 	"s390x",
 }
 
+// DefaultTolerations let the operands run on dedicated and critical addon nodes
+var DefaultTolerations = []corev1.Toleration{
+	{
+		Key:      "dedicated",
+		Operator: corev1.TolerationOpExists,
+		Effect:   corev1.TaintEffectNoSchedule,
+	},
+	{
+		Key:      "CriticalAddonsOnly",
+		Operator: corev1.TolerationOpExists,
+	},
+}
+
 var CommonEnvVars = []corev1.EnvVar{
 	{
 		Name:  "NODE_TLS_REJECT_UNAUTHORIZED",
@@ -127,6 +142,9 @@ const ReceiverCertDirName = "metering-receiver"
 const ReceiverCertSecretName = "icp-metering-receiver-secret" + ""
 const ReceiverCertVolumeName = "icp-metering-receiver-certs"
 
+// ReceiverCASecretName is the secret with the CA that signs the receiver certificate when spec.tls.mode is operator
+const ReceiverCASecretName = "icp-metering-receiver-ca-secret" + ""
+
 var ReceiverCertVolumeMountForSecretCheck = corev1.VolumeMount{
 	Name:      ReceiverCertVolumeName,
 	MountPath: "/sec/" + ReceiverCertDirName,
@@ -135,15 +153,19 @@ var ReceiverCertVolumeMountForMain = corev1.VolumeMount{
 	Name:      ReceiverCertVolumeName,
 	MountPath: "/certs/" + ReceiverCertDirName,
 }
-var ReceiverCertVolume = corev1.Volume{
-	Name: ReceiverCertVolumeName,
-	VolumeSource: corev1.VolumeSource{
-		Secret: &corev1.SecretVolumeSource{
-			SecretName:  ReceiverCertSecretName,
-			DefaultMode: &DefaultMode,
-			Optional:    &TrueVar,
+
+// BuildReceiverCertVolume returns the volume of the receiver certificate secret
+func BuildReceiverCertVolume(secretName string) corev1.Volume {
+	return corev1.Volume{
+		Name: ReceiverCertVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName:  secretName,
+				DefaultMode: &DefaultMode,
+				Optional:    &TrueVar,
+			},
 		},
-	},
+	}
 }
 
 var ReceiverSslEnvVars = []corev1.EnvVar{
@@ -162,13 +184,20 @@ var ReceiverSslEnvVars = []corev1.EnvVar{
 }
 
 // Common definitions
-var commonInitVolumeMounts = []corev1.VolumeMount{
+const MongoDBCACertVolumeName = "mongodb-ca-cert"
+const MongoDBClientCertVolumeName = "mongodb-client-cert"
+const MongoDBUsernameVolumeName = "muser-icp-mongodb-admin"
+const MongoDBPasswordVolumeName = "mpass-icp-mongodb-admin"
+const MongoDBURIVolumeName = "mongodb-uri"
+
+// mongoDBCertVolumeMounts are only used when the connection to MongoDB uses TLS
+var mongoDBCertVolumeMounts = []corev1.VolumeMount{
 	{
-		Name:      "mongodb-ca-cert",
+		Name:      MongoDBCACertVolumeName,
 		MountPath: "/certs/mongodb-ca",
 	},
 	{
-		Name:      "mongodb-client-cert",
+		Name:      MongoDBClientCertVolumeName,
 		MountPath: "/certs/mongodb-client",
 	},
 }
@@ -194,17 +223,6 @@ var commonSecurityContext = corev1.SecurityContext{
 	},
 }
 
-var CommonMainVolumeMounts = []corev1.VolumeMount{
-	{
-		Name:      "mongodb-ca-cert",
-		MountPath: "/certs/mongodb-ca",
-	},
-	{
-		Name:      "mongodb-client-cert",
-		MountPath: "/certs/mongodb-client",
-	},
-}
-
 var LoglevelVolumeMount = corev1.VolumeMount{
 	Name:      "loglevel",
 	MountPath: "/etc/config",
@@ -227,49 +245,17 @@ var ReceiverMainContainer = corev1.Container{
 		LoglevelVolumeMount,
 	},
 	// CommonEnvVars, IAMEnvVars and mongoDBEnvVars will be added by the controller.
-	// HC_DM_MCM_RECEIVER_ENABLED will be set by meteringreceiver_controller.
+	// The component env vars are built by BuildComponentEnvVars from the CR.
 	// Removed ICP_API_KEY.
 	Env: []corev1.EnvVar{
-		{
-			Name:  "METERING_API_ENABLED",
-			Value: "false",
-		},
 		{
 			Name:  "HC_DM_USE_HTTPS",
 			Value: "false",
 		},
-		{
-			Name:  "HC_DM_MCM_SENDER_ENABLED",
-			Value: "false",
-		},
-		{
-			Name:  "HC_DM_STORAGEREADER_ENABLED",
-			Value: "false",
-		},
-		{
-			Name:  "HC_DM_REPORTER2_ENABLED",
-			Value: "false",
-		},
-		{
-			Name:  "HC_DM_PURGER2_ENABLED",
-			Value: "false",
-		},
-		{
-			Name:  "HC_DM_PREAGGREGATOR_ENABLED",
-			Value: "false",
-		},
-		{
-			Name:  "HC_DM_METRICS_ENABLED",
-			Value: "false",
-		},
-		{
-			Name:  "HC_DM_SELFMETER_PURGER_ENABLED",
-			Value: "false",
-		},
 	},
 	Ports: []corev1.ContainerPort{
-		{ContainerPort: 3000},
-		{ContainerPort: 5000},
+		{ContainerPort: ReceiverProbePort},
+		{ContainerPort: ReceiverContainerPort},
 	},
 	LivenessProbe: &corev1.Probe{
 		Handler: corev1.Handler{
@@ -277,7 +263,7 @@ var ReceiverMainContainer = corev1.Container{
 				Path: "/livenessProbe",
 				Port: intstr.IntOrString{
 					Type:   intstr.Int,
-					IntVal: 3000,
+					IntVal: ReceiverProbePort,
 				},
 				Scheme: corev1.URISchemeHTTP,
 			},
@@ -294,7 +280,7 @@ var ReceiverMainContainer = corev1.Container{
 				Path: "/readinessProbe",
 				Port: intstr.IntOrString{
 					Type:   intstr.Int,
-					IntVal: 3000,
+					IntVal: ReceiverProbePort,
 				},
 				Scheme: corev1.URISchemeHTTP,
 			},
@@ -0,0 +1,299 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package resources
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// FieldDiff is a field that differs between the current object and the object the operator expects.
+// Path is like spec.template.spec.containers[metering-receiver].env[HC_DM_USE_HTTPS].value,
+// list items with a name are identified by their name, the other ones by their index.
+type FieldDiff struct {
+	Path    string
+	Current interface{}
+	Desired interface{}
+}
+
+// DiffOptions selects the fields compared by Diff
+type DiffOptions struct {
+	// Fields are the paths of the fields that are compared, like metadata.labels or spec.
+	Fields []string
+	// Owned are the patterns of the fields that must be removed when the desired object does not set them.
+	// The other fields that are only in the current object are defaults set by Kubernetes
+	// or values set by other controllers, so they are ignored.
+	// In a pattern, * matches any field, and a list item is written as the list name followed by [],
+	// like spec.template.spec.containers[].env
+	Owned []string
+}
+
+// Diff returns the fields of desired that are not in current, and the owned fields of current that are not in desired.
+// The objects are compared as unstructured objects: a field that is not set in desired is only compared when it is owned,
+// numbers are compared by value, resource quantities by amount and named list items by name.
+func Diff(current, desired interface{}, options DiffOptions) ([]FieldDiff, error) {
+	currentObject, err := toUnstructuredMap(current)
+	if err != nil {
+		return nil, err
+	}
+	desiredObject, err := toUnstructuredMap(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	d := differ{owned: make([][]string, len(options.Owned))}
+	for i, pattern := range options.Owned {
+		d.owned[i] = strings.Split(pattern, ".")
+	}
+	for _, field := range options.Fields {
+		fieldPath := strings.Split(field, ".")
+		currentValue, _, _ := unstructured.NestedFieldNoCopy(currentObject, fieldPath...)
+		desiredValue, _, _ := unstructured.NestedFieldNoCopy(desiredObject, fieldPath...)
+		d.compare(field, fieldPath, currentValue, desiredValue, false)
+	}
+	return d.diffs, nil
+}
+
+// DiffPaths returns the paths of the fields that differ
+func DiffPaths(diffs []FieldDiff) []string {
+	paths := make([]string, len(diffs))
+	for i, diff := range diffs {
+		paths[i] = diff.Path
+	}
+	return paths
+}
+
+// toUnstructuredMap returns the fields of a typed or unstructured object
+func toUnstructuredMap(obj interface{}) (map[string]interface{}, error) {
+	switch o := obj.(type) {
+	case *unstructured.Unstructured:
+		return o.Object, nil
+	case map[string]interface{}:
+		return o, nil
+	}
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+}
+
+type differ struct {
+	owned [][]string
+	diffs []FieldDiff
+}
+
+// compare adds the differences between the current and desired values of a field.
+// pattern is the path of the field with [] for the list items, it is matched against the owned patterns.
+// A field that is not set in desired is compared when owned is true, or when the field is owned.
+func (d *differ) compare(path string, pattern []string, current, desired interface{}, owned bool) {
+	if isEmptyValue(desired) {
+		if !isEmptyValue(current) && (owned || d.isOwned(pattern)) {
+			d.add(path, current, desired)
+		}
+		return
+	}
+
+	switch desiredValue := desired.(type) {
+	case map[string]interface{}:
+		currentValue, ok := current.(map[string]interface{})
+		if !ok {
+			d.add(path, current, desired)
+			return
+		}
+		d.compareMaps(path, pattern, currentValue, desiredValue)
+	case []interface{}:
+		currentValue, ok := current.([]interface{})
+		if !ok {
+			d.add(path, current, desired)
+			return
+		}
+		d.compareLists(path, pattern, currentValue, desiredValue)
+	default:
+		if !isScalarEqual(pattern, current, desired) {
+			d.add(path, current, desired)
+		}
+	}
+}
+
+// compareMaps compares the fields of desired, and the owned fields that are only in current
+// The keys are sorted, so the differences are always reported in the same order.
+func (d *differ) compareMaps(path string, pattern []string, current, desired map[string]interface{}) {
+	keys := make([]string, 0, len(desired)+len(current))
+	for key := range desired {
+		keys = append(keys, key)
+	}
+	for key := range current {
+		if _, ok := desired[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		d.compare(path+"."+key, appendPattern(pattern, key), current[key], desired[key], false)
+	}
+}
+
+// compareLists compares the items of 2 lists. A list is owned by the operator, so the lists must have the same items.
+// When the items of both lists have unique names, the items are matched by name, so a list in a different order
+// is not a difference. Otherwise they are matched by index, and the items past the end of the shorter list are reported.
+func (d *differ) compareLists(path string, pattern []string, current, desired []interface{}) {
+	itemPattern := append(append([]string{}, pattern[:len(pattern)-1]...), pattern[len(pattern)-1]+"[]")
+
+	desiredNames, desiredNamed := itemNames(desired)
+	currentNames, currentNamed := itemNames(current)
+	if desiredNamed && (currentNamed || len(current) == 0) {
+		currentItems := map[string]interface{}{}
+		for i, name := range currentNames {
+			currentItems[name] = current[i]
+		}
+		for i, name := range desiredNames {
+			d.compare(path+"["+name+"]", itemPattern, currentItems[name], desired[i], true)
+			delete(currentItems, name)
+		}
+		for i, name := range currentNames {
+			if _, ok := currentItems[name]; ok {
+				d.add(path+"["+name+"]", current[i], nil)
+			}
+		}
+		return
+	}
+
+	for i := range desired {
+		var currentItem interface{}
+		if i < len(current) {
+			currentItem = current[i]
+		}
+		d.compare(path+"["+strconv.Itoa(i)+"]", itemPattern, currentItem, desired[i], true)
+	}
+	for i := len(desired); i < len(current); i++ {
+		d.add(path+"["+strconv.Itoa(i)+"]", current[i], nil)
+	}
+}
+
+// isOwned returns true if the field matches an owned pattern
+func (d *differ) isOwned(pattern []string) bool {
+	for _, owned := range d.owned {
+		if matchPattern(owned, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *differ) add(path string, current, desired interface{}) {
+	d.diffs = append(d.diffs, FieldDiff{Path: path, Current: current, Desired: desired})
+}
+
+// appendPattern returns a copy of pattern with the key added
+func appendPattern(pattern []string, key string) []string {
+	return append(append(make([]string, 0, len(pattern)+1), pattern...), key)
+}
+
+// matchPattern returns true if the path matches the pattern, where * matches any field
+func matchPattern(pattern, path []string) bool {
+	if len(pattern) != len(path) {
+		return false
+	}
+	for i := range pattern {
+		if pattern[i] != "*" && pattern[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// itemNames returns the names of the list items, when all the items are objects with a unique name
+func itemNames(items []interface{}) ([]string, bool) {
+	names := make([]string, len(items))
+	seen := map[string]bool{}
+	for i, item := range items {
+		object, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		name, ok := object["name"].(string)
+		if !ok || name == "" || seen[name] {
+			return nil, false
+		}
+		seen[name] = true
+		names[i] = name
+	}
+	return names, len(names) > 0
+}
+
+// isEmptyValue returns true for a field that is not set: nil, or an empty object or list
+func isEmptyValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// isScalarEqual compares 2 values that are not objects or lists.
+// Numbers are equal when they have the same value, whether they are stored as integers or floats.
+// The quantities of resource limits and requests are equal when they are the same amount, like 0.5 and 500m.
+func isScalarEqual(pattern []string, current, desired interface{}) bool {
+	if currentNumber, ok := toFloat(current); ok {
+		if desiredNumber, ok := toFloat(desired); ok {
+			return currentNumber == desiredNumber
+		}
+	}
+	if reflect.DeepEqual(current, desired) {
+		return true
+	}
+	currentString, currentOK := current.(string)
+	desiredString, desiredOK := desired.(string)
+	if currentOK && desiredOK && len(pattern) >= 2 && isQuantityList(pattern[len(pattern)-2]) {
+		currentQuantity, err := resource.ParseQuantity(currentString)
+		if err != nil {
+			return false
+		}
+		desiredQuantity, err := resource.ParseQuantity(desiredString)
+		if err != nil {
+			return false
+		}
+		return currentQuantity.Cmp(desiredQuantity) == 0
+	}
+	return false
+}
+
+// isQuantityList returns true for the fields that hold resource quantities
+func isQuantityList(field string) bool {
+	return field == "limits" || field == "requests"
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
@@ -0,0 +1,333 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package resources
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name    string
+		current map[string]interface{}
+		desired map[string]interface{}
+		options DiffOptions
+		want    []string
+	}{
+		{
+			name: "server defaulted field is ignored",
+			current: map[string]interface{}{
+				"spec": map[string]interface{}{"replicas": int64(1), "revisionHistoryLimit": int64(10)},
+			},
+			desired: map[string]interface{}{
+				"spec": map[string]interface{}{"replicas": int64(1)},
+			},
+			options: DiffOptions{Fields: []string{"spec"}},
+		},
+		{
+			name: "server defaulted field is compared when owned",
+			current: map[string]interface{}{
+				"spec": map[string]interface{}{"replicas": int64(1), "revisionHistoryLimit": int64(10)},
+			},
+			desired: map[string]interface{}{
+				"spec": map[string]interface{}{"replicas": int64(1)},
+			},
+			options: DiffOptions{Fields: []string{"spec"}, Owned: []string{"spec.revisionHistoryLimit"}},
+			want:    []string{"spec.revisionHistoryLimit"},
+		},
+		{
+			name: "owned field removed",
+			current: map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": map[string]interface{}{"app": "receiver", "extra": "true"}},
+			},
+			desired: map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": map[string]interface{}{"app": "receiver"}},
+			},
+			options: DiffOptions{Fields: []string{"metadata.labels"}, Owned: labelsOwnedFields},
+			want:    []string{"metadata.labels.extra"},
+		},
+		{
+			name: "owned object removed",
+			current: map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": map[string]interface{}{"app": "receiver"}},
+			},
+			desired: map[string]interface{}{},
+			options: DiffOptions{Fields: []string{"metadata.labels"}, Owned: labelsOwnedFields},
+			want:    []string{"metadata.labels"},
+		},
+		{
+			name: "named list reordered",
+			current: map[string]interface{}{
+				"env": []interface{}{
+					map[string]interface{}{"name": "B", "value": "2"},
+					map[string]interface{}{"name": "A", "value": "1"},
+				},
+			},
+			desired: map[string]interface{}{
+				"env": []interface{}{
+					map[string]interface{}{"name": "A", "value": "1"},
+					map[string]interface{}{"name": "B", "value": "2"},
+				},
+			},
+			options: DiffOptions{Fields: []string{"env"}},
+		},
+		{
+			name: "named list item changed and removed",
+			current: map[string]interface{}{
+				"env": []interface{}{
+					map[string]interface{}{"name": "B", "value": "2"},
+					map[string]interface{}{"name": "A", "value": "0"},
+					map[string]interface{}{"name": "C", "value": "3"},
+				},
+			},
+			desired: map[string]interface{}{
+				"env": []interface{}{
+					map[string]interface{}{"name": "A", "value": "1"},
+					map[string]interface{}{"name": "B", "value": "2"},
+				},
+			},
+			options: DiffOptions{Fields: []string{"env"}},
+			want:    []string{"env[A].value", "env[C]"},
+		},
+		{
+			name: "current list items without unique names",
+			current: map[string]interface{}{
+				"env": []interface{}{
+					map[string]interface{}{"name": "A", "value": "1"},
+					map[string]interface{}{"name": "A", "value": "1"},
+					map[string]interface{}{"name": "B", "value": "2"},
+				},
+			},
+			desired: map[string]interface{}{
+				"env": []interface{}{
+					map[string]interface{}{"name": "A", "value": "1"},
+					map[string]interface{}{"name": "B", "value": "2"},
+				},
+			},
+			options: DiffOptions{Fields: []string{"env"}},
+			want:    []string{"env[1].name", "env[1].value", "env[2]"},
+		},
+		{
+			name: "named list created",
+			current: map[string]interface{}{
+				"env": []interface{}{},
+			},
+			desired: map[string]interface{}{
+				"env": []interface{}{
+					map[string]interface{}{"name": "A", "value": "1"},
+				},
+			},
+			options: DiffOptions{Fields: []string{"env"}},
+			want:    []string{"env[A]"},
+		},
+		{
+			name: "unnamed list with the same items",
+			current: map[string]interface{}{
+				"ports": []interface{}{
+					map[string]interface{}{"port": int64(5000), "protocol": "TCP"},
+				},
+			},
+			desired: map[string]interface{}{
+				"ports": []interface{}{
+					map[string]interface{}{"port": int64(5000)},
+				},
+			},
+			options: DiffOptions{Fields: []string{"ports"}},
+		},
+		{
+			name: "unnamed list with an extra item",
+			current: map[string]interface{}{
+				"ports": []interface{}{
+					map[string]interface{}{"port": int64(5000)},
+					map[string]interface{}{"port": int64(5001)},
+				},
+			},
+			desired: map[string]interface{}{
+				"ports": []interface{}{
+					map[string]interface{}{"port": int64(5000)},
+				},
+			},
+			options: DiffOptions{Fields: []string{"ports"}},
+			want:    []string{"ports[1]"},
+		},
+		{
+			name: "unnamed list with a missing item",
+			current: map[string]interface{}{
+				"ports": []interface{}{
+					map[string]interface{}{"port": int64(5000)},
+				},
+			},
+			desired: map[string]interface{}{
+				"ports": []interface{}{
+					map[string]interface{}{"port": int64(5000)},
+					map[string]interface{}{"port": int64(5001)},
+				},
+			},
+			options: DiffOptions{Fields: []string{"ports"}},
+			want:    []string{"ports[1]"},
+		},
+		{
+			name: "unnamed list reordered",
+			current: map[string]interface{}{
+				"args": []interface{}{"--b", "--a"},
+			},
+			desired: map[string]interface{}{
+				"args": []interface{}{"--a", "--b"},
+			},
+			options: DiffOptions{Fields: []string{"args"}},
+			want:    []string{"args[0]", "args[1]"},
+		},
+		{
+			name: "equal quantities",
+			current: map[string]interface{}{
+				"resources": map[string]interface{}{
+					"limits":   map[string]interface{}{"cpu": "0.1", "memory": "134217728"},
+					"requests": map[string]interface{}{"cpu": "100m", "memory": "128Mi"},
+				},
+			},
+			desired: map[string]interface{}{
+				"resources": map[string]interface{}{
+					"limits":   map[string]interface{}{"cpu": "100m", "memory": "128Mi"},
+					"requests": map[string]interface{}{"cpu": "0.1", "memory": "134217728"},
+				},
+			},
+			options: DiffOptions{Fields: []string{"resources"}},
+		},
+		{
+			name: "different quantities",
+			current: map[string]interface{}{
+				"resources": map[string]interface{}{"limits": map[string]interface{}{"cpu": "0.2", "memory": "128M"}},
+			},
+			desired: map[string]interface{}{
+				"resources": map[string]interface{}{"limits": map[string]interface{}{"cpu": "100m", "memory": "128Mi"}},
+			},
+			options: DiffOptions{Fields: []string{"resources"}},
+			want:    []string{"resources.limits.cpu", "resources.limits.memory"},
+		},
+		{
+			name: "quantities are only parsed in limits and requests",
+			current: map[string]interface{}{
+				"metadata": map[string]interface{}{"annotations": map[string]interface{}{"cpu": "0.1"}},
+			},
+			desired: map[string]interface{}{
+				"metadata": map[string]interface{}{"annotations": map[string]interface{}{"cpu": "100m"}},
+			},
+			options: DiffOptions{Fields: []string{"metadata.annotations"}},
+			want:    []string{"metadata.annotations.cpu"},
+		},
+		{
+			name: "integer and float numbers",
+			current: map[string]interface{}{
+				"spec": map[string]interface{}{"replicas": int64(2), "port": float64(5000), "weight": int32(1)},
+			},
+			desired: map[string]interface{}{
+				"spec": map[string]interface{}{"replicas": float64(2), "port": int64(5000), "weight": 1},
+			},
+			options: DiffOptions{Fields: []string{"spec"}},
+		},
+		{
+			name: "different numbers",
+			current: map[string]interface{}{
+				"spec": map[string]interface{}{"replicas": int64(2), "percentage": float64(0.5)},
+			},
+			desired: map[string]interface{}{
+				"spec": map[string]interface{}{"replicas": float64(2.5), "percentage": "0.5"},
+			},
+			options: DiffOptions{Fields: []string{"spec"}},
+			want:    []string{"spec.percentage", "spec.replicas"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diffs, err := Diff(tt.current, tt.desired, tt.options)
+			if err != nil {
+				t.Fatalf("Diff() error = %v", err)
+			}
+			got := DiffPaths(diffs)
+			if len(got) == 0 && len(tt.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsServiceEqualNodePort(t *testing.T) {
+	service := func(serviceType corev1.ServiceType, nodePort int32) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "metering-receiver", Labels: map[string]string{"app": "receiver"}},
+			Spec: corev1.ServiceSpec{
+				Type: serviceType,
+				Ports: []corev1.ServicePort{
+					{
+						Name:       ReceiverServicePortName,
+						Protocol:   corev1.ProtocolTCP,
+						Port:       5000,
+						TargetPort: intstr.FromInt(5000),
+						NodePort:   nodePort,
+					},
+				},
+				Selector: map[string]string{"app": "receiver"},
+			},
+		}
+	}
+	tests := []struct {
+		name    string
+		current *corev1.Service
+		desired *corev1.Service
+		want    bool
+	}{
+		{
+			name:    "node port allocated by Kubernetes",
+			current: service(corev1.ServiceTypeNodePort, 31234),
+			desired: service(corev1.ServiceTypeNodePort, 0),
+			want:    true,
+		},
+		{
+			name:    "node port allocated for a LoadBalancer",
+			current: service(corev1.ServiceTypeLoadBalancer, 31234),
+			desired: service(corev1.ServiceTypeLoadBalancer, 0),
+			want:    true,
+		},
+		{
+			name:    "node port changed in the spec",
+			current: service(corev1.ServiceTypeNodePort, 31234),
+			desired: service(corev1.ServiceTypeNodePort, 30500),
+			want:    false,
+		},
+		{
+			name:    "node port set on a ClusterIP Service",
+			current: service(corev1.ServiceTypeClusterIP, 31234),
+			desired: service(corev1.ServiceTypeClusterIP, 0),
+			want:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsServiceEqual(tt.current, tt.desired); got != tt.want {
+				t.Errorf("IsServiceEqual() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package resources
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	operatorv1beta1 "github.com/ibm/ibm-metering-receiver-operator/pkg/apis/operator/v1beta1"
+)
+
+// maxNameLength is the maximum length of the generated names.
+// Service names are DNS labels, so they can't be longer than 63 characters.
+const maxNameLength = 63
+
+// nameHashLength is the number of hex characters of the hash added to names that are shortened
+const nameHashLength = 8
+
+// ResourceNames are the names of the objects created for a MeteringReceiver.
+// The HorizontalPodAutoscaler and the PodDisruptionBudget have the name of the Deployment.
+type ResourceNames struct {
+	Deployment           string
+	Service              string
+	Ingress              string
+	Route                string
+	Certificate          string
+	CertSecret           string
+	CASecret             string
+	LoggingConfigMap     string
+	IngressNetworkPolicy string
+	EgressNetworkPolicy  string
+}
+
+// LegacyResourceNames are the fixed names used before several MeteringReceivers could run in one namespace
+var LegacyResourceNames = ResourceNames{
+	Deployment:           ReceiverDeploymentName,
+	Service:              ReceiverServiceName,
+	Ingress:              ReceiverIngressName,
+	Route:                ReceiverRouteName,
+	Certificate:          ReceiverCertName,
+	CertSecret:           ReceiverCertSecretName,
+	CASecret:             ReceiverCASecretName,
+	LoggingConfigMap:     LoggingConfigMapName,
+	IngressNetworkPolicy: ReceiverIngressNetworkPolicyName,
+	EgressNetworkPolicy:  ReceiverEgressNetworkPolicyName,
+}
+
+// InstanceResourceNames returns the names of the objects of the MeteringReceiver with the given name
+func InstanceResourceNames(instanceName string) ResourceNames {
+	return ResourceNames{
+		Deployment:           InstanceScopedName(instanceName, ""),
+		Service:              InstanceScopedName(instanceName, ""),
+		Ingress:              InstanceScopedName(instanceName, ""),
+		Route:                InstanceScopedName(instanceName, ""),
+		Certificate:          InstanceScopedName(instanceName, "-cert"),
+		CertSecret:           InstanceScopedName(instanceName, "-tls"),
+		CASecret:             InstanceScopedName(instanceName, "-ca"),
+		LoggingConfigMap:     InstanceScopedName(instanceName, "-logging"),
+		IngressNetworkPolicy: InstanceScopedName(instanceName, "-ingress"),
+		EgressNetworkPolicy:  InstanceScopedName(instanceName, "-egress"),
+	}
+}
+
+// ResourceNamesFor returns the names of the objects of the MeteringReceiver, as selected by its
+// operator.ibm.com/resource-naming annotation. The names are derived from the CR name when it is not set.
+func ResourceNamesFor(instance *operatorv1beta1.MeteringReceiver) ResourceNames {
+	if instance.Annotations[operatorv1beta1.ResourceNamingAnnotation] == operatorv1beta1.ResourceNamingLegacy {
+		return LegacyResourceNames
+	}
+	return InstanceResourceNames(instance.Name)
+}
+
+// InstanceScopedName returns metering-receiver-<instance name><suffix>.
+// The name is a valid DNS label: when the instance name has dots, or the name is longer than 63 characters,
+// the instance name is shortened and followed by a hash of the full instance name, so the names stay unique.
+func InstanceScopedName(instanceName, suffix string) string {
+	name := ReceiverDeploymentName + "-" + instanceName
+	if len(name)+len(suffix) <= maxNameLength && !strings.Contains(instanceName, ".") {
+		return name + suffix
+	}
+
+	hash := sha256.Sum256([]byte(instanceName))
+	hashSuffix := "-" + hex.EncodeToString(hash[:])[:nameHashLength] + suffix
+	name = strings.Replace(name, ".", "-", -1)
+	if len(name)+len(hashSuffix) > maxNameLength {
+		name = name[:maxNameLength-len(hashSuffix)]
+	}
+	return strings.TrimRight(name, "-") + hashSuffix
+}
@@ -0,0 +1,112 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package resources
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestInstanceScopedName(t *testing.T) {
+	// metering-receiver- is 18 characters, so a 45 character instance name is the longest that is not shortened
+	longest := strings.Repeat("x", 45)
+	tests := []struct {
+		name         string
+		instanceName string
+		suffix       string
+		want         string
+	}{
+		{
+			name:         "short name",
+			instanceName: "receiver",
+			want:         "metering-receiver-receiver",
+		},
+		{
+			name:         "short name with suffix",
+			instanceName: "receiver",
+			suffix:       "-tls",
+			want:         "metering-receiver-receiver-tls",
+		},
+		{
+			name:         "name with dots",
+			instanceName: "my.receiver",
+			want:         "metering-receiver-my-receiver-b2411bb6",
+		},
+		{
+			name:         "63 character name",
+			instanceName: longest,
+			want:         "metering-receiver-" + longest,
+		},
+		{
+			name:         "64 character name is shortened",
+			instanceName: longest + "x",
+			want:         "metering-receiver-" + strings.Repeat("x", 36) + "-" + shortHash(longest+"x"),
+		},
+		{
+			name:         "63 character name with suffix is shortened",
+			instanceName: longest,
+			suffix:       "-logging",
+			want:         "metering-receiver-" + strings.Repeat("x", 28) + "-" + shortHash(longest) + "-logging",
+		},
+		{
+			name:         "long name ending with a dash after truncation",
+			instanceName: strings.Repeat("x", 35) + "-" + strings.Repeat("y", 20),
+			want:         "metering-receiver-" + strings.Repeat("x", 35) + "-" + shortHash(strings.Repeat("x", 35)+"-"+strings.Repeat("y", 20)),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := InstanceScopedName(tt.instanceName, tt.suffix)
+			if got != tt.want {
+				t.Errorf("InstanceScopedName() = %v, want %v", got, tt.want)
+			}
+			if errs := validation.IsDNS1123Label(got); len(errs) > 0 {
+				t.Errorf("InstanceScopedName() = %v is not a DNS label: %v", got, errs)
+			}
+		})
+	}
+}
+
+func TestInstanceScopedNameUnique(t *testing.T) {
+	prefix := strings.Repeat("x", 60)
+	instanceNames := []string{
+		"my.receiver", "my-receiver", "my.receiver.a", "my-receiver.a",
+		prefix + "a", prefix + "b", prefix + "-a", prefix + ".a",
+	}
+	for _, suffix := range []string{"", "-cert", "-tls", "-ca", "-logging", "-ingress", "-egress"} {
+		seen := map[string]string{}
+		for _, instanceName := range instanceNames {
+			name := InstanceScopedName(instanceName, suffix)
+			if other, ok := seen[name]; ok {
+				t.Errorf("InstanceScopedName(%q, %q) = InstanceScopedName(%q, %q) = %v", instanceName, suffix, other, suffix, name)
+			}
+			seen[name] = instanceName
+			if len(name) > maxNameLength {
+				t.Errorf("InstanceScopedName(%q, %q) = %v is longer than %d characters", instanceName, suffix, name, maxNameLength)
+			}
+		}
+	}
+}
+
+func shortHash(instanceName string) string {
+	hash := sha256.Sum256([]byte(instanceName))
+	return hex.EncodeToString(hash[:])[:nameHashLength]
+}
@@ -18,15 +18,17 @@ package resources
 
 import (
 	"context"
-	"fmt"
-	"reflect"
-
-	certmgr "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha1"
+	"strings"
 
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
 	corev1 "k8s.io/api/core/v1"
 	netv1 "k8s.io/api/extensions/v1beta1"
+	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	apiregistrationv1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -62,11 +64,23 @@ func ReconcileService(client client.Client, instanceNamespace, serviceName, serv
 		logger.Info("Comparing " + serviceType + " Services")
 		if !IsServiceEqual(currentService, newService) {
 			logger.Info("Updating "+serviceType+" Service", "Service.Name", currentService.Name)
-			// Can't copy the entire Spec because ClusterIP is immutable
+			// Can't copy the entire Spec because ClusterIP is immutable,
+			// and the node ports are allocated by Kubernetes when they are not set
 			currentService.ObjectMeta.Name = newService.ObjectMeta.Name
 			currentService.ObjectMeta.Labels = newService.ObjectMeta.Labels
-			currentService.Spec.Ports = newService.Spec.Ports
+			currentService.ObjectMeta.Annotations = mergeServiceAnnotations(currentService.ObjectMeta.Annotations,
+				newService.ObjectMeta.Annotations)
+			currentService.Spec.Type = newService.Spec.Type
+			currentService.Spec.Ports = mergeServicePorts(currentService.Spec.Ports, newService.Spec.Ports,
+				hasNodePorts(newService.Spec.Type))
 			currentService.Spec.Selector = newService.Spec.Selector
+			currentService.Spec.LoadBalancerSourceRanges = newService.Spec.LoadBalancerSourceRanges
+			currentService.Spec.ExternalTrafficPolicy = newService.Spec.ExternalTrafficPolicy
+			if newService.Spec.Type != corev1.ServiceTypeLoadBalancer ||
+				newService.Spec.ExternalTrafficPolicy != corev1.ServiceExternalTrafficPolicyTypeLocal {
+				// a health check node port is only allocated for a LoadBalancer with the Local policy
+				currentService.Spec.HealthCheckNodePort = 0
+			}
 			err = client.Update(context.TODO(), currentService)
 			if err != nil {
 				logger.Error(err, "Failed to update "+serviceType+" Service",
@@ -78,6 +92,29 @@ func ReconcileService(client client.Client, instanceNamespace, serviceName, serv
 	return nil
 }
 
+// mergeServiceAnnotations returns the annotations of the current Service updated with the ones of the new Service.
+// The annotations the operator set before that are not in the new Service are removed,
+// the other annotations are kept because they are set by other controllers.
+func mergeServiceAnnotations(current, desired map[string]string) map[string]string {
+	merged := make(map[string]string, len(current)+len(desired))
+	for key, value := range current {
+		merged[key] = value
+	}
+	if applied := current[ServiceAnnotationsAnnotation]; applied != "" {
+		for _, key := range strings.Split(applied, ",") {
+			delete(merged, key)
+		}
+	}
+	delete(merged, ServiceAnnotationsAnnotation)
+	for key, value := range desired {
+		merged[key] = value
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	return merged
+}
+
 // Check if a Deployment already exists. If not, create a new one.
 func ReconcileDeployment(client client.Client, instanceNamespace, deploymentName, deploymentType string,
 	newDeployment *appsv1.Deployment, needToRequeue *bool) error {
@@ -111,12 +148,11 @@ func ReconcileDeployment(client client.Client, instanceNamespace, deploymentName
 			logger.Info("Updating "+deploymentType+" Deployment", "Deployment.Name", currentDeployment.Name)
 			currentDeployment.ObjectMeta.Name = newDeployment.ObjectMeta.Name
 			currentDeployment.ObjectMeta.Labels = newDeployment.ObjectMeta.Labels
-			currentReplicas := *currentDeployment.Spec.Replicas
+			currentReplicas := currentDeployment.Spec.Replicas
 			currentDeployment.Spec = newDeployment.Spec
-			if currentReplicas == 0 {
-				// since currentDeployment has been scaled to 0,
-				// don't use the default replica count in newDeployment.
-				currentDeployment.Spec.Replicas = &currentReplicas
+			if newDeployment.Spec.Replicas == nil {
+				// the replicas are managed by a HorizontalPodAutoscaler, so keep the current count
+				currentDeployment.Spec.Replicas = currentReplicas
 			}
 			err = client.Update(context.TODO(), currentDeployment)
 			if err != nil {
@@ -129,6 +165,80 @@ func ReconcileDeployment(client client.Client, instanceNamespace, deploymentName
 	return nil
 }
 
+// hasNodePorts returns true if Kubernetes allocates node ports for the Service type
+func hasNodePorts(serviceType corev1.ServiceType) bool {
+	return serviceType == corev1.ServiceTypeNodePort || serviceType == corev1.ServiceTypeLoadBalancer
+}
+
+// mergeServicePorts returns the new ports. When keepNodePorts is true, a new port without a node port
+// gets the node port of the current port with the same name, so that it is not allocated again.
+func mergeServicePorts(currentPorts, newPorts []corev1.ServicePort, keepNodePorts bool) []corev1.ServicePort {
+	ports := make([]corev1.ServicePort, len(newPorts))
+	for i, newPort := range newPorts {
+		ports[i] = newPort
+		if !keepNodePorts || newPort.NodePort != 0 {
+			continue
+		}
+		for _, currentPort := range currentPorts {
+			if currentPort.Name == newPort.Name {
+				ports[i].NodePort = currentPort.NodePort
+				break
+			}
+		}
+	}
+	return ports
+}
+
+// Check if the ConfigMap already exists, if not create a new one.
+// The ConfigMap can be shared with other operators, so only the keys of the new ConfigMap are updated.
+func ReconcileConfigMap(client client.Client, instanceNamespace, configMapName, configMapType string,
+	newConfigMap *corev1.ConfigMap, needToRequeue *bool) error {
+	logger := log.WithValues("func", "ReconcileConfigMap")
+
+	currentConfigMap := &corev1.ConfigMap{}
+	err := client.Get(context.TODO(), types.NamespacedName{Name: configMapName, Namespace: instanceNamespace}, currentConfigMap)
+	if err != nil && errors.IsNotFound(err) {
+		// Create a new ConfigMap
+		logger.Info("Creating a new "+configMapType+" ConfigMap", "ConfigMap.Namespace", newConfigMap.Namespace,
+			"ConfigMap.Name", newConfigMap.Name)
+		err = client.Create(context.TODO(), newConfigMap)
+		if err != nil && errors.IsAlreadyExists(err) {
+			// Already exists from previous reconcile, requeue
+			logger.Info(configMapType + " ConfigMap already exists")
+			*needToRequeue = true
+		} else if err != nil {
+			logger.Error(err, "Failed to create new "+configMapType+" ConfigMap", "ConfigMap.Namespace", newConfigMap.Namespace,
+				"ConfigMap.Name", newConfigMap.Name)
+			return err
+		} else {
+			// ConfigMap created successfully - return and requeue
+			*needToRequeue = true
+		}
+	} else if err != nil {
+		logger.Error(err, "Failed to get "+configMapType+" ConfigMap", "ConfigMap.Name", configMapName)
+		return err
+	} else {
+		// Found ConfigMap, so determine if the resource has changed
+		logger.Info("Comparing " + configMapType + " ConfigMaps")
+		if !IsConfigMapEqual(currentConfigMap, newConfigMap) {
+			logger.Info("Updating "+configMapType+" ConfigMap", "ConfigMap.Name", currentConfigMap.Name)
+			if currentConfigMap.Data == nil {
+				currentConfigMap.Data = map[string]string{}
+			}
+			for key, value := range newConfigMap.Data {
+				currentConfigMap.Data[key] = value
+			}
+			err = client.Update(context.TODO(), currentConfigMap)
+			if err != nil {
+				logger.Error(err, "Failed to update "+configMapType+" ConfigMap",
+					"ConfigMap.Namespace", currentConfigMap.Namespace, "ConfigMap.Name", currentConfigMap.Name)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // Check if the Ingress already exists, if not create a new one.
 func ReconcileIngress(client client.Client, instanceNamespace, ingressName, ingressType string,
 	newIngress *netv1.Ingress, needToRequeue *bool) error {
@@ -175,44 +285,50 @@ func ReconcileIngress(client client.Client, instanceNamespace, ingressName, ingr
 	return nil
 }
 
-// Check if the Certificates already exist, if not create new ones.
-func ReconcileCertificate(client client.Client, instanceNamespace, certificateName string,
-	newCertificate *certmgr.Certificate, needToRequeue *bool) error {
-	logger := log.WithValues("func", "ReconcileCertificate")
+// Check if the Route already exists, if not create a new one.
+func ReconcileRoute(client client.Client, instanceNamespace, routeName, routeType string,
+	newRoute *unstructured.Unstructured, needToRequeue *bool) error {
+	logger := log.WithValues("func", "ReconcileRoute")
 
-	currentCertificate := &certmgr.Certificate{}
-	err := client.Get(context.TODO(), types.NamespacedName{Name: certificateName, Namespace: instanceNamespace}, currentCertificate)
+	currentRoute := NewRoute()
+	err := client.Get(context.TODO(), types.NamespacedName{Name: routeName, Namespace: instanceNamespace}, currentRoute)
 	if err != nil && errors.IsNotFound(err) {
-		// Create a new Certificate
-		logger.Info("Creating a new Certificate", "Certificate.Namespace", newCertificate.Namespace, "Certificate.Name", newCertificate.Name)
-		err = client.Create(context.TODO(), newCertificate)
+		// Create a new Route
+		logger.Info("Creating a new "+routeType+" Route", "Route.Namespace", newRoute.GetNamespace(), "Route.Name", newRoute.GetName())
+		err = client.Create(context.TODO(), newRoute)
 		if err != nil && errors.IsAlreadyExists(err) {
 			// Already exists from previous reconcile, requeue
-			logger.Info("Certificate already exists")
+			logger.Info(routeType + " Route already exists")
 			*needToRequeue = true
 		} else if err != nil {
-			logger.Error(err, "Failed to create new Certificate", "Certificate.Namespace", newCertificate.Namespace,
-				"Certificate.Name", newCertificate.Name)
+			logger.Error(err, "Failed to create new "+routeType+" Route", "Route.Namespace", newRoute.GetNamespace(),
+				"Route.Name", newRoute.GetName())
 			return err
 		} else {
-			// Certificate created successfully - return and requeue
+			// Route created successfully - return and requeue
 			*needToRequeue = true
 		}
 	} else if err != nil {
-		logger.Error(err, "Failed to get Certificate", "Certificate.Name", certificateName)
+		logger.Error(err, "Failed to get "+routeType+" Route", "Route.Name", routeName)
 		return err
 	} else {
-		// Found Certificate, so determine if the resource has changed
-		logger.Info("Comparing Certificates")
-		if !IsCertificateEqual(currentCertificate, newCertificate) {
-			logger.Info("Updating Certificate", "Certificate.Name", currentCertificate.Name)
-			currentCertificate.ObjectMeta.Name = newCertificate.ObjectMeta.Name
-			currentCertificate.ObjectMeta.Labels = newCertificate.ObjectMeta.Labels
-			currentCertificate.Spec = newCertificate.Spec
-			err = client.Update(context.TODO(), currentCertificate)
+		// Found Route, so determine if the resource has changed
+		logger.Info("Comparing " + routeType + " Routes")
+		if !IsRouteEqual(currentRoute, newRoute) {
+			logger.Info("Updating "+routeType+" Route", "Route.Name", currentRoute.GetName())
+			// keep the host that OpenShift generated when no host is set
+			newSpec, _, _ := unstructured.NestedMap(newRoute.Object, "spec")
+			if _, ok := newSpec["host"]; !ok {
+				if host, found, _ := unstructured.NestedString(currentRoute.Object, "spec", "host"); found {
+					newSpec["host"] = host
+				}
+			}
+			currentRoute.SetLabels(newRoute.GetLabels())
+			currentRoute.Object["spec"] = newSpec
+			err = client.Update(context.TODO(), currentRoute)
 			if err != nil {
-				logger.Error(err, "Failed to update Certificate", "Certificate.Namespace", currentCertificate.Namespace,
-					"Certificate.Name", currentCertificate.Name)
+				logger.Error(err, "Failed to update "+routeType+" Route",
+					"Route.Namespace", currentRoute.GetNamespace(), "Route.Name", currentRoute.GetName())
 				return err
 			}
 		}
@@ -220,426 +336,417 @@ func ReconcileCertificate(client client.Client, instanceNamespace, certificateNa
 	return nil
 }
 
-// Use DeepEqual to determine if 2 deployments are equal.
-// Check labels, replicas, pod template labels, service account names, volumes,
-// containers, init containers, image name, volume mounts, env vars, liveness, readiness.
-// If there are any differences, return false. Otherwise, return true.
-// oldDeployment is the deployment that is currently running.
-// newDeployment is what we expect the deployment to look like.
-func IsDeploymentEqual(oldDeployment, newDeployment *appsv1.Deployment) bool {
-	logger := log.WithValues("func", "IsDeploymentEqual")
-
-	if !reflect.DeepEqual(oldDeployment.ObjectMeta.Name, newDeployment.ObjectMeta.Name) {
-		logger.Info("Names not equal", "old", oldDeployment.ObjectMeta.Name, "new", newDeployment.ObjectMeta.Name)
-		return false
-	}
+// Check if the NetworkPolicy already exists, if not create a new one.
+func ReconcileNetworkPolicy(client client.Client, instanceNamespace, policyName, policyType string,
+	newPolicy *networkingv1.NetworkPolicy, needToRequeue *bool) error {
+	logger := log.WithValues("func", "ReconcileNetworkPolicy")
 
-	if !reflect.DeepEqual(oldDeployment.ObjectMeta.Labels, newDeployment.ObjectMeta.Labels) {
-		logger.Info("Labels not equal",
-			"old", fmt.Sprintf("%v", oldDeployment.ObjectMeta.Labels),
-			"new", fmt.Sprintf("%v", newDeployment.ObjectMeta.Labels))
-		return false
-	}
-
-	if *oldDeployment.Spec.Replicas != *newDeployment.Spec.Replicas {
-		if *oldDeployment.Spec.Replicas == 0 {
-			logger.Info("Allowing deployment to scale to 0", "name", oldDeployment.ObjectMeta.Name)
+	currentPolicy := &networkingv1.NetworkPolicy{}
+	err := client.Get(context.TODO(), types.NamespacedName{Name: policyName, Namespace: instanceNamespace}, currentPolicy)
+	if err != nil && errors.IsNotFound(err) {
+		// Create a new NetworkPolicy
+		logger.Info("Creating a new "+policyType+" NetworkPolicy", "NetworkPolicy.Namespace", newPolicy.Namespace,
+			"NetworkPolicy.Name", newPolicy.Name)
+		err = client.Create(context.TODO(), newPolicy)
+		if err != nil && errors.IsAlreadyExists(err) {
+			// Already exists from previous reconcile, requeue
+			logger.Info(policyType + " NetworkPolicy already exists")
+			*needToRequeue = true
+		} else if err != nil {
+			logger.Error(err, "Failed to create new "+policyType+" NetworkPolicy", "NetworkPolicy.Namespace", newPolicy.Namespace,
+				"NetworkPolicy.Name", newPolicy.Name)
+			return err
 		} else {
-			logger.Info("Replicas not equal", "old", oldDeployment.Spec.Replicas, "new", newDeployment.Spec.Replicas)
-			return false
+			// NetworkPolicy created successfully - return and requeue
+			*needToRequeue = true
+		}
+	} else if err != nil {
+		logger.Error(err, "Failed to get "+policyType+" NetworkPolicy", "NetworkPolicy.Name", policyName)
+		return err
+	} else {
+		// Found NetworkPolicy, so determine if the resource has changed
+		logger.Info("Comparing " + policyType + " NetworkPolicies")
+		if !IsNetworkPolicyEqual(currentPolicy, newPolicy) {
+			logger.Info("Updating "+policyType+" NetworkPolicy", "NetworkPolicy.Name", currentPolicy.Name)
+			currentPolicy.ObjectMeta.Name = newPolicy.ObjectMeta.Name
+			currentPolicy.ObjectMeta.Labels = newPolicy.ObjectMeta.Labels
+			currentPolicy.Spec = newPolicy.Spec
+			err = client.Update(context.TODO(), currentPolicy)
+			if err != nil {
+				logger.Error(err, "Failed to update "+policyType+" NetworkPolicy",
+					"NetworkPolicy.Namespace", currentPolicy.Namespace, "NetworkPolicy.Name", currentPolicy.Name)
+				return err
+			}
 		}
 	}
-
-	oldPodTemplate := oldDeployment.Spec.Template
-	newPodTemplate := newDeployment.Spec.Template
-	if !isPodTemplateEqual(oldPodTemplate, newPodTemplate) {
-		return false
-	}
-
-	logger.Info("Deployments are equal", "Deployment.Name", oldDeployment.ObjectMeta.Name)
-	return true
+	return nil
 }
 
-// Use DeepEqual to determine if 2 APIService are equal.
-// Check labels, insecureSkipTLSVerify, service name and service namespace.
-// If there are any differences, return false. Otherwise, return true.
-func IsAPIServiceEqual(oldAPIService, newAPIService *apiregistrationv1.APIService) bool {
-	logger := log.WithValues("func", "IsAPIServiceEqual")
+// Check if the PodDisruptionBudget already exists, if not create a new one.
+func ReconcilePodDisruptionBudget(client client.Client, instanceNamespace, pdbName, pdbType string,
+	newPDB *unstructured.Unstructured, needToRequeue *bool) error {
+	logger := log.WithValues("func", "ReconcilePodDisruptionBudget")
 
-	if !reflect.DeepEqual(oldAPIService.ObjectMeta.Name, newAPIService.ObjectMeta.Name) {
-		logger.Info("Names not equal", "old", oldAPIService.ObjectMeta.Name, "new", newAPIService.ObjectMeta.Name)
-		return false
-	}
-
-	if !reflect.DeepEqual(oldAPIService.ObjectMeta.Labels, newAPIService.ObjectMeta.Labels) {
-		logger.Info("Labels not equal",
-			"old", fmt.Sprintf("%v", oldAPIService.ObjectMeta.Labels),
-			"new", fmt.Sprintf("%v", newAPIService.ObjectMeta.Labels))
-		return false
-	}
-
-	if !reflect.DeepEqual(oldAPIService.Spec.InsecureSkipTLSVerify, newAPIService.Spec.InsecureSkipTLSVerify) {
-		logger.Info("InsecureSkipTLSVerify not equal", "old", oldAPIService.Spec.InsecureSkipTLSVerify, "new", newAPIService.Spec.InsecureSkipTLSVerify)
-		return false
+	currentPDB := NewPodDisruptionBudget(newPDB.GroupVersionKind())
+	err := client.Get(context.TODO(), types.NamespacedName{Name: pdbName, Namespace: instanceNamespace}, currentPDB)
+	if err != nil && errors.IsNotFound(err) {
+		// Create a new PodDisruptionBudget
+		logger.Info("Creating a new "+pdbType+" PodDisruptionBudget", "PDB.Namespace", newPDB.GetNamespace(), "PDB.Name", newPDB.GetName())
+		err = client.Create(context.TODO(), newPDB)
+		if err != nil && errors.IsAlreadyExists(err) {
+			// Already exists from previous reconcile, requeue
+			logger.Info(pdbType + " PodDisruptionBudget already exists")
+			*needToRequeue = true
+		} else if err != nil {
+			logger.Error(err, "Failed to create new "+pdbType+" PodDisruptionBudget", "PDB.Namespace", newPDB.GetNamespace(),
+				"PDB.Name", newPDB.GetName())
+			return err
+		} else {
+			// PodDisruptionBudget created successfully - return and requeue
+			*needToRequeue = true
+		}
+	} else if err != nil {
+		logger.Error(err, "Failed to get "+pdbType+" PodDisruptionBudget", "PDB.Name", pdbName)
+		return err
+	} else {
+		// Found PodDisruptionBudget, so determine if the resource has changed
+		logger.Info("Comparing " + pdbType + " PodDisruptionBudgets")
+		if !IsPodDisruptionBudgetEqual(currentPDB, newPDB) {
+			logger.Info("Updating "+pdbType+" PodDisruptionBudget", "PDB.Name", currentPDB.GetName())
+			currentPDB.SetLabels(newPDB.GetLabels())
+			currentPDB.Object["spec"] = newPDB.Object["spec"]
+			err = client.Update(context.TODO(), currentPDB)
+			if err != nil {
+				logger.Error(err, "Failed to update "+pdbType+" PodDisruptionBudget",
+					"PDB.Namespace", currentPDB.GetNamespace(), "PDB.Name", currentPDB.GetName())
+				return err
+			}
+		}
 	}
+	return nil
+}
 
-	if !reflect.DeepEqual(oldAPIService.Spec.Service.Name, newAPIService.Spec.Service.Name) {
-		logger.Info("Service name not equal", "old", oldAPIService.Spec.Service.Name, "new", newAPIService.Spec.Service.Name)
-		return false
-	}
+// Check if the HorizontalPodAutoscaler already exists, if not create a new one.
+func ReconcileHorizontalPodAutoscaler(client client.Client, instanceNamespace, hpaName, hpaType string,
+	newHPA *autoscalingv2beta2.HorizontalPodAutoscaler, needToRequeue *bool) error {
+	logger := log.WithValues("func", "ReconcileHorizontalPodAutoscaler")
 
-	if !reflect.DeepEqual(oldAPIService.Spec.Service.Namespace, newAPIService.Spec.Service.Namespace) {
-		logger.Info("Service namespace not equal", "old", oldAPIService.Spec.Service.Namespace, "new", newAPIService.Spec.Service.Namespace)
-		return false
+	currentHPA := &autoscalingv2beta2.HorizontalPodAutoscaler{}
+	err := client.Get(context.TODO(), types.NamespacedName{Name: hpaName, Namespace: instanceNamespace}, currentHPA)
+	if err != nil && errors.IsNotFound(err) {
+		// Create a new HorizontalPodAutoscaler
+		logger.Info("Creating a new "+hpaType+" HorizontalPodAutoscaler", "HPA.Namespace", newHPA.Namespace, "HPA.Name", newHPA.Name)
+		err = client.Create(context.TODO(), newHPA)
+		if err != nil && errors.IsAlreadyExists(err) {
+			// Already exists from previous reconcile, requeue
+			logger.Info(hpaType + " HorizontalPodAutoscaler already exists")
+			*needToRequeue = true
+		} else if err != nil {
+			logger.Error(err, "Failed to create new "+hpaType+" HorizontalPodAutoscaler", "HPA.Namespace", newHPA.Namespace,
+				"HPA.Name", newHPA.Name)
+			return err
+		} else {
+			// HorizontalPodAutoscaler created successfully - return and requeue
+			*needToRequeue = true
+		}
+	} else if err != nil {
+		logger.Error(err, "Failed to get "+hpaType+" HorizontalPodAutoscaler", "HPA.Name", hpaName)
+		return err
+	} else {
+		// Found HorizontalPodAutoscaler, so determine if the resource has changed
+		logger.Info("Comparing " + hpaType + " HorizontalPodAutoscalers")
+		if !IsHorizontalPodAutoscalerEqual(currentHPA, newHPA) {
+			logger.Info("Updating "+hpaType+" HorizontalPodAutoscaler", "HPA.Name", currentHPA.Name)
+			currentHPA.ObjectMeta.Name = newHPA.ObjectMeta.Name
+			currentHPA.ObjectMeta.Labels = newHPA.ObjectMeta.Labels
+			currentHPA.Spec = newHPA.Spec
+			err = client.Update(context.TODO(), currentHPA)
+			if err != nil {
+				logger.Error(err, "Failed to update "+hpaType+" HorizontalPodAutoscaler",
+					"HPA.Namespace", currentHPA.Namespace, "HPA.Name", currentHPA.Name)
+				return err
+			}
+		}
 	}
-
-	logger.Info("APIService are equal", "APIService.Name", oldAPIService.ObjectMeta.Name)
-	return true
+	return nil
 }
 
-// Use DeepEqual to determine if 2 daemon sets are equal.
-// Check labels, pod template labels, service account names, volumes,
-// containers, init containers, image name, volume mounts, env vars, liveness, readiness.
-// If there are any differences, return false. Otherwise, return true.
-func IsDaemonSetEqual(oldDaemonSet, newDaemonSet *appsv1.DaemonSet) bool {
-	logger := log.WithValues("func", "IsDaemonSetEqual")
-
-	if !reflect.DeepEqual(oldDaemonSet.ObjectMeta.Name, newDaemonSet.ObjectMeta.Name) {
-		logger.Info("Names not equal", "old", oldDaemonSet.ObjectMeta.Name, "new", newDaemonSet.ObjectMeta.Name)
-		return false
+// Delete an object that is no longer needed, if it exists.
+// obj is used to get the object, so it must be an empty object of the right type.
+// When owner is not nil, the object is only deleted if it is controlled by owner, so an object with the same name
+// created by a user or by another controller is left alone. A nil owner is for callers that checked the object themselves.
+func DeleteIfExists(client client.Client, owner metav1.Object, instanceNamespace, name, kind string, obj runtime.Object) error {
+	logger := log.WithValues("func", "DeleteIfExists")
+
+	err := client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: instanceNamespace}, obj)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		logger.Error(err, "Failed to get "+kind, "Namespace", instanceNamespace, "Name", name)
+		return err
 	}
-
-	if !reflect.DeepEqual(oldDaemonSet.ObjectMeta.Labels, newDaemonSet.ObjectMeta.Labels) {
-		logger.Info("Labels not equal",
-			"old", fmt.Sprintf("%v", oldDaemonSet.ObjectMeta.Labels),
-			"new", fmt.Sprintf("%v", newDaemonSet.ObjectMeta.Labels))
-		return false
+	if owner != nil {
+		object, ok := obj.(metav1.Object)
+		if !ok || !metav1.IsControlledBy(object, owner) {
+			logger.Info("Not deleting "+kind+" that is not controlled by the operator", "Namespace", instanceNamespace, "Name", name)
+			return nil
+		}
 	}
-
-	oldPodTemplate := oldDaemonSet.Spec.Template
-	newPodTemplate := newDaemonSet.Spec.Template
-	if !isPodTemplateEqual(oldPodTemplate, newPodTemplate) {
-		return false
+	logger.Info("Deleting "+kind, "Namespace", instanceNamespace, "Name", name)
+	err = client.Delete(context.TODO(), obj)
+	if err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Failed to delete "+kind, "Namespace", instanceNamespace, "Name", name)
+		return err
 	}
-
-	logger.Info("DaemonSets are equal", "DaemonSet.Name", oldDaemonSet.ObjectMeta.Name)
-
-	return true
+	return nil
 }
 
-// Use DeepEqual to determine if 2 pod templates are equal.
-// Check pod template labels, service account names, volumes,
-// containers, init containers, image name, volume mounts, env vars, liveness, readiness.
-// If there are any differences, return false. Otherwise, return true.
-func isPodTemplateEqual(oldPodTemplate, newPodTemplate corev1.PodTemplateSpec) bool {
-	logger := log.WithValues("func", "isPodTemplateEqual")
-
-	if !reflect.DeepEqual(oldPodTemplate.ObjectMeta.Labels, newPodTemplate.ObjectMeta.Labels) {
-		logger.Info("Pod labels not equal",
-			"old", fmt.Sprintf("%v", oldPodTemplate.ObjectMeta.Labels),
-			"new", fmt.Sprintf("%v", newPodTemplate.ObjectMeta.Labels))
-		return false
-	}
-
-	if !reflect.DeepEqual(oldPodTemplate.Spec.ServiceAccountName, newPodTemplate.Spec.ServiceAccountName) {
-		logger.Info("Service account names not equal",
-			"old", oldPodTemplate.Spec.ServiceAccountName,
-			"new", newPodTemplate.Spec.ServiceAccountName)
-		return false
-	}
+// Check if the Certificates already exist, if not create new ones.
+// The kind of newCertificate selects the cert-manager API.
+func ReconcileCertificate(client client.Client, instanceNamespace, certificateName string,
+	newCertificate *unstructured.Unstructured, needToRequeue *bool) error {
+	logger := log.WithValues("func", "ReconcileCertificate")
 
-	oldVolumes := oldPodTemplate.Spec.Volumes
-	newVolumes := newPodTemplate.Spec.Volumes
-	if len(oldVolumes) == len(newVolumes) {
-		if len(oldVolumes) > 0 {
-			for i := range oldVolumes {
-				oldVolume := oldVolumes[i]
-				newVolume := newVolumes[i]
-				if !reflect.DeepEqual(oldVolume.Name, newVolume.Name) {
-					logger.Info("Pod volume names not equal", "volume num", i,
-						"old", oldVolume.Name, "new", newVolume.Name)
-					return false
-				}
-				if !reflect.DeepEqual(oldVolume.VolumeSource, newVolume.VolumeSource) {
-					logger.Info("Pod volume sources not equal", "volume num", i,
-						"old", fmt.Sprintf("%+v", oldVolume.VolumeSource), "new", fmt.Sprintf("%+v", newVolume.VolumeSource))
-					return false
-				}
-			}
+	currentCertificate := NewCertificate(newCertificate.GroupVersionKind())
+	err := client.Get(context.TODO(), types.NamespacedName{Name: certificateName, Namespace: instanceNamespace}, currentCertificate)
+	if err != nil && errors.IsNotFound(err) {
+		// Create a new Certificate
+		logger.Info("Creating a new Certificate", "Certificate.Namespace", newCertificate.GetNamespace(),
+			"Certificate.Name", newCertificate.GetName(), "APIVersion", newCertificate.GetAPIVersion())
+		err = client.Create(context.TODO(), newCertificate)
+		if err != nil && errors.IsAlreadyExists(err) {
+			// Already exists from previous reconcile, requeue
+			logger.Info("Certificate already exists")
+			*needToRequeue = true
+		} else if err != nil {
+			logger.Error(err, "Failed to create new Certificate", "Certificate.Namespace", newCertificate.GetNamespace(),
+				"Certificate.Name", newCertificate.GetName())
+			return err
+		} else {
+			// Certificate created successfully - return and requeue
+			*needToRequeue = true
 		}
+	} else if err != nil {
+		logger.Error(err, "Failed to get Certificate", "Certificate.Name", certificateName)
+		return err
 	} else {
-		logger.Info("Volume lengths not equal")
-		return false
+		// Found Certificate, so determine if the resource has changed
+		logger.Info("Comparing Certificates")
+		if !IsCertificateEqual(currentCertificate, newCertificate) {
+			logger.Info("Updating Certificate", "Certificate.Name", currentCertificate.GetName())
+			currentCertificate.SetLabels(newCertificate.GetLabels())
+			currentCertificate.Object["spec"] = newCertificate.Object["spec"]
+			err = client.Update(context.TODO(), currentCertificate)
+			if err != nil {
+				logger.Error(err, "Failed to update Certificate", "Certificate.Namespace", currentCertificate.GetNamespace(),
+					"Certificate.Name", currentCertificate.GetName())
+				return err
+			}
+		}
 	}
+	return nil
+}
+
+// isEqual compares the fields of the current object with the object the operator expects,
+// and logs the fields that differ. kind is used in the log, like "Deployments".
+func isEqual(kind, name string, current, desired interface{}, options DiffOptions) bool {
+	logger := log.WithValues("func", "isEqual", "Kind", kind, "Name", name)
 
-	// check containers
-	oldContainers := oldPodTemplate.Spec.Containers
-	newContainers := newPodTemplate.Spec.Containers
-	if !isContainerEqual(oldContainers, newContainers, false) {
+	diffs, err := Diff(current, desired, options)
+	if err != nil {
+		// update the object, its fields will be right after the update
+		logger.Error(err, "Failed to compare "+kind)
 		return false
 	}
-
-	// check init containers
-	oldInitContainers := oldPodTemplate.Spec.InitContainers
-	newInitContainers := newPodTemplate.Spec.InitContainers
-	if !isContainerEqual(oldInitContainers, newInitContainers, true) {
+	if len(diffs) > 0 {
+		logger.Info(kind+" not equal", "fields", DiffPaths(diffs))
 		return false
 	}
-
-	logger.Info("Pod templates are equal")
+	logger.Info(kind + " are equal")
 	return true
 }
 
-// Use DeepEqual to determine if 2 container lists are equal.
-// Check count, name, image name, image pull policy, env vars, volume mounts.
-// If there are any differences, return false. Otherwise, return true.
-// Set isInitContainer to true when checking init containers.
-func isContainerEqual(oldContainers, newContainers []corev1.Container, isInitContainer bool) bool {
-	logger := log.WithValues("func", "isContainerEqual")
-
-	var containerType string
-	if isInitContainer {
-		containerType = "Init Container"
-	} else {
-		containerType = "Container"
-	}
-
-	if len(oldContainers) == len(newContainers) {
-		if len(oldContainers) > 0 {
-			for i := range oldContainers {
-				oldContainer := oldContainers[i]
-				newContainer := newContainers[i]
-				logger.Info("Checking "+containerType, "old", oldContainer.Name)
-				if !reflect.DeepEqual(oldContainer.Name, newContainer.Name) {
-					logger.Info(containerType+" names not equal", "container num", i, "old", oldContainer.Name, "new", newContainer.Name)
-					return false
-				}
-
-				if !reflect.DeepEqual(oldContainer.Image, newContainer.Image) {
-					logger.Info(containerType+" images not equal", "container num", i, "old", oldContainer.Image, "new", newContainer.Image)
-					return false
-				}
-
-				if !reflect.DeepEqual(oldContainer.ImagePullPolicy, newContainer.ImagePullPolicy) {
-					logger.Info(containerType+" image pull policies not equal", "container num", i,
-						"old", oldContainer.ImagePullPolicy, "new", newContainer.ImagePullPolicy)
-					return false
-				}
-
-				oldEnvVars := oldContainer.Env
-				newEnvVars := newContainer.Env
-				if len(oldEnvVars) != len(newEnvVars) {
-					logger.Info("Env var length not equal", "container num", i)
-					return false
-				} else if len(oldEnvVars) > 0 {
-					for j := range oldEnvVars {
-						oldEnvVar := oldEnvVars[j]
-						newEnvVar := newEnvVars[j]
-						if !reflect.DeepEqual(oldEnvVar.Name, newEnvVar.Name) {
-							logger.Info("Env var names not equal", "container num", i, "old", oldEnvVar.Name, "new", newEnvVar.Name)
-							return false
-						}
-						if !reflect.DeepEqual(oldEnvVar.Value, newEnvVar.Value) {
-							logger.Info("Env var values not equal", "container num", i, "var", oldEnvVar.Name,
-								"old", oldEnvVar.Value, "new", newEnvVar.Value)
-							return false
-						}
-						if oldEnvVar.ValueFrom != nil && newEnvVar.ValueFrom != nil {
-							if !reflect.DeepEqual(oldEnvVar.ValueFrom, newEnvVar.ValueFrom) {
-								logger.Info("Env var ValueFrom not equal", "container num", i, "var", oldEnvVar.Name,
-									"old", fmt.Sprintf("%+v", oldEnvVar.ValueFrom), "new", fmt.Sprintf("%+v", newEnvVar.ValueFrom))
-								return false
-							}
-						} else if !(oldEnvVar.ValueFrom == nil && newEnvVar.ValueFrom == nil) {
-							logger.Info("One of the env var's ValueFrom is nil", "container num", i, "var", oldEnvVar.Name)
-							return false
-						}
-					}
-				}
-
-				oldVolumeMounts := oldContainer.VolumeMounts
-				newVolumeMounts := newContainer.VolumeMounts
-				if len(oldVolumeMounts) == len(newVolumeMounts) {
-					if len(oldVolumeMounts) > 0 {
-						for i := range oldVolumeMounts {
-							oldVolumeMount := oldVolumeMounts[i]
-							newVolumeMount := newVolumeMounts[i]
-							if !reflect.DeepEqual(oldVolumeMount, newVolumeMount) {
-								logger.Info("Volume mounts not equal", "mount num", i, "container num", i,
-									"old", fmt.Sprintf("%+v", oldVolumeMount), "new", fmt.Sprintf("%+v", newVolumeMount))
-								return false
-							}
-						}
-					}
-				} else {
-					logger.Info("Volume mount lengths not equal", "container num", i)
-					return false
-				}
+// labelsOwnedFields are the labels of the object, the labels added by other tools are removed
+var labelsOwnedFields = []string{"metadata.labels", "metadata.labels.*"}
+
+// containerOwnedFields are the fields of the containers set by the operator.
+// The other fields, like terminationMessagePath or the probe thresholds, are defaulted by Kubernetes when they are not set.
+var containerOwnedFields = []string{
+	"command",
+	"args",
+	"workingDir",
+	"ports",
+	"env",
+	"env[].value",
+	"env[].valueFrom",
+	"resources",
+	"resources.limits",
+	"resources.limits.*",
+	"resources.requests",
+	"resources.requests.*",
+	"volumeMounts",
+	"securityContext",
+	"livenessProbe",
+	"livenessProbe.exec",
+	"livenessProbe.httpGet",
+	"livenessProbe.tcpSocket",
+	"livenessProbe.initialDelaySeconds",
+	"readinessProbe",
+	"readinessProbe.exec",
+	"readinessProbe.httpGet",
+	"readinessProbe.tcpSocket",
+	"readinessProbe.initialDelaySeconds",
+}
 
-				if !isInitContainer {
-					// check liveness and readiness probes
-					oldLiveness := oldContainer.LivenessProbe
-					newLiveness := newContainer.LivenessProbe
-					if !isProbeEqual(oldLiveness, newLiveness, "Liveness") {
-						return false
-					}
-					oldReadiness := oldContainer.ReadinessProbe
-					newReadiness := newContainer.ReadinessProbe
-					if !isProbeEqual(oldReadiness, newReadiness, "Readiness") {
-						return false
-					}
-				}
-			}
+// podTemplateOwnedFields returns the owned fields of the pod template at the given path.
+// The annotations of the pod template are not owned, they can be added by other tools, like kubectl rollout restart.
+func podTemplateOwnedFields(path string) []string {
+	fields := []string{
+		"metadata.labels",
+		"metadata.labels.*",
+		"spec.serviceAccountName",
+		"spec.nodeSelector",
+		"spec.nodeSelector.*",
+		"spec.affinity",
+		"spec.tolerations",
+		"spec.topologySpreadConstraints",
+		"spec.priorityClassName",
+		"spec.securityContext",
+		"spec.volumes",
+		"spec.volumes[].*",
+		"spec.initContainers",
+	}
+	for _, containers := range []string{"spec.containers[]", "spec.initContainers[]"} {
+		for _, field := range containerOwnedFields {
+			fields = append(fields, containers+"."+field)
 		}
-	} else {
-		logger.Info(containerType+" numbers not equal",
-			"old", len(oldContainers), "new", len(newContainers))
-		return false
 	}
-	return true
+	for i := range fields {
+		fields[i] = path + "." + fields[i]
+	}
+	return fields
 }
 
-// Use DeepEqual to determine if 2 probes are equal.
-// Check Handler, InitialDelaySeconds, TimeoutSeconds, PeriodSeconds.
+// Compare the name, labels, replicas and pod template of 2 deployments.
+// The replicas are not compared when they are not set in newDeployment, because they are managed by a HorizontalPodAutoscaler.
 // If there are any differences, return false. Otherwise, return true.
-func isProbeEqual(oldProbe, newProbe *corev1.Probe, probeType string) bool {
-	logger := log.WithValues("func", "isProbeEqual")
-	logger.Info("Checking " + probeType + " probe")
-
-	if oldProbe != nil && newProbe != nil {
-		if !reflect.DeepEqual(oldProbe.Handler, newProbe.Handler) {
-			logger.Info(probeType+" probe Handler not equal",
-				"old", fmt.Sprintf("%+v", oldProbe.Handler), "new", fmt.Sprintf("%+v", newProbe.Handler))
-			return false
-		}
-
-		if !reflect.DeepEqual(oldProbe.InitialDelaySeconds, newProbe.InitialDelaySeconds) {
-			logger.Info(probeType+" probe Initial delay seconds not equal",
-				"old", oldProbe.InitialDelaySeconds, "new", newProbe.InitialDelaySeconds)
-			return false
-		}
+// oldDeployment is the deployment that is currently running.
+// newDeployment is what we expect the deployment to look like.
+func IsDeploymentEqual(oldDeployment, newDeployment *appsv1.Deployment) bool {
+	return isEqual("Deployments", oldDeployment.Name, oldDeployment, newDeployment, DiffOptions{
+		Fields: []string{"metadata.name", "metadata.labels", "spec.replicas", "spec.template"},
+		Owned:  append(podTemplateOwnedFields("spec.template"), labelsOwnedFields...),
+	})
+}
 
-		if !reflect.DeepEqual(oldProbe.TimeoutSeconds, newProbe.TimeoutSeconds) {
-			logger.Info(probeType+" probe Timeout seconds not equal",
-				"old", oldProbe.TimeoutSeconds, "new", newProbe.TimeoutSeconds)
-			return false
-		}
+// Compare the name, labels, scale target, min and max replicas, and metrics of 2 HorizontalPodAutoscalers.
+// If there are any differences, return false. Otherwise, return true.
+func IsHorizontalPodAutoscalerEqual(oldHPA, newHPA *autoscalingv2beta2.HorizontalPodAutoscaler) bool {
+	return isEqual("HorizontalPodAutoscalers", oldHPA.Name, oldHPA, newHPA, DiffOptions{
+		Fields: []string{"metadata.name", "metadata.labels", "spec.scaleTargetRef", "spec.minReplicas", "spec.maxReplicas",
+			"spec.metrics"},
+		Owned: labelsOwnedFields,
+	})
+}
 
-		if !reflect.DeepEqual(oldProbe.PeriodSeconds, newProbe.PeriodSeconds) {
-			logger.Info(probeType+" probe Period seconds not equal",
-				"old", oldProbe.PeriodSeconds, "new", newProbe.PeriodSeconds)
-			return false
-		}
-	} else if !(oldProbe == nil && newProbe == nil) {
-		logger.Info("One "+probeType+" probe is nil",
-			"old", fmt.Sprintf("%+v", oldProbe), "new", fmt.Sprintf("%+v", newProbe))
-		return false
-	}
+// Compare the name, labels, insecureSkipTLSVerify, service name and service namespace of 2 APIServices.
+// If there are any differences, return false. Otherwise, return true.
+func IsAPIServiceEqual(oldAPIService, newAPIService *apiregistrationv1.APIService) bool {
+	return isEqual("APIServices", oldAPIService.Name, oldAPIService, newAPIService, DiffOptions{
+		Fields: []string{"metadata.name", "metadata.labels", "spec.insecureSkipTLSVerify", "spec.service.name",
+			"spec.service.namespace"},
+		Owned: append([]string{"spec.insecureSkipTLSVerify"}, labelsOwnedFields...),
+	})
+}
 
-	return true
+// Compare the name, labels and pod template of 2 daemon sets.
+// If there are any differences, return false. Otherwise, return true.
+func IsDaemonSetEqual(oldDaemonSet, newDaemonSet *appsv1.DaemonSet) bool {
+	return isEqual("DaemonSets", oldDaemonSet.Name, oldDaemonSet, newDaemonSet, DiffOptions{
+		Fields: []string{"metadata.name", "metadata.labels", "spec.template"},
+		Owned:  append(podTemplateOwnedFields("spec.template"), labelsOwnedFields...),
+	})
 }
 
-// Use DeepEqual to determine if 2 services are equal.
-// Check ObjectMeta, Ports and Selector.
+// Compare the name, labels, annotations, type, ports, selector, load balancer source ranges
+// and external traffic policy of 2 services.
+// The annotations added by other controllers are kept, so only the annotations of the new service are checked.
+// A node port that is not set in the new service is allocated by Kubernetes, so it is only checked
+// when the new service type has no node ports.
 // If there are any differences, return false. Otherwise, return true.
 func IsServiceEqual(oldService, newService *corev1.Service) bool {
-	logger := log.WithValues("func", "IsServiceEqual")
-
-	if !reflect.DeepEqual(oldService.ObjectMeta.Name, newService.ObjectMeta.Name) {
-		logger.Info("Names not equal", "old", oldService.ObjectMeta.Name, "new", newService.ObjectMeta.Name)
+	// the annotations are compared as a subset, an annotation removed from the spec is found by the list of keys
+	if oldService.Annotations[ServiceAnnotationsAnnotation] != newService.Annotations[ServiceAnnotationsAnnotation] {
+		log.WithValues("func", "isEqual", "Kind", "Services", "Name", oldService.Name).Info("Services not equal",
+			"fields", []string{"metadata.annotations." + ServiceAnnotationsAnnotation})
 		return false
 	}
-
-	if !reflect.DeepEqual(oldService.ObjectMeta.Labels, newService.ObjectMeta.Labels) {
-		logger.Info("Labels not equal",
-			"old", fmt.Sprintf("%v", oldService.ObjectMeta.Labels),
-			"new", fmt.Sprintf("%v", newService.ObjectMeta.Labels))
-		return false
-	}
-
-	// Can't check the entire Spec because ClusterIP is immutable
-	if !reflect.DeepEqual(oldService.Spec.Ports, newService.Spec.Ports) {
-		logger.Info("Ports not equal",
-			"old", fmt.Sprintf("%v", oldService.Spec.Ports),
-			"new", fmt.Sprintf("%v", newService.Spec.Ports))
-		return false
-	}
-
-	if !reflect.DeepEqual(oldService.Spec.Selector, newService.Spec.Selector) {
-		logger.Info("Selectors not equal",
-			"old", fmt.Sprintf("%v", oldService.Spec.Selector),
-			"new", fmt.Sprintf("%v", newService.Spec.Selector))
-		return false
+	owned := append([]string{"spec.selector", "spec.selector.*", "spec.loadBalancerSourceRanges"}, labelsOwnedFields...)
+	if !hasNodePorts(newService.Spec.Type) {
+		owned = append(owned, "spec.ports[].nodePort")
 	}
-
-	logger.Info("Services are equal", "Service.Name", oldService.ObjectMeta.Name)
-
-	return true
+	return isEqual("Services", oldService.Name, oldService, newService, DiffOptions{
+		Fields: []string{"metadata.name", "metadata.labels", "metadata.annotations", "spec.type", "spec.ports",
+			"spec.selector", "spec.loadBalancerSourceRanges", "spec.externalTrafficPolicy"},
+		Owned: owned,
+	})
 }
 
-// Use DeepEqual to determine if 2 certificates are equal.
-// Check ObjectMeta and Spec.
+// Compare the name, labels and spec of 2 certificates.
 // If there are any differences, return false. Otherwise, return true.
-func IsCertificateEqual(oldCertificate, newCertificate *certmgr.Certificate) bool {
-	logger := log.WithValues("func", "IsCertificateEqual")
-
-	if !reflect.DeepEqual(oldCertificate.ObjectMeta.Name, newCertificate.ObjectMeta.Name) {
-		logger.Info("Names not equal", "old", oldCertificate.ObjectMeta.Name, "new", newCertificate.ObjectMeta.Name)
-		return false
-	}
+func IsCertificateEqual(oldCertificate, newCertificate *unstructured.Unstructured) bool {
+	return isEqual("Certificates", oldCertificate.GetName(), oldCertificate, newCertificate, DiffOptions{
+		Fields: []string{"metadata.name", "metadata.labels", "spec"},
+		Owned:  append([]string{"spec.*", "spec.issuerRef.*", "spec.privateKey.*"}, labelsOwnedFields...),
+	})
+}
 
-	if !reflect.DeepEqual(oldCertificate.ObjectMeta.Labels, newCertificate.ObjectMeta.Labels) {
-		logger.Info("Labels not equal",
-			"old", fmt.Sprintf("%v", oldCertificate.ObjectMeta.Labels),
-			"new", fmt.Sprintf("%v", newCertificate.ObjectMeta.Labels))
-		return false
-	}
+// Determine if the data of the new config map is in the old config map.
+// The other keys of the old config map are not checked.
+// If there are any differences, return false. Otherwise, return true.
+func IsConfigMapEqual(oldConfigMap, newConfigMap *corev1.ConfigMap) bool {
+	return isEqual("ConfigMaps", oldConfigMap.Name, oldConfigMap, newConfigMap, DiffOptions{
+		Fields: []string{"data"},
+	})
+}
 
-	if !reflect.DeepEqual(oldCertificate.Spec, newCertificate.Spec) {
-		logger.Info("Specs not equal",
-			"old", fmt.Sprintf("%v", oldCertificate.Spec),
-			"new", fmt.Sprintf("%v", newCertificate.Spec))
-		return false
-	}
+// Compare the name, labels and spec of 2 network policies.
+// If there are any differences, return false. Otherwise, return true.
+func IsNetworkPolicyEqual(oldPolicy, newPolicy *networkingv1.NetworkPolicy) bool {
+	return isEqual("NetworkPolicies", oldPolicy.Name, oldPolicy, newPolicy, DiffOptions{
+		Fields: []string{"metadata.name", "metadata.labels", "spec"},
+		Owned: append([]string{"spec.podSelector.matchLabels", "spec.podSelector.matchLabels.*", "spec.ingress", "spec.egress",
+			"spec.policyTypes", "spec.ingress[].from", "spec.ingress[].ports", "spec.egress[].to", "spec.egress[].ports"},
+			labelsOwnedFields...),
+	})
+}
 
-	logger.Info("Certificates are equal", "Certificate.Name", oldCertificate.ObjectMeta.Name)
+// Compare the name, labels and spec of 2 pod disruption budgets.
+// If there are any differences, return false. Otherwise, return true.
+func IsPodDisruptionBudgetEqual(oldPDB, newPDB *unstructured.Unstructured) bool {
+	return isEqual("PodDisruptionBudgets", oldPDB.GetName(), oldPDB, newPDB, DiffOptions{
+		Fields: []string{"metadata.name", "metadata.labels", "spec"},
+		Owned:  append([]string{"spec.minAvailable", "spec.maxUnavailable", "spec.selector.matchLabels.*"}, labelsOwnedFields...),
+	})
+}
 
-	return true
+// Compare the name, labels and spec of 2 routes. The host is only checked when it is set in the new route,
+// because OpenShift generates a host when it is not set.
+// If there are any differences, return false. Otherwise, return true.
+func IsRouteEqual(oldRoute, newRoute *unstructured.Unstructured) bool {
+	return isEqual("Routes", oldRoute.GetName(), oldRoute, newRoute, DiffOptions{
+		Fields: []string{"metadata.name", "metadata.labels", "spec"},
+		Owned:  append([]string{"spec.path", "spec.port", "spec.tls", "spec.tls.*"}, labelsOwnedFields...),
+	})
 }
 
-// Use DeepEqual to determine if 2 ingresses are equal.
-// Check ObjectMeta and Spec.
+// Compare the name, labels, annotations and spec of 2 ingresses.
 // If there are any differences, return false. Otherwise, return true.
 func IsIngressEqual(oldIngress, newIngress *netv1.Ingress) bool {
-	logger := log.WithValues("func", "IsIngressEqual")
-
-	if !reflect.DeepEqual(oldIngress.ObjectMeta.Name, newIngress.ObjectMeta.Name) {
-		logger.Info("Names not equal", "old", oldIngress.ObjectMeta.Name, "new", newIngress.ObjectMeta.Name)
-		return false
-	}
-
-	if !reflect.DeepEqual(oldIngress.ObjectMeta.Labels, newIngress.ObjectMeta.Labels) {
-		logger.Info("Labels not equal",
-			"old", fmt.Sprintf("%v", oldIngress.ObjectMeta.Labels),
-			"new", fmt.Sprintf("%v", newIngress.ObjectMeta.Labels))
-		return false
-	}
-
-	if !reflect.DeepEqual(oldIngress.ObjectMeta.Annotations, newIngress.ObjectMeta.Annotations) {
-		logger.Info("Annotations not equal",
-			"old", fmt.Sprintf("%v", oldIngress.ObjectMeta.Annotations),
-			"new", fmt.Sprintf("%v", newIngress.ObjectMeta.Annotations))
-		return false
-	}
-
-	if !reflect.DeepEqual(oldIngress.Spec, newIngress.Spec) {
-		logger.Info("Specs not equal",
-			"old", fmt.Sprintf("%v", oldIngress.Spec),
-			"new", fmt.Sprintf("%v", newIngress.Spec))
-		return false
-	}
-
-	logger.Info("Ingresses are equal", "Ingress.Name", oldIngress.ObjectMeta.Name)
-
-	return true
+	return isEqual("Ingresses", oldIngress.Name, oldIngress, newIngress, DiffOptions{
+		Fields: []string{"metadata.name", "metadata.labels", "metadata.annotations", "spec"},
+		Owned: append([]string{"metadata.annotations", "metadata.annotations.*", "spec.backend", "spec.tls", "spec.rules",
+			"spec.tls[].hosts", "spec.tls[].secretName", "spec.rules[].host", "spec.rules[].http"}, labelsOwnedFields...),
+	})
 }
@@ -0,0 +1,156 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package resources
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestMergeServiceAnnotations(t *testing.T) {
+	tests := []struct {
+		name    string
+		current map[string]string
+		spec    map[string]string
+		want    map[string]string
+	}{
+		{
+			name: "annotations added",
+			current: map[string]string{
+				"other.example.com/owner": "controller",
+			},
+			spec: map[string]string{"example.com/a": "1", "example.com/b": "2"},
+			want: map[string]string{
+				"other.example.com/owner":    "controller",
+				"example.com/a":              "1",
+				"example.com/b":              "2",
+				ServiceAnnotationsAnnotation: "example.com/a,example.com/b",
+			},
+		},
+		{
+			name: "annotation removed from the spec",
+			current: map[string]string{
+				"other.example.com/owner":    "controller",
+				"example.com/a":              "1",
+				"example.com/b":              "2",
+				ServiceAnnotationsAnnotation: "example.com/a,example.com/b",
+			},
+			spec: map[string]string{"example.com/b": "3"},
+			want: map[string]string{
+				"other.example.com/owner":    "controller",
+				"example.com/b":              "3",
+				ServiceAnnotationsAnnotation: "example.com/b",
+			},
+		},
+		{
+			name: "all annotations removed from the spec",
+			current: map[string]string{
+				"example.com/a":              "1",
+				ServiceAnnotationsAnnotation: "example.com/a",
+			},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desired := AnnotationsForService(tt.spec)
+			if got := mergeServiceAnnotations(tt.current, desired); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeServiceAnnotations() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteIfExists(t *testing.T) {
+	controller := true
+	owner := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "receiver", Namespace: "metering", UID: "receiver-uid"}}
+	ownerReference := func(uid types.UID, isController bool) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{APIVersion: "v1", Kind: "ConfigMap", Name: "receiver", UID: uid, Controller: &isController}}
+	}
+
+	tests := []struct {
+		name            string
+		ownerReferences []metav1.OwnerReference
+		exists          bool
+		owner           metav1.Object
+		wantDeleted     bool
+	}{
+		{
+			name:        "not found",
+			owner:       owner,
+			wantDeleted: true,
+		},
+		{
+			name:            "controlled by the owner",
+			ownerReferences: ownerReference("receiver-uid", controller),
+			exists:          true,
+			owner:           owner,
+			wantDeleted:     true,
+		},
+		{
+			name:            "controlled by another owner",
+			ownerReferences: ownerReference("other-uid", controller),
+			exists:          true,
+			owner:           owner,
+		},
+		{
+			name:            "owned but not controlled by the owner",
+			ownerReferences: ownerReference("receiver-uid", false),
+			exists:          true,
+			owner:           owner,
+		},
+		{
+			name:   "created by a user",
+			exists: true,
+			owner:  owner,
+		},
+		{
+			name:        "checked by the caller",
+			exists:      true,
+			wantDeleted: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewFakeClientWithScheme(clientgoscheme.Scheme)
+			if tt.exists {
+				err := c.Create(context.TODO(), &corev1.Service{
+					ObjectMeta: metav1.ObjectMeta{Name: "metering-receiver", Namespace: "metering", OwnerReferences: tt.ownerReferences},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := DeleteIfExists(c, tt.owner, "metering", "metering-receiver", "Service", &corev1.Service{}); err != nil {
+				t.Fatalf("DeleteIfExists() error = %v", err)
+			}
+			err := c.Get(context.TODO(), types.NamespacedName{Name: "metering-receiver", Namespace: "metering"}, &corev1.Service{})
+			if deleted := errors.IsNotFound(err); deleted != tt.wantDeleted {
+				t.Errorf("deleted = %v (error %v), want %v", deleted, err, tt.wantDeleted)
+			}
+		})
+	}
+}
@@ -17,35 +17,80 @@
 package resources
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 
 	"os"
 
-	operatorv1alpha1 "github.com/ibm/ibm-metering-receiver-operator/pkg/apis/operator/v1alpha1"
+	operatorv1beta1 "github.com/ibm/ibm-metering-receiver-operator/pkg/apis/operator/v1beta1"
 	certmgr "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha1"
 
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
 	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/extensions/v1beta1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
+// CertificateData describes a Certificate.
+// The DNS names are derived from Common when DNSNames is empty, and AdditionalDNSNames are added to them.
+// The fields left empty are not set in the Certificate, so cert-manager uses its defaults.
 type CertificateData struct {
 	Name      string
 	Secret    string
 	Common    string
 	App       string
 	Component string
+	DNSNames  []string
+	// AdditionalDNSNames are added to the DNS names, like external host names
+	AdditionalDNSNames []string
+	IPAddresses        []string
+	// ClusterDomain is the domain of the fully qualified Service name, cluster.local when it is empty
+	ClusterDomain string
+	// IssuerKind is Issuer or ClusterIssuer, ClusterIssuer when it is empty
+	IssuerKind   string
+	Duration     *metav1.Duration
+	RenewBefore  *metav1.Duration
+	KeyAlgorithm string
+	KeySize      int
 }
 
 type IngressData struct {
 	Name        string
+	Host        string
 	Path        string
 	Service     string
 	Port        int32
+	TLSSecret   string
 	Annotations map[string]string
 }
 
+type RouteData struct {
+	Name                     string
+	Host                     string
+	Service                  string
+	ServicePort              string
+	Termination              string
+	DestinationCACertificate string
+}
+
 const CommonServicesProductName = "IBM Cloud Platform Common Services"
 const CommonServicesProductID = "068a62892a1e4db39641342e592daa25"
 const CommonServicesProductVersion = "3.4.0"
@@ -53,17 +98,65 @@ const MeteringComponentName = "meteringsvc"
 const MeteringReleaseName = "metering"
 const ReceiverDeploymentName = "metering-receiver"
 const ReceiverServiceName = "metering-receiver"
+const ReceiverServicePortName = "metering-receiver"
+const ReceiverIngressName = "metering-receiver"
+const ReceiverRouteName = "metering-receiver"
+const LoggingConfigMapName = "metering-logging-configuration"
+
+// LoggingConfigHashAnnotation is the pod annotation with the hash of the receiver logging configuration.
+// The receiver only reads its log levels when it starts, so a new hash rolls the pods.
+const LoggingConfigHashAnnotation = "operator.ibm.com/logging-config-hash"
+
+// ContentHashAnnotation is the pod annotation with the hash of the Secrets and ConfigMaps used by the pods.
+// The receiver only reads its credentials and certificates when it starts, so a new hash rolls the pods.
+const ContentHashAnnotation = "operator.ibm.com/content-hash"
+
+// ServiceAnnotationsAnnotation is the Service annotation with the keys of the annotations set from spec.service.annotations.
+// The keys removed from spec.service.annotations are removed from the Service, the annotations of other controllers are kept.
+const ServiceAnnotationsAnnotation = "operator.ibm.com/service-annotations"
+
+const ReceiverIngressNetworkPolicyName = "metering-receiver-ingress"
+const ReceiverEgressNetworkPolicyName = "metering-receiver-egress"
+
+// PodDisruptionBudgetGroupVersionKinds are the PodDisruptionBudget kinds, the preferred one first.
+// PodDisruptionBudgets are handled as unstructured objects, because policy/v1 is newer than the client.
+var PodDisruptionBudgetGroupVersionKinds = []schema.GroupVersionKind{
+	{Group: "policy", Version: "v1", Kind: "PodDisruptionBudget"},
+	{Group: "policy", Version: "v1beta1", Kind: "PodDisruptionBudget"},
+}
+
+// RouteGroupVersionKind is the OpenShift Route kind.
+// Routes are handled as unstructured objects, because the API only exists on OpenShift.
+var RouteGroupVersionKind = schema.GroupVersionKind{Group: "route.openshift.io", Version: "v1", Kind: "Route"}
+
+// HorizontalPodAutoscalerGroupVersionKind is the HorizontalPodAutoscaler kind created for spec.autoscaling.
+// autoscaling/v2beta2 is not served by clusters older than Kubernetes 1.12.
+var HorizontalPodAutoscalerGroupVersionKind = autoscalingv2beta2.SchemeGroupVersion.WithKind("HorizontalPodAutoscaler")
+
+// LegacyCertificateGroupVersionKind is the Certificate kind of cert-manager releases older than 0.11
+var LegacyCertificateGroupVersionKind = certmgr.SchemeGroupVersion.WithKind("Certificate")
+
+// CertificateGroupVersionKinds are the cert-manager Certificate kinds, the preferred one first.
+// Certificates are handled as unstructured objects, because cert-manager.io/v1 is newer than the client.
+var CertificateGroupVersionKinds = []schema.GroupVersionKind{
+	{Group: "cert-manager.io", Version: "v1", Kind: "Certificate"},
+	LegacyCertificateGroupVersionKind,
+}
+
 const MeteringDependencies = "ibm-common-services.auth-idp, mongodb, cert-manager"
 
-var DefaultStatusForCR = []string{"none"}
 var DefaultMode int32 = 420
 
-var ReceiverCertificateData = CertificateData{
-	Name:      ReceiverCertName,
-	Secret:    ReceiverCertSecretName,
-	Common:    ReceiverCertCommonName,
-	App:       ReceiverDeploymentName,
-	Component: ReceiverCertCommonName,
+// ReceiverCertificateData returns the receiver certificate of the objects with the given names.
+// The certificate is valid for the names of the receiver Service.
+func ReceiverCertificateData(names ResourceNames) CertificateData {
+	return CertificateData{
+		Name:      names.Certificate,
+		Secret:    names.CertSecret,
+		Common:    names.Service,
+		App:       ReceiverDeploymentName,
+		Component: ReceiverCertCommonName,
+	}
 }
 
 var CommonIngressAnnotations = map[string]string{
@@ -71,80 +164,302 @@ var CommonIngressAnnotations = map[string]string{
 	"kubernetes.io/ingress.class":  "ibm-icp-management",
 }
 
+// the receiver only accepts HTTPS, so the Ingress controller has to use HTTPS to reach it
+var ReceiverIngressAnnotations = map[string]string{
+	"icp.management.ibm.com/secure-backends": "true",
+}
+
 var log = logf.Log.WithName("resource_utils")
 
-// BuildCertificate returns a Certificate object.
+// NewCertificate returns an empty Certificate of the given kind
+func NewCertificate(gvk schema.GroupVersionKind) *unstructured.Unstructured {
+	certificate := &unstructured.Unstructured{}
+	certificate.SetGroupVersionKind(gvk)
+	return certificate
+}
+
+// BuildCertificate returns a Certificate object of the given cert-manager kind, issued by the issuer of certData.IssuerKind.
 // Call controllerutil.SetControllerReference to set the owner and controller
 // for the Certificate object created by this function.
-func BuildCertificate(instanceNamespace, instanceClusterIssuer string, certData CertificateData) *certmgr.Certificate {
+func BuildCertificate(gvk schema.GroupVersionKind, instanceNamespace, issuerName string,
+	certData CertificateData) (*unstructured.Unstructured, error) {
 	reqLogger := log.WithValues("func", "BuildCertificate")
 
 	metaLabels := labelsForCertificateMeta(certData.App, certData.Component)
-	var clusterIssuer string
-	if instanceClusterIssuer != "" {
-		reqLogger.Info("clusterIssuer=" + instanceClusterIssuer)
-		clusterIssuer = instanceClusterIssuer
+	issuerKind := certData.IssuerKind
+	if issuerKind == "" {
+		issuerKind = certmgr.ClusterIssuerKind
+	}
+	reqLogger.Info("issuer="+issuerName, "kind", issuerKind)
+
+	dnsNames := CertificateDNSNames(instanceNamespace, certData)
+
+	var spec map[string]interface{}
+	if gvk == LegacyCertificateGroupVersionKind {
+		legacySpec := certmgr.CertificateSpec{
+			CommonName:   certData.Common,
+			SecretName:   certData.Secret,
+			IsCA:         false,
+			DNSNames:     dnsNames,
+			IPAddresses:  certData.IPAddresses,
+			Organization: []string{"IBM"},
+			IssuerRef: certmgr.ObjectReference{
+				Name: issuerName,
+				Kind: issuerKind,
+			},
+			Duration:    certData.Duration,
+			RenewBefore: certData.RenewBefore,
+			KeySize:     certData.KeySize,
+			// the old cert-manager has lowercase key algorithms
+			KeyAlgorithm: certmgr.KeyAlgorithm(strings.ToLower(certData.KeyAlgorithm)),
+		}
+		var err error
+		spec, err = runtime.DefaultUnstructuredConverter.ToUnstructured(&legacySpec)
+		if err != nil {
+			return nil, err
+		}
 	} else {
-		reqLogger.Info("clusterIssuer is blank, default=" + DefaultClusterIssuer)
-		clusterIssuer = DefaultClusterIssuer
+		// cert-manager.io moved the organization to the subject
+		spec = map[string]interface{}{
+			"commonName": certData.Common,
+			"secretName": certData.Secret,
+			"dnsNames":   stringsToInterfaces(dnsNames),
+			"subject": map[string]interface{}{
+				"organizations": []interface{}{"IBM"},
+			},
+			"issuerRef": map[string]interface{}{
+				"name":  issuerName,
+				"kind":  issuerKind,
+				"group": gvk.Group,
+			},
+		}
+		if len(certData.IPAddresses) > 0 {
+			spec["ipAddresses"] = stringsToInterfaces(certData.IPAddresses)
+		}
+		if certData.Duration != nil {
+			spec["duration"] = certData.Duration.Duration.String()
+		}
+		if certData.RenewBefore != nil {
+			spec["renewBefore"] = certData.RenewBefore.Duration.String()
+		}
+		if certData.KeyAlgorithm != "" || certData.KeySize != 0 {
+			privateKey := map[string]interface{}{}
+			if certData.KeyAlgorithm != "" {
+				privateKey["algorithm"] = certData.KeyAlgorithm
+			}
+			if certData.KeySize != 0 {
+				privateKey["size"] = int64(certData.KeySize)
+			}
+			spec["privateKey"] = privateKey
+		}
+	}
+
+	certificate := NewCertificate(gvk)
+	certificate.SetName(certData.Name)
+	certificate.SetNamespace(instanceNamespace)
+	certificate.SetLabels(metaLabels)
+	certificate.Object["spec"] = spec
+	return certificate, nil
+}
+
+// CertificateDNSNames returns the DNS names of the certificate.
+// They are derived from the common name, the namespace and the cluster domain when certData.DNSNames is empty.
+// The additional DNS names that are not already in the list are added at the end.
+func CertificateDNSNames(instanceNamespace string, certData CertificateData) []string {
+	dnsNames := certData.DNSNames
+	if len(dnsNames) == 0 {
+		clusterDomain := certData.ClusterDomain
+		if clusterDomain == "" {
+			clusterDomain = "cluster.local"
+		}
+		dnsNames = []string{
+			certData.Common,
+			certData.Common + "." + instanceNamespace,
+			certData.Common + "." + instanceNamespace + ".svc",
+			certData.Common + "." + instanceNamespace + ".svc." + clusterDomain,
+		}
+	}
+	if len(certData.AdditionalDNSNames) == 0 {
+		return dnsNames
+	}
+
+	names := append([]string{}, dnsNames...)
+	for _, name := range certData.AdditionalDNSNames {
+		if !containsString(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// containsString returns true if value is in values
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// stringsToInterfaces converts a string slice for an unstructured object
+func stringsToInterfaces(values []string) []interface{} {
+	result := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		result = append(result, value)
 	}
+	return result
+}
 
-	certificate := &certmgr.Certificate{
+// BuildIngress returns an Ingress object that routes the path to the port of the service.
+// Call controllerutil.SetControllerReference to set the owner and controller
+// for the Ingress object created by this function.
+func BuildIngress(instanceNamespace string, ingressData IngressData) *netv1.Ingress {
+	ingress := &netv1.Ingress{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      certData.Name,
-			Labels:    metaLabels,
-			Namespace: instanceNamespace,
+			Name:        ingressData.Name,
+			Namespace:   instanceNamespace,
+			Labels:      LabelsForMetadata(ingressData.Service),
+			Annotations: ingressData.Annotations,
 		},
-		Spec: certmgr.CertificateSpec{
-			CommonName: certData.Common,
-			SecretName: certData.Secret,
-			IsCA:       false,
-			DNSNames: []string{
-				certData.Common,
-				certData.Common + "." + instanceNamespace,
-				certData.Common + "." + instanceNamespace + ".svc.cluster.local",
-			},
-			Organization: []string{"IBM"},
-			IssuerRef: certmgr.ObjectReference{
-				Name: clusterIssuer,
-				Kind: certmgr.ClusterIssuerKind,
+		Spec: netv1.IngressSpec{
+			Rules: []netv1.IngressRule{
+				{
+					Host: ingressData.Host,
+					IngressRuleValue: netv1.IngressRuleValue{
+						HTTP: &netv1.HTTPIngressRuleValue{
+							Paths: []netv1.HTTPIngressPath{
+								{
+									Path: ingressData.Path,
+									Backend: netv1.IngressBackend{
+										ServiceName: ingressData.Service,
+										ServicePort: intstr.FromInt(int(ingressData.Port)),
+									},
+								},
+							},
+						},
+					},
+				},
 			},
 		},
 	}
-	return certificate
+	if ingressData.TLSSecret != "" {
+		ingressTLS := netv1.IngressTLS{SecretName: ingressData.TLSSecret}
+		if ingressData.Host != "" {
+			ingressTLS.Hosts = []string{ingressData.Host}
+		}
+		ingress.Spec.TLS = []netv1.IngressTLS{ingressTLS}
+	}
+	return ingress
+}
+
+// NewPodDisruptionBudget returns an empty PodDisruptionBudget object of the kind gvk, to be used with the client
+func NewPodDisruptionBudget(gvk schema.GroupVersionKind) *unstructured.Unstructured {
+	pdb := &unstructured.Unstructured{}
+	pdb.SetGroupVersionKind(gvk)
+	return pdb
+}
+
+// BuildPodDisruptionBudget returns a PodDisruptionBudget object of the kind gvk for the pods matching selectorLabels.
+// The spec has the same fields in policy/v1 and policy/v1beta1.
+// Call controllerutil.SetControllerReference to set the owner and controller
+// for the PodDisruptionBudget object created by this function.
+func BuildPodDisruptionBudget(gvk schema.GroupVersionKind, instanceNamespace, name string, selectorLabels map[string]string,
+	minAvailable, maxUnavailable *intstr.IntOrString) (*unstructured.Unstructured, error) {
+	spec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&policyv1beta1.PodDisruptionBudgetSpec{
+		MinAvailable:   minAvailable,
+		MaxUnavailable: maxUnavailable,
+		Selector:       &metav1.LabelSelector{MatchLabels: selectorLabels},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pdb := NewPodDisruptionBudget(gvk)
+	pdb.SetName(name)
+	pdb.SetNamespace(instanceNamespace)
+	pdb.SetLabels(LabelsForMetadata(name))
+	pdb.Object["spec"] = spec
+	return pdb, nil
+}
+
+// NewRoute returns an empty Route object, to be used with the client
+func NewRoute() *unstructured.Unstructured {
+	route := &unstructured.Unstructured{}
+	route.SetGroupVersionKind(RouteGroupVersionKind)
+	return route
+}
+
+// BuildRoute returns a Route object that sends the TLS connections for the host to the port of the service.
+// Fields that OpenShift defaults are set, so the Route does not differ from the one read back.
+// Call controllerutil.SetControllerReference to set the owner and controller
+// for the Route object created by this function.
+func BuildRoute(instanceNamespace string, routeData RouteData) *unstructured.Unstructured {
+	tls := map[string]interface{}{
+		"termination":                   routeData.Termination,
+		"insecureEdgeTerminationPolicy": "None",
+	}
+	if routeData.DestinationCACertificate != "" {
+		tls["destinationCACertificate"] = routeData.DestinationCACertificate
+	}
+	spec := map[string]interface{}{
+		"to": map[string]interface{}{
+			"kind":   "Service",
+			"name":   routeData.Service,
+			"weight": int64(100),
+		},
+		"port": map[string]interface{}{
+			"targetPort": routeData.ServicePort,
+		},
+		"tls":            tls,
+		"wildcardPolicy": "None",
+	}
+	if routeData.Host != "" {
+		spec["host"] = routeData.Host
+	}
+
+	route := NewRoute()
+	route.SetName(routeData.Name)
+	route.SetNamespace(instanceNamespace)
+	route.SetLabels(LabelsForMetadata(routeData.Service))
+	route.Object["spec"] = spec
+	return route
 }
 
 // checkerCommand is the command to be executed by the secret-check container.
-// mongoDB contains the password names from the CR.
+// mongoDB contains the secret names from the CR. The certificate secrets are only checked
+// when the connection to MongoDB uses TLS.
 // additionalInfo contains info about additional secrets to check.
+// resourceOverrides are merged over the default init container resources.
 func BuildSecretCheckContainer(deploymentName, imageName, checkerCommand string,
-	mongoDB operatorv1alpha1.MeteringReceiverSpecMongoDB, additionalInfo *SecretCheckData) corev1.Container {
+	mongoDB operatorv1beta1.MongoDBSpec, additionalInfo *SecretCheckData, resourceOverrides corev1.ResourceRequirements) corev1.Container {
 
 	containerName := deploymentName + "-secret-check"
-	nameList := mongoDB.UsernameSecret + " " + mongoDB.PasswordSecret + " " +
-		mongoDB.ClusterCertsSecret + " " + mongoDB.ClientCertsSecret
-	usernameSecretDir := "muser-" + mongoDB.UsernameSecret
-	passwordSecretDir := "mpass-" + mongoDB.PasswordSecret
-	dirList := usernameSecretDir + " " + passwordSecretDir + " " +
-		mongoDB.ClusterCertsSecret + " " + mongoDB.ClientCertsSecret
-	volumeMounts := []corev1.VolumeMount{
-		{
-			Name:      "mongodb-ca-cert",
-			MountPath: "/sec/" + mongoDB.ClusterCertsSecret,
-		},
-		{
-			Name:      "mongodb-client-cert",
-			MountPath: "/sec/" + mongoDB.ClientCertsSecret,
-		},
-		{
-			Name:      usernameSecretDir,
-			MountPath: "/sec/" + usernameSecretDir,
-		},
-		{
-			Name:      passwordSecretDir,
-			MountPath: "/sec/" + passwordSecretDir,
-		},
+	var names, dirs []string
+	volumeMounts := []corev1.VolumeMount{}
+	addSecret := func(secretName, secretDir, volumeName string) {
+		names = append(names, secretName)
+		dirs = append(dirs, secretDir)
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      volumeName,
+			MountPath: "/sec/" + secretDir,
+		})
+	}
+	if mongoDB.URISecretRef != nil {
+		addSecret(mongoDB.URISecretRef.Name, "muri-"+mongoDB.URISecretRef.Name, MongoDBURIVolumeName)
 	}
+	if mongoDB.Credentials.IsSet() {
+		usernameSecret := mongoDB.Credentials.UsernameSecretName()
+		passwordSecret := mongoDB.Credentials.PasswordSecretName()
+		addSecret(usernameSecret, "muser-"+usernameSecret, MongoDBUsernameVolumeName)
+		addSecret(passwordSecret, "mpass-"+passwordSecret, MongoDBPasswordVolumeName)
+	}
+	if mongoDB.TLS.IsEnabled() {
+		addSecret(mongoDB.TLS.CASecretRef.Name, mongoDB.TLS.CASecretRef.Name, MongoDBCACertVolumeName)
+		addSecret(mongoDB.TLS.ClientCertSecretRef.Name, mongoDB.TLS.ClientCertSecretRef.Name, MongoDBClientCertVolumeName)
+	}
+	nameList := strings.Join(names, " ")
+	dirList := strings.Join(dirs, " ")
 	if additionalInfo != nil {
 		nameList += " "
 		nameList += additionalInfo.Names
@@ -173,67 +488,188 @@ func BuildSecretCheckContainer(deploymentName, imageName, checkerCommand string,
 			},
 		},
 		VolumeMounts:    volumeMounts,
-		Resources:       commonInitResources,
+		Resources:       MergeResources(commonInitResources, resourceOverrides),
 		SecurityContext: &commonSecurityContext,
 	}
 	return secretCheckContainer
 }
 
-func BuildMongoDBEnvVars(mongoDB operatorv1alpha1.MeteringReceiverSpecMongoDB) []corev1.EnvVar {
-	mongoDBEnvVars := []corev1.EnvVar{
-		{
-			Name:  "HC_MONGO_HOST",
-			Value: mongoDB.Host,
+// loggingConfiguration is the format of the log level file read by the receiver
+type loggingConfiguration struct {
+	Level   operatorv1beta1.LogLevel            `json:"level"`
+	Modules map[string]operatorv1beta1.LogLevel `json:"modules,omitempty"`
+}
+
+// BuildLoggingConfigMap returns the logging ConfigMap with the log level file of the deployment,
+// and the hash of the file. The key of the file is <deploymentName>-<loglevelType>.json, like in BuildCommonVolumes.
+// Call controllerutil.SetControllerReference to set the owner and controller
+// for the ConfigMap object created by this function.
+func BuildLoggingConfigMap(instanceNamespace, configMapName, deploymentName, loglevelType string,
+	logging operatorv1beta1.LoggingSpec) (*corev1.ConfigMap, string, error) {
+	loglevelFile, err := json.Marshal(loggingConfiguration{Level: logging.Level, Modules: logging.Modules})
+	if err != nil {
+		return nil, "", err
+	}
+	hash := sha256.Sum256(loglevelFile)
+
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      configMapName,
+			Namespace: instanceNamespace,
+			Labels:    LabelsForMetadata(deploymentName),
 		},
-		{
-			Name:  "HC_MONGO_PORT",
-			Value: strconv.Itoa(mongoDB.Port),
+		Data: map[string]string{
+			deploymentName + "-" + loglevelType + ".json": string(loglevelFile),
 		},
-		{
-			Name: "HC_MONGO_USER",
+	}
+	return configMap, hex.EncodeToString(hash[:]), nil
+}
+
+// BuildComponentEnvVars returns the env vars that enable or disable the data manager components
+// and hold their settings
+func BuildComponentEnvVars(components operatorv1beta1.ComponentsSpec) []corev1.EnvVar {
+	toggles := []struct {
+		name    string
+		enabled bool
+	}{
+		{"HC_DM_MCM_RECEIVER_ENABLED", components.Receiver.IsEnabled(true)},
+		{"HC_DM_MCM_SENDER_ENABLED", components.Sender.IsEnabled(false)},
+		{"HC_DM_STORAGEREADER_ENABLED", components.StorageReader.IsEnabled(false)},
+		{"HC_DM_REPORTER2_ENABLED", components.Reporter.IsEnabled(false)},
+		{"HC_DM_PURGER2_ENABLED", components.Purger.IsEnabled(false)},
+		{"HC_DM_PREAGGREGATOR_ENABLED", components.Preaggregator.IsEnabled(false)},
+		{"HC_DM_METRICS_ENABLED", components.Metrics.IsEnabled(false)},
+		{"HC_DM_SELFMETER_PURGER_ENABLED", components.SelfmeterPurger.IsEnabled(false)},
+		{"METERING_API_ENABLED", components.API.IsEnabled(false)},
+	}
+
+	envVars := make([]corev1.EnvVar, 0, len(toggles)+1)
+	for _, toggle := range toggles {
+		envVars = append(envVars, corev1.EnvVar{Name: toggle.name, Value: strconv.FormatBool(toggle.enabled)})
+	}
+	if components.Purger.IsEnabled(false) && components.Purger.RetentionDays != nil {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "HC_DM_PURGER2_RETENTION_DAYS",
+			Value: strconv.Itoa(int(*components.Purger.RetentionDays)),
+		})
+	}
+	return envVars
+}
+
+// BuildMongoDBEnvVars returns the env vars of the MongoDB connection.
+// The connection is set with HC_MONGO_URI when the CR has a URI secret, and with the hosts and options otherwise.
+func BuildMongoDBEnvVars(mongoDB operatorv1beta1.MongoDBSpec) []corev1.EnvVar {
+	mongoDBEnvVars := []corev1.EnvVar{}
+	if mongoDB.URISecretRef != nil {
+		mongoDBEnvVars = append(mongoDBEnvVars, corev1.EnvVar{
+			Name: "HC_MONGO_URI",
 			ValueFrom: &corev1.EnvVarSource{
 				SecretKeyRef: &corev1.SecretKeySelector{
-					LocalObjectReference: corev1.LocalObjectReference{
-						Name: mongoDB.UsernameSecret,
+					LocalObjectReference: mongoDB.URISecretRef.LocalObjectReference,
+					Key:                  mongoDB.URISecretRef.Key,
+					Optional:             &TrueVar,
+				},
+			},
+		})
+	} else {
+		// HC_MONGO_HOST and HC_MONGO_PORT are the first member of a replica set
+		endpoints := mongoDB.Endpoints()
+		mongoDBEnvVars = append(mongoDBEnvVars,
+			corev1.EnvVar{
+				Name:  "HC_MONGO_HOST",
+				Value: endpoints[0].Host,
+			},
+			corev1.EnvVar{
+				Name:  "HC_MONGO_PORT",
+				Value: strconv.Itoa(int(endpoints[0].Port)),
+			},
+		)
+		if len(mongoDB.Hosts) > 0 {
+			hosts := make([]string, 0, len(endpoints))
+			for _, endpoint := range endpoints {
+				hosts = append(hosts, net.JoinHostPort(endpoint.Host, strconv.Itoa(int(endpoint.Port))))
+			}
+			mongoDBEnvVars = append(mongoDBEnvVars, corev1.EnvVar{
+				Name:  "HC_MONGO_HOSTS",
+				Value: strings.Join(hosts, ","),
+			})
+		}
+		for _, option := range []corev1.EnvVar{
+			{Name: "HC_MONGO_REPLICA_SET", Value: mongoDB.ReplicaSet},
+			{Name: "HC_MONGO_AUTH_SOURCE", Value: mongoDB.AuthSource},
+			{Name: "HC_MONGO_READ_PREFERENCE", Value: string(mongoDB.ReadPreference)},
+		} {
+			if option.Value != "" {
+				mongoDBEnvVars = append(mongoDBEnvVars, option)
+			}
+		}
+	}
+
+	if mongoDB.Credentials.IsSet() {
+		mongoDBEnvVars = append(mongoDBEnvVars,
+			corev1.EnvVar{
+				Name: "HC_MONGO_USER",
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: mongoDB.Credentials.UsernameSecretName(),
+						},
+						Key:      mongoDB.Credentials.UsernameKey,
+						Optional: &TrueVar,
 					},
-					Key:      mongoDB.UsernameKey,
-					Optional: &TrueVar,
 				},
 			},
-		},
-		{
-			Name: "HC_MONGO_PASS",
-			ValueFrom: &corev1.EnvVarSource{
-				SecretKeyRef: &corev1.SecretKeySelector{
-					LocalObjectReference: corev1.LocalObjectReference{
-						Name: mongoDB.PasswordSecret,
+			corev1.EnvVar{
+				Name: "HC_MONGO_PASS",
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: mongoDB.Credentials.PasswordSecretName(),
+						},
+						Key:      mongoDB.Credentials.PasswordKey,
+						Optional: &TrueVar,
 					},
-					Key:      mongoDB.PasswordKey,
-					Optional: &TrueVar,
 				},
 			},
-		},
-		{
-			Name:  "HC_MONGO_ISSSL",
-			Value: "true",
-		},
-		{
-			Name:  "HC_MONGO_SSL_CA",
-			Value: "/certs/mongodb-ca/tls.crt",
-		},
-		{
-			Name:  "HC_MONGO_SSL_CERT",
-			Value: "/certs/mongodb-client/tls.crt",
-		},
-		{
-			Name:  "HC_MONGO_SSL_KEY",
-			Value: "/certs/mongodb-client/tls.key",
-		},
+		)
+	}
+
+	mongoDBEnvVars = append(mongoDBEnvVars, corev1.EnvVar{
+		Name:  "HC_MONGO_ISSSL",
+		Value: strconv.FormatBool(mongoDB.TLS.IsEnabled()),
+	})
+	if mongoDB.TLS.IsEnabled() {
+		mongoDBEnvVars = append(mongoDBEnvVars,
+			corev1.EnvVar{
+				Name:  "HC_MONGO_SSL_CA",
+				Value: "/certs/mongodb-ca/tls.crt",
+			},
+			corev1.EnvVar{
+				Name:  "HC_MONGO_SSL_CERT",
+				Value: "/certs/mongodb-client/tls.crt",
+			},
+			corev1.EnvVar{
+				Name:  "HC_MONGO_SSL_KEY",
+				Value: "/certs/mongodb-client/tls.key",
+			},
+		)
 	}
 	return mongoDBEnvVars
 }
 
-func BuildInitContainer(deploymentName, imageName string, envVars []corev1.EnvVar) corev1.Container {
+// BuildMongoDBVolumeMounts returns the mounts of the MongoDB certificates,
+// or nil when the connection to MongoDB does not use TLS.
+func BuildMongoDBVolumeMounts(mongoDB operatorv1beta1.MongoDBSpec) []corev1.VolumeMount {
+	if !mongoDB.TLS.IsEnabled() {
+		return nil
+	}
+	return append([]corev1.VolumeMount{}, mongoDBCertVolumeMounts...)
+}
+
+// mongoDB selects the MongoDB certificate mounts.
+// resourceOverrides are merged over the default init container resources.
+func BuildInitContainer(deploymentName, imageName string, envVars []corev1.EnvVar,
+	mongoDB operatorv1beta1.MongoDBSpec, resourceOverrides corev1.ResourceRequirements) corev1.Container {
 	containerName := deploymentName + "-init"
 	var initContainer = corev1.Container{
 		Image:           imageName,
@@ -246,77 +682,64 @@ func BuildInitContainer(deploymentName, imageName string, envVars []corev1.EnvVa
 		},
 		// CommonEnvVars and mongoDBEnvVars will be added by the controller
 		Env:             envVars,
-		VolumeMounts:    commonInitVolumeMounts,
-		Resources:       commonInitResources,
+		VolumeMounts:    BuildMongoDBVolumeMounts(mongoDB),
+		Resources:       MergeResources(commonInitResources, resourceOverrides),
 		SecurityContext: &commonSecurityContext,
 	}
 	return initContainer
 }
 
-func BuildCommonVolumes(mongoDB operatorv1alpha1.MeteringReceiverSpecMongoDB, loglevelPrefix, loglevelType string) []corev1.Volume {
+// BuildCommonVolumes returns the volumes of the MongoDB secrets used by the CR and the log level volume
+// of the logging ConfigMap.
+func BuildCommonVolumes(mongoDB operatorv1beta1.MongoDBSpec, loggingConfigMapName, loglevelPrefix, loglevelType string) []corev1.Volume {
 	loglevelKey := loglevelPrefix + "-" + loglevelType + ".json"
 	loglevelPath := loglevelType + ".json"
 
-	commonVolumes := []corev1.Volume{
-		{
-			Name: "mongodb-ca-cert",
+	secretVolume := func(volumeName, secretName string) corev1.Volume {
+		return corev1.Volume{
+			Name: volumeName,
 			VolumeSource: corev1.VolumeSource{
 				Secret: &corev1.SecretVolumeSource{
-					SecretName:  mongoDB.ClusterCertsSecret,
+					SecretName:  secretName,
 					DefaultMode: &DefaultMode,
 					Optional:    &TrueVar,
 				},
 			},
-		},
-		{
-			Name: "mongodb-client-cert",
-			VolumeSource: corev1.VolumeSource{
-				Secret: &corev1.SecretVolumeSource{
-					SecretName:  mongoDB.ClientCertsSecret,
-					DefaultMode: &DefaultMode,
-					Optional:    &TrueVar,
-				},
-			},
-		},
-		{
-			Name: "muser-icp-mongodb-admin",
-			VolumeSource: corev1.VolumeSource{
-				Secret: &corev1.SecretVolumeSource{
-					SecretName:  mongoDB.UsernameSecret,
-					DefaultMode: &DefaultMode,
-					Optional:    &TrueVar,
-				},
-			},
-		},
-		{
-			Name: "mpass-icp-mongodb-admin",
-			VolumeSource: corev1.VolumeSource{
-				Secret: &corev1.SecretVolumeSource{
-					SecretName:  mongoDB.PasswordSecret,
-					DefaultMode: &DefaultMode,
-					Optional:    &TrueVar,
+		}
+	}
+
+	commonVolumes := []corev1.Volume{}
+	if mongoDB.TLS.IsEnabled() {
+		commonVolumes = append(commonVolumes,
+			secretVolume(MongoDBCACertVolumeName, mongoDB.TLS.CASecretRef.Name),
+			secretVolume(MongoDBClientCertVolumeName, mongoDB.TLS.ClientCertSecretRef.Name))
+	}
+	if mongoDB.Credentials.IsSet() {
+		commonVolumes = append(commonVolumes,
+			secretVolume(MongoDBUsernameVolumeName, mongoDB.Credentials.UsernameSecretName()),
+			secretVolume(MongoDBPasswordVolumeName, mongoDB.Credentials.PasswordSecretName()))
+	}
+	if mongoDB.URISecretRef != nil {
+		commonVolumes = append(commonVolumes, secretVolume(MongoDBURIVolumeName, mongoDB.URISecretRef.Name))
+	}
+	commonVolumes = append(commonVolumes, corev1.Volume{
+		Name: loglevelType,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: loggingConfigMapName,
 				},
-			},
-		},
-		{
-			Name: loglevelType,
-			VolumeSource: corev1.VolumeSource{
-				ConfigMap: &corev1.ConfigMapVolumeSource{
-					LocalObjectReference: corev1.LocalObjectReference{
-						Name: "metering-logging-configuration",
-					},
-					Items: []corev1.KeyToPath{
-						{
-							Key:  loglevelKey,
-							Path: loglevelPath,
-						},
+				Items: []corev1.KeyToPath{
+					{
+						Key:  loglevelKey,
+						Path: loglevelPath,
 					},
-					DefaultMode: &DefaultMode,
-					Optional:    &TrueVar,
 				},
+				DefaultMode: &DefaultMode,
+				Optional:    &TrueVar,
 			},
 		},
-	}
+	})
 	return commonVolumes
 }
 
@@ -345,23 +768,29 @@ func labelsForCertificateMeta(appName, componentName string) map[string]string {
 	return map[string]string{"app": appName, "component": componentName, "release": MeteringReleaseName}
 }
 
+// AnnotationsForService returns the annotations of spec.service.annotations,
+// with their keys in ServiceAnnotationsAnnotation so that they can be removed when they are no longer set
+func AnnotationsForService(specAnnotations map[string]string) map[string]string {
+	if len(specAnnotations) == 0 {
+		return nil
+	}
+	annotations := make(map[string]string, len(specAnnotations)+1)
+	keys := make([]string, 0, len(specAnnotations))
+	for key, value := range specAnnotations {
+		annotations[key] = value
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	annotations[ServiceAnnotationsAnnotation] = strings.Join(keys, ",")
+	return annotations
+}
+
 //AnnotationsForPod returns the annotations associated with the pod being created
 func AnnotationsForPod() map[string]string {
 	return map[string]string{"productName": CommonServicesProductName, "productID": CommonServicesProductID,
 		"productVersion": CommonServicesProductVersion, "productMetric": "FREE", "clusterhealth.ibm.com/dependencies": MeteringDependencies}
 }
 
-// GetPodNames returns the pod names of the array of pods passed in
-func GetPodNames(pods []corev1.Pod) []string {
-	reqLogger := log.WithValues("func", "GetPodNames")
-	var podNames []string
-	for _, pod := range pods {
-		podNames = append(podNames, pod.Name)
-		reqLogger.Info("pod name=" + pod.Name)
-	}
-	return podNames
-}
-
 // GetServiceAccountName returns the service account name or default if it is not set in the environment
 func GetServiceAccountName() string {
 
@@ -375,19 +804,14 @@ func GetServiceAccountName() string {
 }
 
 // GetImageID returns the ID of an operand image, either <imageName>@<SHA> or <imageName>:<tag>
-func GetImageID(instanceImageRegistry, instanceImageTagPostfix, defaultImageRegistry,
+func GetImageID(instanceImageRegistry, instanceImageTagPostfix,
 	imageName, envVarName, defaultImageTag string) string {
 	reqLogger := log.WithValues("func", "GetImageID")
 
-	// determine if the image registry has been overridden by the CR
-	var imageRegistry, imageID string
-	if instanceImageRegistry == "" {
-		imageRegistry = defaultImageRegistry
-		reqLogger.Info("use default imageRegistry=" + imageRegistry)
-	} else {
-		imageRegistry = instanceImageRegistry
-		reqLogger.Info("use instance imageRegistry=" + imageRegistry)
-	}
+	// the image registry has been defaulted in the CR
+	var imageID string
+	imageRegistry := instanceImageRegistry
+	reqLogger.Info("use instance imageRegistry=" + imageRegistry)
 
 	// determine if an image SHA or tag has been set in an env var.
 	// if not, use the default tag (mainly used during development).
@@ -410,3 +834,283 @@ func GetImageID(instanceImageRegistry, instanceImageTagPostfix, defaultImageRegi
 
 	return imageID
 }
+
+// BuildResourceMetric returns a HorizontalPodAutoscaler metric that targets
+// the average utilization of a resource, as a percentage of the requested amount.
+func BuildResourceMetric(name corev1.ResourceName, targetPercentage int32) autoscalingv2beta2.MetricSpec {
+	return autoscalingv2beta2.MetricSpec{
+		Type: autoscalingv2beta2.ResourceMetricSourceType,
+		Resource: &autoscalingv2beta2.ResourceMetricSource{
+			Name: name,
+			Target: autoscalingv2beta2.MetricTarget{
+				Type:               autoscalingv2beta2.UtilizationMetricType,
+				AverageUtilization: &targetPercentage,
+			},
+		},
+	}
+}
+
+// MergeResources returns the default resources with the limits and requests
+// that are set in overrides replacing the default values.
+func MergeResources(defaults, overrides corev1.ResourceRequirements) corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{
+		Limits:   mergeResourceList(defaults.Limits, overrides.Limits),
+		Requests: mergeResourceList(defaults.Requests, overrides.Requests),
+	}
+}
+
+func mergeResourceList(defaults, overrides corev1.ResourceList) corev1.ResourceList {
+	if len(defaults) == 0 && len(overrides) == 0 {
+		return nil
+	}
+	merged := corev1.ResourceList{}
+	for name, quantity := range defaults {
+		merged[name] = quantity.DeepCopy()
+	}
+	for name, quantity := range overrides {
+		merged[name] = quantity.DeepCopy()
+	}
+	return merged
+}
+
+// BuildAffinity returns the affinity of an operand pod.
+// By default the pod is scheduled on nodes of a supported architecture.
+// The node affinity in overrides replaces the default node affinity,
+// the pod affinity and pod anti-affinity in overrides are added to it.
+func BuildAffinity(overrides *corev1.Affinity) *corev1.Affinity {
+	affinity := &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{
+					{
+						MatchExpressions: []corev1.NodeSelectorRequirement{
+							{
+								Key:      "beta.kubernetes.io/arch",
+								Operator: corev1.NodeSelectorOpIn,
+								Values:   ArchitectureList,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if overrides == nil {
+		return affinity
+	}
+	if overrides.NodeAffinity != nil {
+		affinity.NodeAffinity = overrides.NodeAffinity.DeepCopy()
+	}
+	affinity.PodAffinity = overrides.PodAffinity.DeepCopy()
+	affinity.PodAntiAffinity = overrides.PodAntiAffinity.DeepCopy()
+	return affinity
+}
+
+// BuildTolerations returns the default tolerations of an operand pod
+// followed by the additional tolerations that are not already in the defaults.
+func BuildTolerations(additional []corev1.Toleration) []corev1.Toleration {
+	tolerations := make([]corev1.Toleration, 0, len(DefaultTolerations)+len(additional))
+	tolerations = append(tolerations, DefaultTolerations...)
+	for _, toleration := range additional {
+		duplicate := false
+		for i := range tolerations {
+			if reflect.DeepEqual(tolerations[i], toleration) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			tolerations = append(tolerations, toleration)
+		}
+	}
+	return tolerations
+}
+
+// PodSpecReference is a Secret or ConfigMap used by a pod spec.
+// Keys are the keys used by the pod, or nil when the pod uses all the keys.
+type PodSpecReference struct {
+	Kind string
+	Name string
+	Keys []string
+}
+
+// PodSpecReferences returns the Secrets and ConfigMaps used by the volumes and the env vars of the containers
+// of podSpec, sorted by kind and name.
+func PodSpecReferences(podSpec corev1.PodSpec) []PodSpecReference {
+	type objectKey struct{ kind, name string }
+	refs := map[objectKey]map[string]bool{}
+	add := func(kind, name string, keys ...string) {
+		ref := objectKey{kind: kind, name: name}
+		usedKeys, found := refs[ref]
+		switch {
+		case found && usedKeys == nil:
+			// all the keys are already used
+		case len(keys) == 0:
+			refs[ref] = nil
+		default:
+			if usedKeys == nil {
+				usedKeys = map[string]bool{}
+				refs[ref] = usedKeys
+			}
+			for _, key := range keys {
+				usedKeys[key] = true
+			}
+		}
+	}
+	itemKeys := func(items []corev1.KeyToPath) []string {
+		keys := make([]string, 0, len(items))
+		for _, item := range items {
+			keys = append(keys, item.Key)
+		}
+		return keys
+	}
+
+	for _, volume := range podSpec.Volumes {
+		switch {
+		case volume.Secret != nil:
+			add("Secret", volume.Secret.SecretName, itemKeys(volume.Secret.Items)...)
+		case volume.ConfigMap != nil:
+			add("ConfigMap", volume.ConfigMap.Name, itemKeys(volume.ConfigMap.Items)...)
+		case volume.Projected != nil:
+			for _, source := range volume.Projected.Sources {
+				if source.Secret != nil {
+					add("Secret", source.Secret.Name, itemKeys(source.Secret.Items)...)
+				}
+				if source.ConfigMap != nil {
+					add("ConfigMap", source.ConfigMap.Name, itemKeys(source.ConfigMap.Items)...)
+				}
+			}
+		}
+	}
+
+	containers := append(append([]corev1.Container{}, podSpec.InitContainers...), podSpec.Containers...)
+	for _, container := range containers {
+		for _, env := range container.Env {
+			if env.ValueFrom == nil {
+				continue
+			}
+			if ref := env.ValueFrom.SecretKeyRef; ref != nil {
+				add("Secret", ref.Name, ref.Key)
+			}
+			if ref := env.ValueFrom.ConfigMapKeyRef; ref != nil {
+				add("ConfigMap", ref.Name, ref.Key)
+			}
+		}
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.SecretRef != nil {
+				add("Secret", envFrom.SecretRef.Name)
+			}
+			if envFrom.ConfigMapRef != nil {
+				add("ConfigMap", envFrom.ConfigMapRef.Name)
+			}
+		}
+	}
+
+	references := make([]PodSpecReference, 0, len(refs))
+	for object, usedKeys := range refs {
+		ref := PodSpecReference{Kind: object.kind, Name: object.name}
+		if usedKeys != nil {
+			for key := range usedKeys {
+				ref.Keys = append(ref.Keys, key)
+			}
+			sort.Strings(ref.Keys)
+		}
+		references = append(references, ref)
+	}
+	sort.Slice(references, func(i, j int) bool {
+		if references[i].Kind != references[j].Kind {
+			return references[i].Kind < references[j].Kind
+		}
+		return references[i].Name < references[j].Name
+	})
+	return references
+}
+
+// HashPodSpecReferences returns the sha256 hex of the content of the referenced Secrets and ConfigMaps.
+// Only the keys used by the pod are hashed. Objects and keys that do not exist are hashed as missing,
+// so the hash changes when they are created.
+func HashPodSpecReferences(client client.Client, instanceNamespace string, references []PodSpecReference) (string, error) {
+	hash := sha256.New()
+	for _, ref := range references {
+		var data map[string][]byte
+		var err error
+		switch ref.Kind {
+		case "Secret":
+			secret := &corev1.Secret{}
+			err = client.Get(context.TODO(), types.NamespacedName{Name: ref.Name, Namespace: instanceNamespace}, secret)
+			data = secret.Data
+		case "ConfigMap":
+			configMap := &corev1.ConfigMap{}
+			err = client.Get(context.TODO(), types.NamespacedName{Name: ref.Name, Namespace: instanceNamespace}, configMap)
+			data = make(map[string][]byte, len(configMap.Data)+len(configMap.BinaryData))
+			for key, value := range configMap.Data {
+				data[key] = []byte(value)
+			}
+			for key, value := range configMap.BinaryData {
+				data[key] = value
+			}
+		default:
+			return "", fmt.Errorf("unsupported pod spec reference kind %s", ref.Kind)
+		}
+		if err != nil && !errors.IsNotFound(err) {
+			return "", err
+		}
+
+		fmt.Fprintf(hash, "%s/%s\x00", ref.Kind, ref.Name)
+		if errors.IsNotFound(err) {
+			hash.Write([]byte("<missing>\x00"))
+			continue
+		}
+		keys := ref.Keys
+		if keys == nil {
+			for key := range data {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+		}
+		for _, key := range keys {
+			value, ok := data[key]
+			if !ok {
+				fmt.Fprintf(hash, "%s\x00<missing>\x00", key)
+				continue
+			}
+			fmt.Fprintf(hash, "%s\x00%d\x00", key, len(value))
+			hash.Write(value)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// APIExists returns true if the cluster serves the kind in its group version.
+// Only the group version is queried, so an unavailable aggregated API does not cause an error.
+func APIExists(dc discovery.DiscoveryInterface, gvk schema.GroupVersionKind) (bool, error) {
+	resources, err := dc.ServerResourcesForGroupVersion(gvk.GroupVersion().String())
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		log.Error(err, "Failed to discover API", "GroupVersion", gvk.GroupVersion().String())
+		return false, err
+	}
+	for _, resource := range resources.APIResources {
+		if resource.Kind == gvk.Kind {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// PreferredGroupVersionKind returns the first of gvks served by the cluster,
+// or an empty GroupVersionKind when none is served.
+func PreferredGroupVersionKind(dc discovery.DiscoveryInterface, gvks []schema.GroupVersionKind) (schema.GroupVersionKind, error) {
+	for _, gvk := range gvks {
+		exists, err := APIExists(dc, gvk)
+		if err != nil {
+			return schema.GroupVersionKind{}, err
+		}
+		if exists {
+			return gvk, nil
+		}
+	}
+	return schema.GroupVersionKind{}, nil
+}
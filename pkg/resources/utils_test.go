@@ -0,0 +1,322 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package resources
+
+import (
+	"reflect"
+	"testing"
+
+	operatorv1beta1 "github.com/ibm/ibm-metering-receiver-operator/pkg/apis/operator/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	discoveryfake "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+// envValues returns the values of the env vars by name, the ones from a secret as secret/<name>/<key>
+func envValues(envVars []corev1.EnvVar) map[string]string {
+	values := map[string]string{}
+	for _, envVar := range envVars {
+		if envVar.ValueFrom != nil && envVar.ValueFrom.SecretKeyRef != nil {
+			values[envVar.Name] = "secret/" + envVar.ValueFrom.SecretKeyRef.Name + "/" + envVar.ValueFrom.SecretKeyRef.Key
+			continue
+		}
+		values[envVar.Name] = envVar.Value
+	}
+	return values
+}
+
+func TestBuildComponentEnvVars(t *testing.T) {
+	enabled := true
+	disabled := false
+	retentionDays := int32(30)
+	defaults := map[string]string{
+		"HC_DM_MCM_RECEIVER_ENABLED":     "true",
+		"HC_DM_MCM_SENDER_ENABLED":       "false",
+		"HC_DM_STORAGEREADER_ENABLED":    "false",
+		"HC_DM_REPORTER2_ENABLED":        "false",
+		"HC_DM_PURGER2_ENABLED":          "false",
+		"HC_DM_PREAGGREGATOR_ENABLED":    "false",
+		"HC_DM_METRICS_ENABLED":          "false",
+		"HC_DM_SELFMETER_PURGER_ENABLED": "false",
+		"METERING_API_ENABLED":           "false",
+	}
+
+	tests := []struct {
+		name       string
+		components operatorv1beta1.ComponentsSpec
+		want       map[string]string
+	}{
+		{
+			name: "defaults",
+			want: map[string]string{},
+		},
+		{
+			name: "receiver disabled and sender enabled",
+			components: operatorv1beta1.ComponentsSpec{
+				Receiver: operatorv1beta1.ComponentSpec{Enabled: &disabled},
+				Sender:   operatorv1beta1.ComponentSpec{Enabled: &enabled},
+			},
+			want: map[string]string{"HC_DM_MCM_RECEIVER_ENABLED": "false", "HC_DM_MCM_SENDER_ENABLED": "true"},
+		},
+		{
+			name: "purger with retention days",
+			components: operatorv1beta1.ComponentsSpec{
+				Purger: operatorv1beta1.PurgerSpec{ComponentSpec: operatorv1beta1.ComponentSpec{Enabled: &enabled}, RetentionDays: &retentionDays},
+			},
+			want: map[string]string{"HC_DM_PURGER2_ENABLED": "true", "HC_DM_PURGER2_RETENTION_DAYS": "30"},
+		},
+		{
+			name: "retention days of a disabled purger",
+			components: operatorv1beta1.ComponentsSpec{
+				Purger: operatorv1beta1.PurgerSpec{RetentionDays: &retentionDays},
+			},
+			want: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := map[string]string{}
+			for name, value := range defaults {
+				want[name] = value
+			}
+			for name, value := range tt.want {
+				want[name] = value
+			}
+			if got := envValues(BuildComponentEnvVars(tt.components)); !reflect.DeepEqual(got, want) {
+				t.Errorf("BuildComponentEnvVars() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestBuildMongoDBEnvVars(t *testing.T) {
+	tlsDisabled := false
+	credentials := operatorv1beta1.MongoDBCredentials{
+		SecretRef:   corev1.LocalObjectReference{Name: "mongodb-user"},
+		UsernameKey: "user",
+		PasswordKey: "password",
+	}
+	tlsEnvVars := map[string]string{
+		"HC_MONGO_ISSSL":    "true",
+		"HC_MONGO_SSL_CA":   "/certs/mongodb-ca/tls.crt",
+		"HC_MONGO_SSL_CERT": "/certs/mongodb-client/tls.crt",
+		"HC_MONGO_SSL_KEY":  "/certs/mongodb-client/tls.key",
+	}
+
+	tests := []struct {
+		name    string
+		mongoDB operatorv1beta1.MongoDBSpec
+		want    map[string]string
+	}{
+		{
+			name:    "host and credentials",
+			mongoDB: operatorv1beta1.MongoDBSpec{Host: "mongodb", Port: 27017, Credentials: credentials},
+			want: map[string]string{
+				"HC_MONGO_HOST": "mongodb",
+				"HC_MONGO_PORT": "27017",
+				"HC_MONGO_USER": "secret/mongodb-user/user",
+				"HC_MONGO_PASS": "secret/mongodb-user/password",
+			},
+		},
+		{
+			name: "separate password secret",
+			mongoDB: operatorv1beta1.MongoDBSpec{
+				Host: "mongodb",
+				Port: 27017,
+				Credentials: operatorv1beta1.MongoDBCredentials{
+					SecretRef:         corev1.LocalObjectReference{Name: "mongodb-user"},
+					UsernameKey:       "user",
+					PasswordKey:       "password",
+					PasswordSecretRef: &corev1.LocalObjectReference{Name: "mongodb-password"},
+				},
+			},
+			want: map[string]string{
+				"HC_MONGO_HOST": "mongodb",
+				"HC_MONGO_PORT": "27017",
+				"HC_MONGO_USER": "secret/mongodb-user/user",
+				"HC_MONGO_PASS": "secret/mongodb-password/password",
+			},
+		},
+		{
+			name: "replica set",
+			mongoDB: operatorv1beta1.MongoDBSpec{
+				Hosts:          []string{"mongodb-0", "mongodb-1:27018", "[fd00::1]:27019"},
+				Port:           27017,
+				ReplicaSet:     "rs0",
+				AuthSource:     "admin",
+				ReadPreference: operatorv1beta1.ReadPreferenceSecondaryPreferred,
+				Credentials:    credentials,
+			},
+			want: map[string]string{
+				"HC_MONGO_HOST":            "mongodb-0",
+				"HC_MONGO_PORT":            "27017",
+				"HC_MONGO_HOSTS":           "mongodb-0:27017,mongodb-1:27018,[fd00::1]:27019",
+				"HC_MONGO_REPLICA_SET":     "rs0",
+				"HC_MONGO_AUTH_SOURCE":     "admin",
+				"HC_MONGO_READ_PREFERENCE": string(operatorv1beta1.ReadPreferenceSecondaryPreferred),
+				"HC_MONGO_USER":            "secret/mongodb-user/user",
+				"HC_MONGO_PASS":            "secret/mongodb-user/password",
+			},
+		},
+		{
+			name: "URI without credentials",
+			mongoDB: operatorv1beta1.MongoDBSpec{
+				URISecretRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "mongodb-uri"},
+					Key:                  "uri",
+				},
+			},
+			want: map[string]string{
+				"HC_MONGO_URI": "secret/mongodb-uri/uri",
+			},
+		},
+		{
+			name: "TLS disabled",
+			mongoDB: operatorv1beta1.MongoDBSpec{
+				Host:        "mongodb",
+				Port:        27017,
+				Credentials: credentials,
+				TLS:         operatorv1beta1.MongoDBTLS{Enabled: &tlsDisabled},
+			},
+			want: map[string]string{
+				"HC_MONGO_HOST":  "mongodb",
+				"HC_MONGO_PORT":  "27017",
+				"HC_MONGO_USER":  "secret/mongodb-user/user",
+				"HC_MONGO_PASS":  "secret/mongodb-user/password",
+				"HC_MONGO_ISSSL": "false",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := map[string]string{}
+			if tt.mongoDB.TLS.IsEnabled() {
+				for name, value := range tlsEnvVars {
+					want[name] = value
+				}
+			}
+			for name, value := range tt.want {
+				want[name] = value
+			}
+			if got := envValues(BuildMongoDBEnvVars(tt.mongoDB)); !reflect.DeepEqual(got, want) {
+				t.Errorf("BuildMongoDBEnvVars() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// testDiscovery serves the given resources, and returns a NotFound error for the other group versions
+// like the API server does
+type testDiscovery struct {
+	discoveryfake.FakeDiscovery
+}
+
+func newTestDiscovery(resources ...*metav1.APIResourceList) *testDiscovery {
+	return &testDiscovery{discoveryfake.FakeDiscovery{Fake: &clienttesting.Fake{Resources: resources}}}
+}
+
+func (d *testDiscovery) ServerResourcesForGroupVersion(groupVersion string) (*metav1.APIResourceList, error) {
+	for _, resources := range d.Resources {
+		if resources.GroupVersion == groupVersion {
+			return resources, nil
+		}
+	}
+	return nil, errors.NewNotFound(schema.GroupResource{}, groupVersion)
+}
+
+func TestAPIExists(t *testing.T) {
+	hpaV1 := &metav1.APIResourceList{
+		GroupVersion: "autoscaling/v1",
+		APIResources: []metav1.APIResource{{Name: "horizontalpodautoscalers", Kind: "HorizontalPodAutoscaler"}},
+	}
+	hpaV2beta2 := &metav1.APIResourceList{
+		GroupVersion: "autoscaling/v2beta2",
+		APIResources: []metav1.APIResource{{Name: "horizontalpodautoscalers", Kind: "HorizontalPodAutoscaler"}},
+	}
+	tests := []struct {
+		name      string
+		resources []*metav1.APIResourceList
+		want      bool
+	}{
+		{
+			name:      "autoscaling/v2beta2 served",
+			resources: []*metav1.APIResourceList{hpaV1, hpaV2beta2},
+			want:      true,
+		},
+		{
+			name:      "only autoscaling/v1 served",
+			resources: []*metav1.APIResourceList{hpaV1},
+		},
+		{
+			name:      "autoscaling/v2beta2 served without the kind",
+			resources: []*metav1.APIResourceList{{GroupVersion: "autoscaling/v2beta2"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := APIExists(newTestDiscovery(tt.resources...), HorizontalPodAutoscalerGroupVersionKind)
+			if err != nil {
+				t.Fatalf("APIExists() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("APIExists() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreferredGroupVersionKind(t *testing.T) {
+	pdb := func(groupVersion string) *metav1.APIResourceList {
+		return &metav1.APIResourceList{
+			GroupVersion: groupVersion,
+			APIResources: []metav1.APIResource{{Name: "poddisruptionbudgets", Kind: "PodDisruptionBudget"}},
+		}
+	}
+	tests := []struct {
+		name      string
+		resources []*metav1.APIResourceList
+		want      schema.GroupVersionKind
+	}{
+		{
+			name:      "policy/v1 and policy/v1beta1 served",
+			resources: []*metav1.APIResourceList{pdb("policy/v1beta1"), pdb("policy/v1")},
+			want:      PodDisruptionBudgetGroupVersionKinds[0],
+		},
+		{
+			name:      "only policy/v1beta1 served",
+			resources: []*metav1.APIResourceList{pdb("policy/v1beta1")},
+			want:      PodDisruptionBudgetGroupVersionKinds[1],
+		},
+		{
+			name: "none served",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PreferredGroupVersionKind(newTestDiscovery(tt.resources...), PodDisruptionBudgetGroupVersionKinds)
+			if err != nil {
+				t.Fatalf("PreferredGroupVersionKind() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("PreferredGroupVersionKind() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,333 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	operatorv1beta1 "github.com/ibm/ibm-metering-receiver-operator/pkg/apis/operator/v1beta1"
+	"github.com/ibm/ibm-metering-receiver-operator/pkg/pki"
+	res "github.com/ibm/ibm-metering-receiver-operator/pkg/resources"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The serving certificate is either generated by the operator or issued by cert-manager.
+// Set WEBHOOK_CERT_SOURCE to select the source, and WEBHOOK_CLUSTER_ISSUER to select
+// the cert-manager ClusterIssuer.
+const (
+	CertSourceOperator    = "operator"
+	CertSourceCertManager = "cert-manager"
+
+	certSourceEnvVar    = "WEBHOOK_CERT_SOURCE"
+	clusterIssuerEnvVar = "WEBHOOK_CLUSTER_ISSUER"
+)
+
+// use concatenation so linter won't complain about "Secret" vars
+const certSecretName = "ibm-metering-receiver-operator-webhook-cert" + ""
+const certName = "ibm-metering-receiver-operator-webhook-cert"
+
+const (
+	caValidity      = 10 * 365 * 24 * time.Hour
+	servingValidity = 365 * 24 * time.Hour
+	renewBefore     = 30 * 24 * time.Hour
+	// the CA is renewed before it would limit the validity of a new serving certificate
+	caRenewBefore = servingValidity + renewBefore
+	// how long to wait for cert-manager to issue the certificate
+	issueTimeout = 5 * time.Minute
+)
+
+// certProvisioner stores the serving certificate in a secret, writes it to CertDir
+// and injects its CA into the webhook configurations.
+type certProvisioner struct {
+	client    client.Client
+	namespace string
+	source    string
+	// certificate is the preferred cert-manager Certificate kind, used with CertSourceCertManager
+	certificate schema.GroupVersionKind
+	// legacyCertificate is true when certmanager.k8s.io/v1alpha1 Certificates are served
+	legacyCertificate bool
+}
+
+// getCertSource returns the source of the serving certificate, the operator by default
+func getCertSource() string {
+	if os.Getenv(certSourceEnvVar) == CertSourceCertManager {
+		return CertSourceCertManager
+	}
+	return CertSourceOperator
+}
+
+// dnsNames returns the names the API server can use to reach the webhook Service
+func (p *certProvisioner) dnsNames() []string {
+	return []string{
+		ServiceName,
+		ServiceName + "." + p.namespace,
+		ServiceName + "." + p.namespace + ".svc",
+		ServiceName + "." + p.namespace + ".svc.cluster.local",
+	}
+}
+
+// discoverCertificateAPIs finds the cert-manager Certificate kinds served by the cluster
+func (p *certProvisioner) discoverCertificateAPIs(cfg *rest.Config) error {
+	dc, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return err
+	}
+	p.certificate, err = res.PreferredGroupVersionKind(dc, res.CertificateGroupVersionKinds)
+	if err != nil {
+		return err
+	}
+	if p.certificate.Empty() {
+		return fmt.Errorf("%s is %s but cert-manager is not installed", certSourceEnvVar, CertSourceCertManager)
+	}
+	p.legacyCertificate, err = res.APIExists(dc, res.LegacyCertificateGroupVersionKind)
+	return err
+}
+
+// provision makes sure the serving certificate is valid and in use
+func (p *certProvisioner) provision() error {
+	var secret *corev1.Secret
+	var err error
+	if p.source == CertSourceCertManager {
+		secret, err = p.certManagerSecret()
+	} else {
+		secret, err = p.operatorSecret()
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := writeCertFiles(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey]); err != nil {
+		return err
+	}
+	return ensureWebhookConfigurations(p.client, p.namespace, secret.Data["ca.crt"])
+}
+
+// rotate checks the serving certificate at regular intervals until stop is closed
+func (p *certProvisioner) rotate(stop <-chan struct{}) error {
+	ticker := time.NewTicker(rotationInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			if err := p.provision(); err != nil {
+				log.Error(err, "Failed to renew the webhook serving certificate")
+			}
+		}
+	}
+}
+
+// operatorSecret returns the secret with a serving certificate generated by the operator.
+// The CA key is stored in the secret as ca.key, so the serving certificate is signed again by the same CA
+// when it is about to expire. A new CA is only generated when the secret has no CA key or the CA is about
+// to expire, and the previous CA stays in ca.crt until it expires, so the API server trusts both while
+// the new serving certificate is loaded by the webhook server.
+func (p *certProvisioner) operatorSecret() (*corev1.Secret, error) {
+	logger := log.WithValues("func", "operatorSecret")
+
+	secret := &corev1.Secret{}
+	err := p.client.Get(context.TODO(), types.NamespacedName{Name: certSecretName, Namespace: p.namespace}, secret)
+	if err != nil && !apierrors.IsNotFound(err) {
+		logger.Error(err, "Failed to get webhook certificate secret", "Secret.Name", certSecretName)
+		return nil, err
+	}
+	found := err == nil
+
+	// the first certificate of ca.crt is the CA that signs the serving certificate
+	var ca *pki.KeyPair
+	caBundle := secret.Data["ca.crt"]
+	caCerts := parseCertificates(caBundle)
+	if found && len(caCerts) > 0 && len(secret.Data["ca.key"]) > 0 &&
+		!pki.NeedsRenewal(caBundle, nil, caRenewBefore) {
+		ca = &pki.KeyPair{Cert: encodeCertificate(caCerts[0]), Key: secret.Data["ca.key"]}
+	}
+	if ca != nil && len(secret.Data[corev1.TLSPrivateKeyKey]) > 0 &&
+		!pki.NeedsRenewal(secret.Data[corev1.TLSCertKey], p.dnsNames(), renewBefore) &&
+		isSignedBy(secret.Data[corev1.TLSCertKey], caCerts[0]) {
+		return secret, nil
+	}
+
+	if ca == nil {
+		logger.Info("Generating webhook CA", "Secret.Name", certSecretName)
+		ca, err = pki.NewCA(ServiceName+"-ca", caValidity)
+		if err != nil {
+			return nil, err
+		}
+		caBundle = ca.Cert
+		// keep trusting the previous CAs until they expire
+		for _, caCert := range caCerts {
+			if time.Now().Before(caCert.NotAfter) {
+				caBundle = append(caBundle, encodeCertificate(caCert)...)
+			}
+		}
+	}
+	logger.Info("Generating webhook serving certificate", "Secret.Name", certSecretName)
+	cert, err := pki.NewServingCert(ca, ServiceName, p.dnsNames(), nil, servingValidity)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string][]byte{
+		"ca.crt":                caBundle,
+		"ca.key":                ca.Key,
+		corev1.TLSCertKey:       cert.Cert,
+		corev1.TLSPrivateKeyKey: cert.Key,
+	}
+
+	if found {
+		secret.Data = data
+		err = p.client.Update(context.TODO(), secret)
+	} else {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      certSecretName,
+				Namespace: p.namespace,
+				Labels:    res.LabelsForMetadata(ServiceName),
+			},
+			Type: corev1.SecretTypeTLS,
+			Data: data,
+		}
+		err = p.client.Create(context.TODO(), secret)
+	}
+	if err != nil {
+		logger.Error(err, "Failed to save webhook certificate secret", "Secret.Name", certSecretName)
+		return nil, err
+	}
+	return secret, nil
+}
+
+// parseCertificates returns the certificates of a PEM encoded CA bundle, and skips the blocks that can't be parsed
+func parseCertificates(bundle []byte) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, bundle = pem.Decode(bundle)
+		if block == nil {
+			return certs
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			certs = append(certs, cert)
+		}
+	}
+}
+
+func encodeCertificate(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+// isSignedBy returns true if certPEM is signed by ca
+func isSignedBy(certPEM []byte, ca *x509.Certificate) bool {
+	cert, err := pki.ParseCertificate(certPEM)
+	if err != nil {
+		return false
+	}
+	return cert.CheckSignatureFrom(ca) == nil
+}
+
+// certManagerSecret creates a cert-manager Certificate for the webhook Service
+// and waits for cert-manager to store it in the secret.
+func (p *certProvisioner) certManagerSecret() (*corev1.Secret, error) {
+	logger := log.WithValues("func", "certManagerSecret")
+
+	certData := res.CertificateData{
+		Name:      certName,
+		Secret:    certSecretName,
+		Common:    ServiceName,
+		App:       ServiceName,
+		Component: ServiceName,
+		DNSNames:  p.dnsNames(),
+	}
+	clusterIssuer := os.Getenv(clusterIssuerEnvVar)
+	if clusterIssuer == "" {
+		clusterIssuer = operatorv1beta1.DefaultClusterIssuer
+	}
+	certificate, err := res.BuildCertificate(p.certificate, p.namespace, clusterIssuer, certData)
+	if err != nil {
+		return nil, err
+	}
+	needToRequeue := false
+	if err := res.ReconcileCertificate(p.client, p.namespace, certName, certificate, &needToRequeue); err != nil {
+		return nil, err
+	}
+	// the Certificate was migrated to cert-manager.io, delete the one of the old cert-manager
+	if p.legacyCertificate && p.certificate != res.LegacyCertificateGroupVersionKind {
+		err := res.DeleteIfExists(p.client, nil, p.namespace, certName, "legacy Certificate",
+			res.NewCertificate(res.LegacyCertificateGroupVersionKind))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	logger.Info("Waiting for cert-manager to issue the webhook serving certificate", "Secret.Name", certSecretName)
+	secret := &corev1.Secret{}
+	err = wait.PollImmediate(5*time.Second, issueTimeout, func() (bool, error) {
+		err := p.client.Get(context.TODO(), types.NamespacedName{Name: certSecretName, Namespace: p.namespace}, secret)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		return len(secret.Data[corev1.TLSCertKey]) > 0 && len(secret.Data[corev1.TLSPrivateKeyKey]) > 0 &&
+			len(secret.Data["ca.crt"]) > 0, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("webhook certificate was not issued by cert-manager: %v", err)
+	}
+	return secret, nil
+}
+
+// writeCertFiles writes the certificate and key for the webhook server when they changed
+func writeCertFiles(cert, key []byte) error {
+	if err := os.MkdirAll(CertDir, 0700); err != nil {
+		return err
+	}
+	files := map[string][]byte{
+		corev1.TLSCertKey:       cert,
+		corev1.TLSPrivateKeyKey: key,
+	}
+	for name, data := range files {
+		path := filepath.Join(CertDir, name)
+		current, err := ioutil.ReadFile(path)
+		if err == nil && bytes.Equal(current, data) {
+			continue
+		}
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
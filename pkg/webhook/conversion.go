@@ -0,0 +1,96 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package webhook
+
+import (
+	"context"
+	"reflect"
+
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// crdName is the name of the MeteringReceiver CRD
+const crdName = "meteringreceivers.operator.ibm.com"
+
+// path of the conversion webhook registered by controller-runtime
+const conversionPath = "/convert"
+
+// ensureCRDConversion points the conversion webhook of the MeteringReceiver CRD
+// to the webhook Service, so the API server can convert between v1alpha1 and v1beta1.
+// The CRD manifest can't know the operator namespace and the CA, so they are set here.
+func ensureCRDConversion(c client.Client, namespace string, caBundle []byte) error {
+	logger := log.WithValues("func", "ensureCRDConversion")
+
+	crd := &apiextensionsv1beta1.CustomResourceDefinition{}
+	err := c.Get(context.TODO(), types.NamespacedName{Name: crdName}, crd)
+	if err != nil {
+		logger.Error(err, "Failed to get CRD", "Name", crdName)
+		return err
+	}
+
+	path := conversionPath
+	var port int32 = 443
+	conversion := &apiextensionsv1beta1.CustomResourceConversion{
+		Strategy: apiextensionsv1beta1.WebhookConverter,
+		WebhookClientConfig: &apiextensionsv1beta1.WebhookClientConfig{
+			Service: &apiextensionsv1beta1.ServiceReference{
+				Namespace: namespace,
+				Name:      ServiceName,
+				Path:      &path,
+				Port:      &port,
+			},
+			CABundle: caBundle,
+		},
+		ConversionReviewVersions: []string{"v1beta1"},
+	}
+	// a conversion webhook requires the unknown fields to be pruned
+	preserveUnknownFields := false
+	if reflect.DeepEqual(crd.Spec.Conversion, conversion) && reflect.DeepEqual(crd.Spec.PreserveUnknownFields, &preserveUnknownFields) {
+		return nil
+	}
+
+	logger.Info("Updating conversion webhook of CRD", "Name", crdName)
+	crd.Spec.Conversion = conversion
+	crd.Spec.PreserveUnknownFields = &preserveUnknownFields
+	return c.Update(context.TODO(), crd)
+}
+
+// disableCRDConversion sets the None conversion strategy on the MeteringReceiver CRD when the operator does not serve
+// the conversion webhook, otherwise the API server fails every request that needs a conversion.
+// The API server then only changes the apiVersion, so v1alpha1 CRs should be migrated to v1beta1 first.
+func disableCRDConversion(c client.Client) error {
+	logger := log.WithValues("func", "disableCRDConversion")
+
+	crd := &apiextensionsv1beta1.CustomResourceDefinition{}
+	err := c.Get(context.TODO(), types.NamespacedName{Name: crdName}, crd)
+	if err != nil {
+		logger.Error(err, "Failed to get CRD", "Name", crdName)
+		return err
+	}
+
+	if crd.Spec.Conversion == nil || crd.Spec.Conversion.Strategy == apiextensionsv1beta1.NoneConverter {
+		return nil
+	}
+
+	logger.Info("Disabling conversion webhook of CRD", "Name", crdName)
+	crd.Spec.Conversion = &apiextensionsv1beta1.CustomResourceConversion{
+		Strategy: apiextensionsv1beta1.NoneConverter,
+	}
+	return c.Update(context.TODO(), crd)
+}
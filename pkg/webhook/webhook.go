@@ -0,0 +1,322 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package webhook serves the MeteringReceiver admission and conversion webhooks from the operator manager.
+// It provisions the serving certificate and creates the Service and webhook configurations
+// that route admission and conversion requests to the operator pod.
+package webhook
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"time"
+
+	operatorv1beta1 "github.com/ibm/ibm-metering-receiver-operator/pkg/apis/operator/v1beta1"
+	res "github.com/ibm/ibm-metering-receiver-operator/pkg/resources"
+	"github.com/operator-framework/operator-sdk/pkg/k8sutil"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// Port is the port the webhook server listens on in the operator pod
+const Port = 9443
+
+// CertDir is the directory the serving certificate is written to for the webhook server
+const CertDir = "/tmp/k8s-webhook-server/serving-certs"
+
+// ServiceName is the name of the Service in front of the webhook server
+const ServiceName = "ibm-metering-receiver-operator-webhook"
+
+// the webhook configurations are cluster scoped, so their names include the operator namespace
+const configNamePrefix = "ibm-metering-receiver-operator-"
+
+// paths generated by controller-runtime for the MeteringReceiver webhooks
+const (
+	mutatingPath   = "/mutate-operator-ibm-com-v1beta1-meteringreceiver"
+	validatingPath = "/validate-operator-ibm-com-v1beta1-meteringreceiver"
+)
+
+// the serving certificate is checked at this interval and renewed when needed
+const rotationInterval = 12 * time.Hour
+
+// set ENABLE_WEBHOOKS to false to run the operator without admission webhooks
+const enableWebhooksEnvVar = "ENABLE_WEBHOOKS"
+
+// operatorPodLabels select the operator pod, see deploy/operator.yaml
+var operatorPodLabels = map[string]string{"name": "ibm-metering-receiver-operator"}
+
+var log = logf.Log.WithName("webhook")
+
+// Setup registers the MeteringReceiver webhooks with the webhook server of the manager,
+// provisions the serving certificate and creates the Service and webhook configurations.
+// It must be called before the manager is started, because the webhook server
+// needs the certificate files when it starts.
+func Setup(mgr manager.Manager) error {
+	// the manager cache is not started yet, so read directly from the API server
+	c, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme()})
+	if err != nil {
+		return err
+	}
+
+	namespace, err := k8sutil.GetOperatorNamespace()
+	runLocal := errors.Is(err, k8sutil.ErrRunLocal) || errors.Is(err, k8sutil.ErrNoNamespace)
+	if err != nil && !runLocal {
+		return err
+	}
+
+	if os.Getenv(enableWebhooksEnvVar) == "false" {
+		log.Info("Webhooks are disabled")
+		// the validating webhook fails closed, so its configuration must not be left without a server
+		if !runLocal {
+			if err := deleteWebhookConfigurations(c, namespace); err != nil {
+				return err
+			}
+		}
+		// /convert is not served, so the CRD must not send conversion requests to the operator
+		return disableCRDConversion(c)
+	}
+	if runLocal {
+		log.Info("Skipping webhook setup; not running in a cluster.")
+		return disableCRDConversion(c)
+	}
+	p := &certProvisioner{
+		client:    c,
+		namespace: namespace,
+		source:    getCertSource(),
+	}
+	if p.source == CertSourceCertManager {
+		if err := p.discoverCertificateAPIs(mgr.GetConfig()); err != nil {
+			return err
+		}
+	}
+
+	if err := ensureService(c, namespace); err != nil {
+		return err
+	}
+	if err := p.provision(); err != nil {
+		return err
+	}
+
+	// registers the conversion webhook too, because v1alpha1 converts to v1beta1
+	if err := (&operatorv1beta1.MeteringReceiver{}).SetupWebhookWithManager(mgr); err != nil {
+		return err
+	}
+
+	// renew the serving certificate while the operator is running
+	return mgr.Add(manager.RunnableFunc(p.rotate))
+}
+
+// ensureService creates or updates the Service that routes admission requests to the operator pod
+func ensureService(c client.Client, namespace string) error {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ServiceName,
+			Namespace: namespace,
+			Labels:    res.LabelsForMetadata(ServiceName),
+		},
+		Spec: corev1.ServiceSpec{
+			Type: corev1.ServiceTypeClusterIP,
+			Ports: []corev1.ServicePort{
+				{
+					Name:     "webhook",
+					Protocol: corev1.ProtocolTCP,
+					Port:     443,
+					TargetPort: intstr.IntOrString{
+						Type:   intstr.Int,
+						IntVal: Port,
+					},
+				},
+			},
+			Selector: operatorPodLabels,
+		},
+	}
+	needToRequeue := false
+	return res.ReconcileService(c, namespace, ServiceName, "Webhook", service, &needToRequeue)
+}
+
+// ensureWebhookConfigurations creates or updates the webhook configurations with the CA of the serving certificate
+func ensureWebhookConfigurations(c client.Client, namespace string, caBundle []byte) error {
+	if err := ensureCRDConversion(c, namespace, caBundle); err != nil {
+		return err
+	}
+	if err := ensureMutatingWebhookConfiguration(c, namespace, caBundle); err != nil {
+		return err
+	}
+	return ensureValidatingWebhookConfiguration(c, namespace, caBundle)
+}
+
+// meteringReceiverRules match the requests that create or update a MeteringReceiver.
+// Requests for v1alpha1 are converted to v1beta1, because the webhooks use the Equivalent match policy.
+func meteringReceiverRules() []admissionregistrationv1.RuleWithOperations {
+	scope := admissionregistrationv1.NamespacedScope
+	return []admissionregistrationv1.RuleWithOperations{
+		{
+			Operations: []admissionregistrationv1.OperationType{
+				admissionregistrationv1.Create,
+				admissionregistrationv1.Update,
+			},
+			Rule: admissionregistrationv1.Rule{
+				APIGroups:   []string{operatorv1beta1.SchemeGroupVersion.Group},
+				APIVersions: []string{operatorv1beta1.SchemeGroupVersion.Version},
+				Resources:   []string{"meteringreceivers"},
+				Scope:       &scope,
+			},
+		},
+	}
+}
+
+// webhookClientConfig returns the client config that routes requests for path to the webhook Service
+func webhookClientConfig(namespace, path string, caBundle []byte) admissionregistrationv1.WebhookClientConfig {
+	var port int32 = 443
+	return admissionregistrationv1.WebhookClientConfig{
+		Service: &admissionregistrationv1.ServiceReference{
+			Namespace: namespace,
+			Name:      ServiceName,
+			Path:      &path,
+			Port:      &port,
+		},
+		CABundle: caBundle,
+	}
+}
+
+func ensureMutatingWebhookConfiguration(c client.Client, namespace string, caBundle []byte) error {
+	logger := log.WithValues("func", "ensureMutatingWebhookConfiguration")
+
+	name := configNamePrefix + namespace
+	// the operator also sets the defaults before it reconciles a CR,
+	// so an operator that is not running must not block changes to the CRs
+	failurePolicy := admissionregistrationv1.Ignore
+	sideEffects := admissionregistrationv1.SideEffectClassNone
+	matchPolicy := admissionregistrationv1.Equivalent
+	reinvocationPolicy := admissionregistrationv1.NeverReinvocationPolicy
+	var timeoutSeconds int32 = 10
+	webhooks := []admissionregistrationv1.MutatingWebhook{
+		{
+			Name:                    "mmeteringreceiver.operator.ibm.com",
+			ClientConfig:            webhookClientConfig(namespace, mutatingPath, caBundle),
+			Rules:                   meteringReceiverRules(),
+			FailurePolicy:           &failurePolicy,
+			MatchPolicy:             &matchPolicy,
+			NamespaceSelector:       &metav1.LabelSelector{},
+			ObjectSelector:          &metav1.LabelSelector{},
+			SideEffects:             &sideEffects,
+			TimeoutSeconds:          &timeoutSeconds,
+			AdmissionReviewVersions: []string{"v1beta1"},
+			ReinvocationPolicy:      &reinvocationPolicy,
+		},
+	}
+
+	current := &admissionregistrationv1.MutatingWebhookConfiguration{}
+	err := c.Get(context.TODO(), types.NamespacedName{Name: name}, current)
+	if err != nil && apierrors.IsNotFound(err) {
+		logger.Info("Creating MutatingWebhookConfiguration", "Name", name)
+		return c.Create(context.TODO(), &admissionregistrationv1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: res.LabelsForMetadata(ServiceName),
+			},
+			Webhooks: webhooks,
+		})
+	} else if err != nil {
+		logger.Error(err, "Failed to get MutatingWebhookConfiguration", "Name", name)
+		return err
+	}
+
+	if reflect.DeepEqual(current.Webhooks, webhooks) {
+		return nil
+	}
+	logger.Info("Updating MutatingWebhookConfiguration", "Name", name)
+	current.Webhooks = webhooks
+	return c.Update(context.TODO(), current)
+}
+
+func ensureValidatingWebhookConfiguration(c client.Client, namespace string, caBundle []byte) error {
+	logger := log.WithValues("func", "ensureValidatingWebhookConfiguration")
+
+	name := configNamePrefix + namespace
+	// invalid CRs must not be stored while the operator is not running, the controller would only reject them later.
+	// The configuration is deleted when the operator runs with the webhooks disabled.
+	failurePolicy := admissionregistrationv1.Fail
+	sideEffects := admissionregistrationv1.SideEffectClassNone
+	matchPolicy := admissionregistrationv1.Equivalent
+	var timeoutSeconds int32 = 10
+	webhooks := []admissionregistrationv1.ValidatingWebhook{
+		{
+			Name:                    "vmeteringreceiver.operator.ibm.com",
+			ClientConfig:            webhookClientConfig(namespace, validatingPath, caBundle),
+			Rules:                   meteringReceiverRules(),
+			FailurePolicy:           &failurePolicy,
+			MatchPolicy:             &matchPolicy,
+			NamespaceSelector:       &metav1.LabelSelector{},
+			ObjectSelector:          &metav1.LabelSelector{},
+			SideEffects:             &sideEffects,
+			TimeoutSeconds:          &timeoutSeconds,
+			AdmissionReviewVersions: []string{"v1beta1"},
+		},
+	}
+
+	current := &admissionregistrationv1.ValidatingWebhookConfiguration{}
+	err := c.Get(context.TODO(), types.NamespacedName{Name: name}, current)
+	if err != nil && apierrors.IsNotFound(err) {
+		logger.Info("Creating ValidatingWebhookConfiguration", "Name", name)
+		return c.Create(context.TODO(), &admissionregistrationv1.ValidatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: res.LabelsForMetadata(ServiceName),
+			},
+			Webhooks: webhooks,
+		})
+	} else if err != nil {
+		logger.Error(err, "Failed to get ValidatingWebhookConfiguration", "Name", name)
+		return err
+	}
+
+	if reflect.DeepEqual(current.Webhooks, webhooks) {
+		return nil
+	}
+	logger.Info("Updating ValidatingWebhookConfiguration", "Name", name)
+	current.Webhooks = webhooks
+	return c.Update(context.TODO(), current)
+}
+
+// deleteWebhookConfigurations deletes the webhook configurations of the operator namespace
+func deleteWebhookConfigurations(c client.Client, namespace string) error {
+	logger := log.WithValues("func", "deleteWebhookConfigurations")
+
+	name := configNamePrefix + namespace
+	for _, config := range []runtime.Object{
+		&admissionregistrationv1.MutatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: name}},
+		&admissionregistrationv1.ValidatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: name}},
+	} {
+		err := c.Delete(context.TODO(), config)
+		if err != nil && !apierrors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete webhook configuration", "Name", name)
+			return err
+		}
+	}
+	logger.Info("Deleted the webhook configurations", "Name", name)
+	return nil
+}
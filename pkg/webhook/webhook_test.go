@@ -0,0 +1,228 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ibm/ibm-metering-receiver-operator/pkg/pki"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const testNamespace = "ibm-common-services"
+
+func TestWebhookConfigurations(t *testing.T) {
+	c := fake.NewFakeClientWithScheme(clientgoscheme.Scheme)
+	name := types.NamespacedName{Name: configNamePrefix + testNamespace}
+
+	if err := ensureMutatingWebhookConfiguration(c, testNamespace, []byte("ca")); err != nil {
+		t.Fatalf("ensureMutatingWebhookConfiguration() error = %v", err)
+	}
+	if err := ensureValidatingWebhookConfiguration(c, testNamespace, []byte("ca")); err != nil {
+		t.Fatalf("ensureValidatingWebhookConfiguration() error = %v", err)
+	}
+
+	// invalid CRs are rejected while the operator is not running
+	validating := &admissionregistrationv1.ValidatingWebhookConfiguration{}
+	if err := c.Get(context.TODO(), name, validating); err != nil {
+		t.Fatal(err)
+	}
+	if policy := validating.Webhooks[0].FailurePolicy; policy == nil || *policy != admissionregistrationv1.Fail {
+		t.Errorf("validating failurePolicy = %v, want %v", policy, admissionregistrationv1.Fail)
+	}
+	if string(validating.Webhooks[0].ClientConfig.CABundle) != "ca" {
+		t.Errorf("validating caBundle = %q, want %q", validating.Webhooks[0].ClientConfig.CABundle, "ca")
+	}
+
+	// the configurations are deleted when the webhooks are disabled, twice to check a missing one is not an error
+	for i := 0; i < 2; i++ {
+		if err := deleteWebhookConfigurations(c, testNamespace); err != nil {
+			t.Fatalf("deleteWebhookConfigurations() error = %v", err)
+		}
+	}
+	if err := c.Get(context.TODO(), name, validating); !apierrors.IsNotFound(err) {
+		t.Errorf("ValidatingWebhookConfiguration after delete: error = %v, want not found", err)
+	}
+	if err := c.Get(context.TODO(), name, &admissionregistrationv1.MutatingWebhookConfiguration{}); !apierrors.IsNotFound(err) {
+		t.Errorf("MutatingWebhookConfiguration after delete: error = %v, want not found", err)
+	}
+}
+
+func TestOperatorSecret(t *testing.T) {
+	p := &certProvisioner{namespace: testNamespace, source: CertSourceOperator}
+	newCA := func(validity time.Duration) *pki.KeyPair {
+		ca, err := pki.NewCA(ServiceName+"-ca", validity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ca
+	}
+	newServingCert := func(ca *pki.KeyPair, validity time.Duration) *pki.KeyPair {
+		cert, err := pki.NewServingCert(ca, ServiceName, p.dnsNames(), nil, validity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+	newSecret := func(data map[string][]byte) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: certSecretName, Namespace: testNamespace},
+			Type:       corev1.SecretTypeTLS,
+			Data:       data,
+		}
+	}
+	ca := newCA(caValidity)
+	serving := newServingCert(ca, servingValidity)
+	expiringCA := newCA(caRenewBefore - time.Hour)
+	expiredCA := newCA(-time.Minute)
+
+	tests := []struct {
+		name string
+		// secret is the existing secret, nil when it does not exist
+		secret *corev1.Secret
+		// wantCAs are the previous CAs in the CA bundle after the new one, nil when the CA is kept
+		wantCAs        [][]byte
+		wantNewCA      bool
+		wantNewServing bool
+	}{
+		{
+			name:           "no secret",
+			wantNewCA:      true,
+			wantNewServing: true,
+		},
+		{
+			name: "valid certificates",
+			secret: newSecret(map[string][]byte{
+				"ca.crt": ca.Cert, "ca.key": ca.Key, corev1.TLSCertKey: serving.Cert, corev1.TLSPrivateKeyKey: serving.Key,
+			}),
+		},
+		{
+			name: "serving certificate about to expire",
+			secret: newSecret(map[string][]byte{
+				"ca.crt": ca.Cert, "ca.key": ca.Key,
+				corev1.TLSCertKey: newServingCert(ca, renewBefore-time.Hour).Cert, corev1.TLSPrivateKeyKey: serving.Key,
+			}),
+			wantNewServing: true,
+		},
+		{
+			name: "serving certificate of another CA",
+			secret: newSecret(map[string][]byte{
+				"ca.crt": ca.Cert, "ca.key": ca.Key,
+				corev1.TLSCertKey: newServingCert(newCA(caValidity), servingValidity).Cert, corev1.TLSPrivateKeyKey: serving.Key,
+			}),
+			wantNewServing: true,
+		},
+		{
+			name: "CA key not stored",
+			secret: newSecret(map[string][]byte{
+				"ca.crt": ca.Cert, corev1.TLSCertKey: serving.Cert, corev1.TLSPrivateKeyKey: serving.Key,
+			}),
+			wantCAs:        [][]byte{ca.Cert},
+			wantNewCA:      true,
+			wantNewServing: true,
+		},
+		{
+			name: "CA about to expire",
+			secret: newSecret(map[string][]byte{
+				"ca.crt": expiringCA.Cert, "ca.key": expiringCA.Key,
+				corev1.TLSCertKey: newServingCert(expiringCA, servingValidity).Cert, corev1.TLSPrivateKeyKey: serving.Key,
+			}),
+			wantCAs:        [][]byte{expiringCA.Cert},
+			wantNewCA:      true,
+			wantNewServing: true,
+		},
+		{
+			name: "expired previous CA",
+			secret: newSecret(map[string][]byte{
+				"ca.crt": append(append([]byte{}, expiringCA.Cert...), expiredCA.Cert...), "ca.key": expiringCA.Key,
+				corev1.TLSCertKey: serving.Cert, corev1.TLSPrivateKeyKey: serving.Key,
+			}),
+			wantCAs:        [][]byte{expiringCA.Cert},
+			wantNewCA:      true,
+			wantNewServing: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objs []runtime.Object
+			if tt.secret != nil {
+				objs = append(objs, tt.secret.DeepCopy())
+			}
+			p.client = fake.NewFakeClientWithScheme(clientgoscheme.Scheme, objs...)
+
+			secret, err := p.operatorSecret()
+			if err != nil {
+				t.Fatalf("operatorSecret() error = %v", err)
+			}
+			stored := &corev1.Secret{}
+			err = p.client.Get(context.TODO(), types.NamespacedName{Name: certSecretName, Namespace: testNamespace}, stored)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(stored.Data, secret.Data) {
+				t.Error("operatorSecret() returned data that is not stored")
+			}
+
+			caCerts := parseCertificates(secret.Data["ca.crt"])
+			if len(caCerts) != len(tt.wantCAs)+1 {
+				t.Fatalf("CA bundle has %d certificates, want %d", len(caCerts), len(tt.wantCAs)+1)
+			}
+			for i, want := range tt.wantCAs {
+				if got := encodeCertificate(caCerts[i+1]); !bytes.Equal(got, want) {
+					t.Errorf("CA bundle certificate %d is not the previous CA", i+1)
+				}
+			}
+			var oldCA []byte
+			if tt.secret != nil {
+				oldCA = tt.secret.Data["ca.crt"]
+			}
+			if newCA := !bytes.HasPrefix(oldCA, encodeCertificate(caCerts[0])); newCA != tt.wantNewCA {
+				t.Errorf("new CA = %v, want %v", newCA, tt.wantNewCA)
+			}
+			// the stored CA key signs the serving certificate, so it can be renewed with the same CA
+			caKeyPair := &pki.KeyPair{Cert: encodeCertificate(caCerts[0]), Key: secret.Data["ca.key"]}
+			if _, err := pki.NewServingCert(caKeyPair, ServiceName, nil, nil, time.Hour); err != nil {
+				t.Errorf("ca.key is not the key of the CA: %v", err)
+			}
+
+			var oldServing []byte
+			if tt.secret != nil {
+				oldServing = tt.secret.Data[corev1.TLSCertKey]
+			}
+			if newServing := !bytes.Equal(secret.Data[corev1.TLSCertKey], oldServing); newServing != tt.wantNewServing {
+				t.Errorf("new serving certificate = %v, want %v", newServing, tt.wantNewServing)
+			}
+			if !isSignedBy(secret.Data[corev1.TLSCertKey], caCerts[0]) {
+				t.Error("serving certificate is not signed by the first CA of the bundle")
+			}
+			if pki.NeedsRenewal(secret.Data[corev1.TLSCertKey], p.dnsNames(), renewBefore) {
+				t.Error("serving certificate needs renewal")
+			}
+		})
+	}
+}